@@ -0,0 +1,301 @@
+package dbsql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"hash/fnv"
+
+	"github.com/neumachen/dbsql/internal"
+)
+
+// AdvisoryLockKey identifies a PostgreSQL advisory lock. Use AdvisoryLockKeyOf to derive a key from a name.
+type AdvisoryLockKey int64
+
+// AdvisoryLockKeyOf returns the key of the named lock, a 64-bit FNV-1a hash of the name. Distinct names
+// may collide, so keep the names of the locks of an application in one place.
+func AdvisoryLockKeyOf(name string) AdvisoryLockKey {
+	hash := fnv.New64a()
+	hash.Write([]byte(name))
+	return AdvisoryLockKey(hash.Sum64())
+}
+
+// AdvisoryLockFunc is a function run while holding an advisory lock. For a session lock, db is the
+// connection holding the lock; for a transaction lock, it is the transaction.
+type AdvisoryLockFunc func(ctx context.Context, db DBPreparerExecutor) error
+
+// AdvisoryLockOption configures WithAdvisoryLock and TryAdvisoryLock.
+type AdvisoryLockOption func(lock *advisoryLock)
+
+// AdvisoryLockShared takes the lock in shared mode: shared holders do not exclude each other, only
+// exclusive ones.
+func AdvisoryLockShared() AdvisoryLockOption {
+	return func(lock *advisoryLock) {
+		lock.shared = true
+	}
+}
+
+// AdvisoryLockInTransaction takes a transaction-scoped lock: the function runs inside a transaction
+// started with opts and the lock is released when it commits or rolls back. If the handle already is a
+// transaction, the lock is taken in it and held until it ends.
+func AdvisoryLockInTransaction(opts *sql.TxOptions) AdvisoryLockOption {
+	return func(lock *advisoryLock) {
+		lock.transaction = true
+		lock.txOptions = opts
+	}
+}
+
+// advisoryLock is an advisory lock to take, as configured by the options.
+type advisoryLock struct {
+	key         AdvisoryLockKey
+	try         bool
+	shared      bool
+	transaction bool
+	txOptions   *sql.TxOptions
+}
+
+// WithAdvisoryLock runs lockFunc while holding the advisory lock of the key, waiting for the lock as long
+// as ctx allows.
+//
+// By default the lock is session-scoped: a connection is reserved from dbPrepExec, which must be, or wrap,
+// a DBConnector such as *sql.DB, the lock is taken on it, lockFunc runs with it and the lock is released
+// on it when lockFunc returns, so lock and unlock always happen on the same connection. If the lock cannot
+// be released, the connection is discarded instead of being returned to the pool, which releases the lock
+// when the database notices. Use AdvisoryLockInTransaction for a transaction-scoped lock.
+//
+// If dbPrepExec wraps the DBConnector, the handle given to lockFunc wraps the reserved connection in the
+// same layers, e.g. it refuses writes behind WithReadOnly and is traced behind WithTracer; reads are not
+// shared by WithSingleflight, since they may depend on the state of the session. Wrappers that cannot
+// wrap a reserved connection, such as Router, make the lock fail rather than being bypassed. The
+// statements taking and releasing the lock are sent as is on the reserved connection and bypass every
+// layer.
+//
+// Example:
+//
+//	err := dbsql.WithAdvisoryLock(ctx, db, dbsql.AdvisoryLockKeyOf("monthly_invoices"), func(ctx context.Context, conn dbsql.DBPreparerExecutor) error {
+//		return generateMonthlyInvoices(ctx, conn)
+//	})
+func WithAdvisoryLock(
+	ctx context.Context,
+	dbPrepExec DBPreparerExecutor,
+	key AdvisoryLockKey,
+	lockFunc AdvisoryLockFunc,
+	opts ...AdvisoryLockOption,
+) error {
+	return runWithAdvisoryLock(ctx, dbPrepExec, &advisoryLock{key: key}, lockFunc, opts)
+}
+
+// TryAdvisoryLock is WithAdvisoryLock without waiting: if another session holds the lock, it returns
+// ErrLockNotAvailable without running lockFunc.
+//
+// Example:
+//
+//	// only one replica runs the scheduler at a time
+//	err := dbsql.TryAdvisoryLock(ctx, db, dbsql.AdvisoryLockKeyOf("scheduler"), runScheduler)
+//	if errors.Is(err, dbsql.ErrLockNotAvailable) {
+//		// another replica is the leader
+//	}
+func TryAdvisoryLock(
+	ctx context.Context,
+	dbPrepExec DBPreparerExecutor,
+	key AdvisoryLockKey,
+	lockFunc AdvisoryLockFunc,
+	opts ...AdvisoryLockOption,
+) error {
+	return runWithAdvisoryLock(ctx, dbPrepExec, &advisoryLock{key: key, try: true}, lockFunc, opts)
+}
+
+// runWithAdvisoryLock takes the lock, runs lockFunc and releases the lock.
+func runWithAdvisoryLock(
+	ctx context.Context,
+	dbPrepExec DBPreparerExecutor,
+	lock *advisoryLock,
+	lockFunc AdvisoryLockFunc,
+	opts []AdvisoryLockOption,
+) error {
+	if internal.IsNil(dbPrepExec) {
+		return errors.New("db connection is nil")
+	}
+
+	if lockFunc == nil {
+		return errors.New("lock func is nil")
+	}
+
+	ctx = internal.InitIfNilContext(ctx)
+
+	for i := range opts {
+		opts[i](lock)
+	}
+
+	if lock.transaction {
+		return lock.runInTx(ctx, dbPrepExec, lockFunc)
+	}
+	return lock.runInSession(ctx, dbPrepExec, lockFunc)
+}
+
+// runInTx takes the transaction-scoped lock and runs lockFunc in the same transaction.
+func (l *advisoryLock) runInTx(ctx context.Context, dbPrepExec DBPreparerExecutor, lockFunc AdvisoryLockFunc) error {
+	txFunc := func(ctx context.Context, tx DBPreparerExecutor) error {
+		if err := l.acquire(ctx, tx); err != nil {
+			return err
+		}
+		return lockFunc(ctx, tx)
+	}
+
+	if inTransaction(dbPrepExec) {
+		return txFunc(ctx, dbPrepExec)
+	}
+	return WithTransaction(ctx, dbPrepExec, l.txOptions, txFunc)
+}
+
+// runInSession reserves a connection, takes the session-scoped lock on it, runs lockFunc and releases the
+// lock on the same connection.
+func (l *advisoryLock) runInSession(
+	ctx context.Context,
+	dbPrepExec DBPreparerExecutor,
+	lockFunc AdvisoryLockFunc,
+) (err error) {
+	conn, session, err := reserveConn(ctx, dbPrepExec)
+	if err != nil {
+		return err
+	}
+
+	if err := l.acquire(ctx, &pinnedConn{Conn: conn}); err != nil {
+		return errors.Join(err, conn.Close())
+	}
+
+	// The lock is released even if lockFunc panics, or it would be held for the life of the connection.
+	defer func() {
+		err = errors.Join(err, l.release(ctx, conn))
+	}()
+
+	return lockFunc(ctx, session)
+}
+
+// function returns the name of the advisory lock function with the given action, e.g. "lock".
+func (l *advisoryLock) function(action string) string {
+	function := "pg_"
+	if l.try && action == "lock" {
+		function += "try_"
+	}
+	function += "advisory_"
+	if l.transaction {
+		function += "xact_"
+	}
+	function += action
+	if l.shared {
+		function += "_shared"
+	}
+	return function
+}
+
+// acquire takes the lock on dbExec. It returns ErrLockNotAvailable if the lock is tried and held.
+func (l *advisoryLock) acquire(ctx context.Context, dbExec DBExecutor) error {
+	query := "SELECT " + l.function("lock") + "($1)"
+
+	if !l.try {
+		if _, err := dbExec.ExecContext(ctx, query, int64(l.key)); err != nil {
+			return ClassifyError(err)
+		}
+		return nil
+	}
+
+	var acquired bool
+	if err := dbExec.QueryRowContext(ctx, query, int64(l.key)).Scan(&acquired); err != nil {
+		return ClassifyError(err)
+	}
+	if !acquired {
+		return ErrLockNotAvailable
+	}
+	return nil
+}
+
+// release releases the session-scoped lock on conn and closes it, returning the connection to the pool.
+// If the lock cannot be released, the connection is discarded.
+func (l *advisoryLock) release(ctx context.Context, conn *sql.Conn) error {
+	// The lock is released even if ctx is done.
+	ctx = context.WithoutCancel(ctx)
+
+	var released bool
+	err := conn.QueryRowContext(ctx, "SELECT "+l.function("unlock")+"($1)", int64(l.key)).Scan(&released)
+	if err == nil && !released {
+		err = fmt.Errorf("advisory lock %d was not held", l.key)
+	}
+	if err != nil {
+		// The session may still hold the lock, so the connection must not be reused.
+		_ = conn.Raw(func(any) error {
+			return driver.ErrBadConn
+		})
+		return ClassifyError(err)
+	}
+
+	return conn.Close()
+}
+
+// sessionWrapper is implemented by the wrappers that can wrap a connection reserved from the handle they
+// wrap, so the statements sent on it pass through the same layers.
+type sessionWrapper interface {
+	Unwrap() DBPreparerExecutor
+	// wrapSession returns conn wrapped the way the wrapper wraps its own handle.
+	wrapSession(conn DBPreparerExecutor) DBPreparerExecutor
+}
+
+// reserveConn reserves a connection from dbPrepExec, which must be a DBConnector or wrap one in
+// sessionWrappers only, and returns it with a handle that sends statements on it through those wrappers.
+func reserveConn(ctx context.Context, dbPrepExec DBPreparerExecutor) (*sql.Conn, DBPreparerExecutor, error) {
+	var wrappers []sessionWrapper
+	connector, ok := dbPrepExec.(DBConnector)
+	for !ok {
+		wrapper, isWrapper := dbPrepExec.(sessionWrapper)
+		if !isWrapper {
+			return nil, nil, errors.New("db connection cannot reserve a connection")
+		}
+		wrappers = append(wrappers, wrapper)
+		dbPrepExec = wrapper.Unwrap()
+		connector, ok = dbPrepExec.(DBConnector)
+	}
+
+	conn, err := connector.Conn(ctx)
+	if err != nil {
+		return nil, nil, ClassifyError(err)
+	}
+
+	var session DBPreparerExecutor = &pinnedConn{Conn: conn}
+	for i := len(wrappers) - 1; i >= 0; i-- {
+		session = wrappers[i].wrapSession(session)
+	}
+	return conn, session, nil
+}
+
+// pinnedConn adapts a reserved *sql.Conn to DBPreparerExecutor, so every statement sent with it uses the
+// same connection.
+type pinnedConn struct {
+	*sql.Conn
+}
+
+// Prepare creates a prepared statement on the connection.
+func (p *pinnedConn) Prepare(query string) (*sql.Stmt, error) {
+	return p.PrepareContext(context.Background(), query)
+}
+
+// Exec executes a query on the connection without returning any rows.
+func (p *pinnedConn) Exec(query string, args ...any) (sql.Result, error) {
+	return p.ExecContext(context.Background(), query, args...)
+}
+
+// Query executes a query on the connection that returns rows.
+func (p *pinnedConn) Query(query string, args ...any) (*sql.Rows, error) {
+	return p.QueryContext(context.Background(), query, args...)
+}
+
+// QueryRow executes a query on the connection that is expected to return at most one row.
+func (p *pinnedConn) QueryRow(query string, args ...any) *sql.Row {
+	return p.QueryRowContext(context.Background(), query, args...)
+}
+
+var (
+	_ DBPreparerExecutor = (*pinnedConn)(nil)
+	_ DBTxBeginner       = (*pinnedConn)(nil)
+)
@@ -0,0 +1,174 @@
+package dbsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdvisoryLock(t *testing.T) {
+	t.Parallel()
+
+	lockResult := func(fake *fakeDriver, acquired, released bool) {
+		fake.QueryFunc = func(query string, args []any) (driver.Rows, error) {
+			if query == "SELECT pg_advisory_unlock($1)" || query == "SELECT pg_advisory_unlock_shared($1)" {
+				return newFakeRows([]string{"released"}, []driver.Value{released}), nil
+			}
+			return newFakeRows([]string{"acquired"}, []driver.Value{acquired}), nil
+		}
+	}
+
+	tests := []struct {
+		desc      string
+		assertion func(*testing.T, string)
+	}{
+		{
+			desc: "Session locks are taken and released on the connection lockFunc runs with",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fake := NewFakeDB(t)
+				lockResult(fake, true, true)
+
+				// Another connection is idle in the pool, so a lock not pinned to one could be released on it.
+				busy, err := sqlDB.Conn(context.Background())
+				require.NoError(t, err, desc)
+				idle, err := sqlDB.Conn(context.Background())
+				require.NoError(t, err, desc)
+				require.NoError(t, idle.Close(), desc)
+
+				err = WithAdvisoryLock(context.Background(), WithSingleflight(sqlDB), 42, func(ctx context.Context, conn DBPreparerExecutor) error {
+					_, err := conn.ExecContext(ctx, "UPDATE jobs SET done = true")
+					return err
+				})
+				require.NoError(t, err, desc)
+				require.NoError(t, busy.Close(), desc)
+
+				require.Len(t, fake.Execs, 2, desc)
+				require.Equal(t, "SELECT pg_advisory_lock($1)", fake.Execs[0].Query, desc)
+				require.Equal(t, []any{int64(42)}, fake.Execs[0].Args, desc)
+				require.Equal(t, "SELECT pg_advisory_unlock($1)", fake.LastQuery().Query, desc)
+				require.Equal(t, fake.Execs[0].Conn, fake.Execs[1].Conn, desc)
+				require.Equal(t, fake.Execs[0].Conn, fake.LastQuery().Conn, desc)
+				require.Equal(t, 0, fake.Closes, desc)
+			},
+		},
+		{
+			desc: "Session locks wrap the reserved connection in the layers of the handle, or fail if they cannot",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fake := NewFakeDB(t)
+				lockResult(fake, true, true)
+
+				var intercepted []Operation
+				db := WithReadOnly(WithInterceptors(sqlDB, func(ctx context.Context, call *Call, next CallHandler) (*CallResult, error) {
+					intercepted = append(intercepted, call.Operation)
+					return next(ctx, call)
+				}))
+				selectJobs, err := PrepareStatement("SELECT job_id FROM jobs")
+				require.NoError(t, err, desc)
+
+				err = WithAdvisoryLock(context.Background(), db, 42, func(ctx context.Context, conn DBPreparerExecutor) error {
+					if _, err := conn.ExecContext(ctx, "UPDATE jobs SET done = true"); !errors.Is(err, ErrReadOnly) {
+						return errors.New("write was not refused")
+					}
+					_, err := QueryRows(ctx, conn, selectJobs)
+					return err
+				})
+				require.NoError(t, err, desc)
+				require.Equal(t, []Operation{OperationQueryRows}, intercepted, desc)
+				require.Equal(t, 1, fake.ExecCount(), desc)
+
+				router, err := NewRouter(sqlDB, nil)
+				require.NoError(t, err, desc)
+				err = WithAdvisoryLock(context.Background(), router, 42, func(context.Context, DBPreparerExecutor) error {
+					return nil
+				})
+				require.EqualError(t, err, "db connection cannot reserve a connection", desc)
+			},
+		},
+		{
+			desc: "Locks held elsewhere are not waited for by TryAdvisoryLock",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fake := NewFakeDB(t)
+				lockResult(fake, false, true)
+
+				called := false
+				err := TryAdvisoryLock(context.Background(), sqlDB, AdvisoryLockKeyOf("scheduler"), func(context.Context, DBPreparerExecutor) error {
+					called = true
+					return nil
+				}, AdvisoryLockShared())
+				require.ErrorIs(t, err, ErrLockNotAvailable, desc)
+				require.False(t, called, desc)
+				require.Equal(t, "SELECT pg_try_advisory_lock_shared($1)", fake.LastQuery().Query, desc)
+				require.Equal(t, []any{int64(AdvisoryLockKeyOf("scheduler"))}, fake.LastQuery().Args, desc)
+				require.Equal(t, 1, fake.QueryCount(), desc)
+
+				lockResult(fake, true, true)
+				err = TryAdvisoryLock(context.Background(), sqlDB, AdvisoryLockKeyOf("scheduler"), func(context.Context, DBPreparerExecutor) error {
+					called = true
+					return errors.New("scheduler failed")
+				}, AdvisoryLockShared())
+				require.EqualError(t, err, "scheduler failed", desc)
+				require.True(t, called, desc)
+				require.Equal(t, "SELECT pg_advisory_unlock_shared($1)", fake.LastQuery().Query, desc)
+				require.Equal(t, 0, fake.Closes, desc)
+
+				require.Equal(t, AdvisoryLockKeyOf("scheduler"), AdvisoryLockKeyOf("scheduler"), desc)
+				require.NotEqual(t, AdvisoryLockKeyOf("scheduler"), AdvisoryLockKeyOf("reports"), desc)
+			},
+		},
+		{
+			desc: "Connections whose lock cannot be released are discarded",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fake := NewFakeDB(t)
+				lockResult(fake, true, false)
+
+				err := WithAdvisoryLock(context.Background(), sqlDB, 7, func(context.Context, DBPreparerExecutor) error {
+					return nil
+				})
+				require.EqualError(t, err, "advisory lock 7 was not held", desc)
+				require.Equal(t, 1, fake.Closes, desc)
+				require.Equal(t, 0, sqlDB.Stats().OpenConnections, desc)
+			},
+		},
+		{
+			desc: "Transaction locks are taken in the transaction and released when it ends",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fake := NewFakeDB(t)
+
+				err := WithAdvisoryLock(context.Background(), sqlDB, 42, func(ctx context.Context, tx DBPreparerExecutor) error {
+					require.True(t, inTransaction(tx), desc)
+					return nil
+				}, AdvisoryLockInTransaction(nil))
+				require.NoError(t, err, desc)
+				require.Equal(t, "SELECT pg_advisory_xact_lock($1)", fake.LastExec().Query, desc)
+				require.Equal(t, 0, fake.QueryCount(), desc)
+				require.Equal(t, 1, fake.Begins, desc)
+				require.Equal(t, 1, fake.Commits, desc)
+
+				err = WithTransaction(context.Background(), sqlDB, nil, func(ctx context.Context, tx DBPreparerExecutor) error {
+					err := WithAdvisoryLock(ctx, tx, 42, func(context.Context, DBPreparerExecutor) error {
+						return nil
+					})
+					require.EqualError(t, err, "db connection cannot reserve a connection", desc)
+
+					return WithAdvisoryLock(ctx, tx, 42, func(context.Context, DBPreparerExecutor) error {
+						return nil
+					}, AdvisoryLockInTransaction(nil))
+				})
+				require.NoError(t, err, desc)
+				require.Equal(t, 2, fake.ExecCount(), desc)
+				require.Equal(t, 2, fake.Begins, desc)
+			},
+		},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			tc.assertion(t, tc.desc)
+		})
+	}
+}
@@ -0,0 +1,369 @@
+package dbsql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned by CircuitBreakerDB for the calls it refuses while its circuit is open.
+var ErrCircuitOpen = errors.New("circuit open")
+
+// CircuitState is the state of a CircuitBreakerDB.
+type CircuitState int
+
+const (
+	// CircuitClosed lets every call through and records its outcome.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen refuses every call with ErrCircuitOpen until the open timeout has passed.
+	CircuitOpen
+	// CircuitHalfOpen probes whether the database has recovered; other calls are refused meanwhile.
+	CircuitHalfOpen
+)
+
+var circuitStateNames = [...]string{
+	CircuitClosed:   "closed",
+	CircuitOpen:     "open",
+	CircuitHalfOpen: "half_open",
+}
+
+// String returns the name of the state, e.g. "half_open".
+func (s CircuitState) String() string {
+	if s < 0 || int(s) >= len(circuitStateNames) {
+		return "unknown"
+	}
+	return circuitStateNames[s]
+}
+
+// CircuitBreakerPolicy configures WithCircuitBreaker.
+type CircuitBreakerPolicy struct {
+	// WindowSize is the number of most recent calls the failure rate is computed over. Values below 1 are
+	// treated as 1.
+	WindowSize int
+	// MinimumCalls is the number of calls the window must hold before the circuit may open. Values below
+	// 1 are treated as 1.
+	MinimumCalls int
+	// FailureRateThreshold is the fraction, between 0 and 1, of failed calls in the window at which the
+	// circuit opens. Values outside (0, 1] are treated as 1.
+	FailureRateThreshold float64
+	// OpenTimeout is how long the circuit stays open before the database is probed.
+	OpenTimeout time.Duration
+	// ProbeTimeout bounds the Ping probing the database once the open timeout has passed. The probe does
+	// not use the context of the call that triggers it, so a caller giving up does not open the circuit
+	// again. Values below 1 are treated as 5s.
+	ProbeTimeout time.Duration
+	// IgnoredSQLStateClasses are the two-character SQLSTATE classes of errors that do not count as
+	// failures because they are caused by the request rather than by the database's health, e.g. "23"
+	// for integrity constraint violations. Canceled contexts never count as failures.
+	IgnoredSQLStateClasses []string
+	// OnStateChange, if set, is called with every state transition, e.g. to log it or export a metric. It
+	// is called while the breaker is locked and must not use the CircuitBreakerDB.
+	OnStateChange func(from, to CircuitState)
+}
+
+// DefaultCircuitBreakerPolicy returns a CircuitBreakerPolicy that opens the circuit when half of the last
+// 20 calls failed, with at least 10 calls recorded, probes the database after 5s with a 5s timeout, and
+// ignores integrity constraint violations (class 23).
+func DefaultCircuitBreakerPolicy() CircuitBreakerPolicy {
+	return CircuitBreakerPolicy{
+		WindowSize:             20,
+		MinimumCalls:           10,
+		FailureRateThreshold:   0.5,
+		OpenTimeout:            5 * time.Second,
+		ProbeTimeout:           5 * time.Second,
+		IgnoredSQLStateClasses: []string{"23"},
+	}
+}
+
+// circuitBreaker holds the state shared by a CircuitBreakerDB and the tx handles it hands out.
+type circuitBreaker struct {
+	policy CircuitBreakerPolicy
+	now    func() time.Time
+
+	mu       sync.Mutex
+	state    CircuitState
+	openedAt time.Time
+	outcomes []bool
+	next     int
+	calls    int
+	failures int
+}
+
+// CircuitBreakerDB is a database handle that stops sending calls to a database that keeps failing, so an
+// overloaded database gets a chance to recover. It is returned by WithCircuitBreaker.
+//
+// While the circuit is closed, the outcome of every call is recorded. Once the failure rate over the
+// window reaches the threshold, the circuit opens and calls fail fast with ErrCircuitOpen. After the open
+// timeout, the circuit turns half-open: the next call probes the database with Ping, or is itself the
+// probe if the handle does not implement DBPinger, and the circuit closes if the probe succeeds or opens
+// again if it fails. A call that is the probe and is canceled, or runs out of time, leaves the circuit
+// open for the next call to probe again.
+//
+// Only the calls made through the package-level Exec, Query and QueryRow functions and the transactions
+// started with WithTransaction pass through the breaker, and errors reported when QueryRow's Row is
+// scanned are not recorded. A transaction is recorded as a single call, which fails if it cannot begin
+// or commit or if one of its statements fails; errors returned by the transaction func itself are not
+// failures of the database.
+type CircuitBreakerDB struct {
+	wrappedDB
+	breaker *circuitBreaker
+	// tx collects the outcome of the transaction the handle belongs to, or is nil outside of one.
+	tx *circuitTx
+}
+
+// circuitTx collects the outcome of a transaction started through a CircuitBreakerDB.
+type circuitTx struct {
+	mu           sync.Mutex
+	began        bool
+	statementErr error
+}
+
+// statementFailed records err as the outcome of the transaction unless a statement failed before.
+func (t *circuitTx) statementFailed(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.statementErr == nil {
+		t.statementErr = err
+	}
+}
+
+// outcome returns the error the transaction is recorded with, given the transaction func's error and
+// the error returned by WithTransaction.
+func (t *circuitTx) outcome(funcErr, txErr error) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch {
+	case !t.began:
+		// BeginTx failed.
+		return txErr
+	case t.statementErr != nil:
+		return t.statementErr
+	case funcErr == nil:
+		// Commit failed, if txErr is set.
+		return txErr
+	default:
+		return nil
+	}
+}
+
+// WithCircuitBreaker wraps dbPrepExec with a circuit breaker configured by policy.
+//
+// Example:
+//
+//	db := dbsql.WithCircuitBreaker(sqlDB, dbsql.DefaultCircuitBreakerPolicy())
+//	mappedRows, err := dbsql.QueryContext(ctx, db, selectCustomers)
+//	if errors.Is(err, dbsql.ErrCircuitOpen) {
+//		// respond with 503 Service Unavailable
+//	}
+func WithCircuitBreaker(dbPrepExec DBPreparerExecutor, policy CircuitBreakerPolicy) *CircuitBreakerDB {
+	if policy.WindowSize < 1 {
+		policy.WindowSize = 1
+	}
+	if policy.MinimumCalls < 1 {
+		policy.MinimumCalls = 1
+	}
+	if policy.FailureRateThreshold <= 0 || policy.FailureRateThreshold > 1 {
+		policy.FailureRateThreshold = 1
+	}
+	if policy.ProbeTimeout < 1 {
+		policy.ProbeTimeout = defaultProbeTimeout
+	}
+
+	return &CircuitBreakerDB{
+		wrappedDB: wrappedDB{dbPrepExec},
+		breaker: &circuitBreaker{
+			policy:   policy,
+			now:      time.Now,
+			outcomes: make([]bool, policy.WindowSize),
+		},
+	}
+}
+
+// State returns the current state of the circuit.
+func (c *CircuitBreakerDB) State() CircuitState {
+	c.breaker.mu.Lock()
+	defer c.breaker.mu.Unlock()
+	return c.breaker.state
+}
+
+// InterceptCall refuses the call with ErrCircuitOpen while the circuit is open, and otherwise runs the
+// interceptor chain of the wrapped handle, if any, and records the outcome. Calls made inside a
+// transaction were let through with the transaction and count towards its outcome instead.
+func (c *CircuitBreakerDB) InterceptCall(ctx context.Context, call *Call, next CallHandler) (*CallResult, error) {
+	if c.tx != nil {
+		callResult, err := interceptCall(ctx, c.DBPreparerExecutor, call, next)
+		if c.breaker.failure(err) {
+			c.tx.statementFailed(err)
+		}
+		return callResult, err
+	}
+
+	if err := c.allow(ctx); err != nil {
+		return nil, err
+	}
+
+	callResult, err := interceptCall(ctx, c.DBPreparerExecutor, call, next)
+	c.breaker.record(err)
+
+	return callResult, err
+}
+
+// RunInTx runs txFunc inside a transaction started on the wrapped handle, unless the circuit is open,
+// and records the outcome of the transaction. The tx handle given to txFunc shares the circuit.
+func (c *CircuitBreakerDB) RunInTx(ctx context.Context, opts *sql.TxOptions, txFunc TxFunc) error {
+	if c.tx != nil {
+		return WithTransaction(ctx, c.DBPreparerExecutor, opts, txFunc)
+	}
+
+	if err := c.allow(ctx); err != nil {
+		return err
+	}
+
+	tx := &circuitTx{}
+	var funcErr error
+	err := WithTransaction(ctx, c.DBPreparerExecutor, opts, func(ctx context.Context, txDB DBPreparerExecutor) error {
+		tx.mu.Lock()
+		tx.began = true
+		tx.mu.Unlock()
+
+		funcErr = txFunc(ctx, &CircuitBreakerDB{wrappedDB: wrappedDB{txDB}, breaker: c.breaker, tx: tx})
+		return funcErr
+	})
+	c.breaker.record(tx.outcome(funcErr, err))
+
+	return err
+}
+
+// wrapSession returns conn sharing the circuit.
+func (c *CircuitBreakerDB) wrapSession(conn DBPreparerExecutor) DBPreparerExecutor {
+	return &CircuitBreakerDB{wrappedDB: wrappedDB{conn}, breaker: c.breaker}
+}
+
+// allow returns ErrCircuitOpen if the call must be refused. The first call after the open timeout turns
+// the circuit half-open and probes the database.
+func (c *CircuitBreakerDB) allow(ctx context.Context) error {
+	b := c.breaker
+
+	b.mu.Lock()
+	switch {
+	case b.state == CircuitClosed:
+		b.mu.Unlock()
+		return nil
+	case b.state == CircuitHalfOpen, b.now().Sub(b.openedAt) < b.policy.OpenTimeout:
+		b.mu.Unlock()
+		return ErrCircuitOpen
+	}
+	b.transition(CircuitHalfOpen)
+	b.mu.Unlock()
+
+	probeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), b.policy.ProbeTimeout)
+	probed, err := pingContext(probeCtx, c.DBPreparerExecutor)
+	cancel()
+	if !probed {
+		// The call is the probe; record decides the state from its outcome.
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err != nil {
+		b.open()
+		return ErrCircuitOpen
+	}
+	b.close()
+	return nil
+}
+
+// record records the outcome of a call.
+func (b *circuitBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	failed := b.failure(err)
+
+	switch b.state {
+	case CircuitHalfOpen:
+		switch {
+		case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+			// The caller gave up on the probe; the next call probes again.
+			b.transition(CircuitOpen)
+		case failed:
+			b.open()
+		default:
+			b.close()
+		}
+		return
+	case CircuitOpen:
+		// The call was let through before the circuit opened.
+		return
+	}
+
+	if b.calls == len(b.outcomes) {
+		if b.outcomes[b.next] {
+			b.failures--
+		}
+	} else {
+		b.calls++
+	}
+	b.outcomes[b.next] = failed
+	if failed {
+		b.failures++
+	}
+	b.next = (b.next + 1) % len(b.outcomes)
+
+	if b.calls >= b.policy.MinimumCalls &&
+		float64(b.failures)/float64(b.calls) >= b.policy.FailureRateThreshold {
+		b.open()
+	}
+}
+
+// failure reports whether err counts as a failure of the database.
+func (b *circuitBreaker) failure(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	if sqlState := SQLState(err); len(sqlState) >= 2 {
+		for _, class := range b.policy.IgnoredSQLStateClasses {
+			if sqlState[:2] == class {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// open opens the circuit. The caller must hold the lock.
+func (b *circuitBreaker) open() {
+	b.openedAt = b.now()
+	b.transition(CircuitOpen)
+}
+
+// close closes the circuit and clears the window. The caller must hold the lock.
+func (b *circuitBreaker) close() {
+	for i := range b.outcomes {
+		b.outcomes[i] = false
+	}
+	b.next, b.calls, b.failures = 0, 0, 0
+	b.transition(CircuitClosed)
+}
+
+// transition moves the circuit to the given state. The caller must hold the lock.
+func (b *circuitBreaker) transition(to CircuitState) {
+	from := b.state
+	b.state = to
+	if from != to && b.policy.OnStateChange != nil {
+		b.policy.OnStateChange(from, to)
+	}
+}
+
+var (
+	_ DB             = (*CircuitBreakerDB)(nil)
+	_ DBInterceptor  = (*CircuitBreakerDB)(nil)
+	_ DBTransactor   = (*CircuitBreakerDB)(nil)
+	_ sessionWrapper = (*CircuitBreakerDB)(nil)
+)
@@ -0,0 +1,275 @@
+package dbsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCircuitBreakerDB(t *testing.T) {
+	t.Parallel()
+
+	policy := CircuitBreakerPolicy{
+		WindowSize:             4,
+		MinimumCalls:           2,
+		FailureRateThreshold:   0.5,
+		OpenTimeout:            time.Minute,
+		IgnoredSQLStateClasses: []string{"23"},
+	}
+
+	newStatement := func(t *testing.T) PreparedStatement {
+		insertCustomer, err := PrepareStatement("INSERT INTO customers (first_name) VALUES (@first_name)")
+		require.NoError(t, err)
+		return insertCustomer
+	}
+
+	tests := []struct {
+		desc      string
+		assertion func(*testing.T, string)
+	}{
+		{
+			desc: "The circuit opens at the failure rate, fails fast and closes after a successful ping",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fake := NewFakeDB(t)
+				fake.ExecFunc = func(string, []any) (driver.Result, error) {
+					return nil, errors.New("too many connections")
+				}
+				pinger := &pingStubDB{DBPreparerExecutor: sqlDB, err: errors.New("connection refused")}
+
+				var transitions []string
+				policy := policy
+				policy.OnStateChange = func(from, to CircuitState) {
+					transitions = append(transitions, from.String()+">"+to.String())
+				}
+				db := WithCircuitBreaker(pinger, policy)
+				now := time.Now()
+				db.breaker.now = func() time.Time { return now }
+				insertCustomer := newStatement(t)
+
+				for i := 0; i < 2; i++ {
+					_, err := ExecContext(context.Background(), db, insertCustomer, BindParameterValue("first_name", "John"))
+					require.EqualError(t, err, "too many connections", desc)
+				}
+				require.Equal(t, CircuitOpen, db.State(), desc)
+
+				_, err := ExecContext(context.Background(), db, insertCustomer, BindParameterValue("first_name", "John"))
+				require.ErrorIs(t, err, ErrCircuitOpen, desc)
+				require.Equal(t, 2, fake.ExecCount(), desc)
+
+				// The probe fails and the circuit opens again.
+				now = now.Add(time.Minute)
+				_, err = ExecContext(context.Background(), db, insertCustomer, BindParameterValue("first_name", "John"))
+				require.ErrorIs(t, err, ErrCircuitOpen, desc)
+				require.Equal(t, CircuitOpen, db.State(), desc)
+
+				// The probe succeeds and the call goes through.
+				now = now.Add(time.Minute)
+				pinger.setErr(nil)
+				fake.ExecFunc = nil
+				_, err = ExecContext(context.Background(), db, insertCustomer, BindParameterValue("first_name", "John"))
+				require.NoError(t, err, desc)
+				require.Equal(t, CircuitClosed, db.State(), desc)
+				require.Equal(t, 3, fake.ExecCount(), desc)
+
+				require.Equal(t, []string{
+					"closed>open", "open>half_open", "half_open>open", "open>half_open", "half_open>closed",
+				}, transitions, desc)
+			},
+		},
+		{
+			desc: "Constraint violations and canceled contexts do not count as failures",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fake := NewFakeDB(t)
+				fake.ExecFunc = func(string, []any) (driver.Result, error) {
+					return nil, &pq.Error{Code: "23505", Message: "duplicate key value violates unique constraint"}
+				}
+
+				db := WithCircuitBreaker(sqlDB, policy)
+				insertCustomer := newStatement(t)
+
+				for i := 0; i < 4; i++ {
+					_, err := ExecContext(context.Background(), db, insertCustomer, BindParameterValue("first_name", "John"))
+					require.ErrorIs(t, err, ErrUniqueViolation, desc)
+				}
+
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				for i := 0; i < 4; i++ {
+					_, err := ExecContext(ctx, db, insertCustomer, BindParameterValue("first_name", "John"))
+					require.ErrorIs(t, err, context.Canceled, desc)
+				}
+
+				require.Equal(t, CircuitClosed, db.State(), desc)
+			},
+		},
+		{
+			desc: "Without a pinger the first call after the timeout is the probe",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fake := NewFakeDB(t)
+				fake.ExecFunc = func(string, []any) (driver.Result, error) {
+					return nil, errors.New("too many connections")
+				}
+
+				// Hide the *sql.DB's Ping and PingContext methods.
+				db := WithCircuitBreaker(struct{ DBPreparerExecutor }{sqlDB}, policy)
+				now := time.Now()
+				db.breaker.now = func() time.Time { return now }
+				insertCustomer := newStatement(t)
+
+				for i := 0; i < 2; i++ {
+					_, err := ExecContext(context.Background(), db, insertCustomer, BindParameterValue("first_name", "John"))
+					require.Error(t, err, desc)
+				}
+				require.Equal(t, CircuitOpen, db.State(), desc)
+
+				now = now.Add(time.Minute)
+				_, err := ExecContext(context.Background(), db, insertCustomer, BindParameterValue("first_name", "John"))
+				require.EqualError(t, err, "too many connections", desc)
+				require.Equal(t, CircuitOpen, db.State(), desc)
+				require.Equal(t, 3, fake.ExecCount(), desc)
+
+				now = now.Add(time.Minute)
+				fake.ExecFunc = nil
+				_, err = ExecContext(context.Background(), db, insertCustomer, BindParameterValue("first_name", "John"))
+				require.NoError(t, err, desc)
+				require.Equal(t, CircuitClosed, db.State(), desc)
+			},
+		},
+		{
+			desc: "A caller giving up does not decide the probe",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fake := NewFakeDB(t)
+				fake.ExecFunc = func(string, []any) (driver.Result, error) {
+					return nil, errors.New("too many connections")
+				}
+
+				// Pings succeed after a delay the caller does not wait for.
+				pinger := &pingStubDB{DBPreparerExecutor: sqlDB, delay: 20 * time.Millisecond}
+				db := WithCircuitBreaker(pinger, policy)
+				now := time.Now()
+				db.breaker.now = func() time.Time { return now }
+				insertCustomer := newStatement(t)
+
+				for i := 0; i < 2; i++ {
+					_, err := ExecContext(context.Background(), db, insertCustomer, BindParameterValue("first_name", "John"))
+					require.Error(t, err, desc)
+				}
+				require.Equal(t, CircuitOpen, db.State(), desc)
+
+				now = now.Add(time.Minute)
+				fake.ExecFunc = nil
+				ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+				defer cancel()
+				_, err := ExecContext(ctx, db, insertCustomer, BindParameterValue("first_name", "John"))
+				require.ErrorIs(t, err, context.DeadlineExceeded, desc)
+				require.Equal(t, CircuitClosed, db.State(), desc)
+
+				// Without a pinger, a canceled probe call leaves the circuit open for the next call.
+				fake.ExecFunc = func(string, []any) (driver.Result, error) {
+					return nil, errors.New("too many connections")
+				}
+				unpinged := WithCircuitBreaker(struct{ DBPreparerExecutor }{sqlDB}, policy)
+				unpinged.breaker.now = func() time.Time { return now }
+				for i := 0; i < 2; i++ {
+					_, err := ExecContext(context.Background(), unpinged, insertCustomer, BindParameterValue("first_name", "John"))
+					require.Error(t, err, desc)
+				}
+				require.Equal(t, CircuitOpen, unpinged.State(), desc)
+
+				now = now.Add(time.Minute)
+				canceled, cancel := context.WithCancel(context.Background())
+				cancel()
+				_, err = ExecContext(canceled, unpinged, insertCustomer, BindParameterValue("first_name", "John"))
+				require.ErrorIs(t, err, context.Canceled, desc)
+				require.Equal(t, CircuitOpen, unpinged.State(), desc)
+
+				fake.ExecFunc = nil
+				_, err = ExecContext(context.Background(), unpinged, insertCustomer, BindParameterValue("first_name", "John"))
+				require.NoError(t, err, desc)
+				require.Equal(t, CircuitClosed, unpinged.State(), desc)
+			},
+		},
+		{
+			desc: "Transactions share the circuit",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fake := NewFakeDB(t)
+				fake.ExecFunc = func(string, []any) (driver.Result, error) {
+					return nil, errors.New("too many connections")
+				}
+
+				db := WithCircuitBreaker(sqlDB, policy)
+				insertCustomer := newStatement(t)
+
+				for i := 0; i < 2; i++ {
+					err := WithTransaction(context.Background(), db, nil, func(ctx context.Context, tx DBPreparerExecutor) error {
+						_, err := ExecContext(ctx, tx, insertCustomer, BindParameterValue("first_name", "John"))
+						return err
+					})
+					require.Error(t, err, desc)
+				}
+				require.Equal(t, CircuitOpen, db.State(), desc)
+
+				err := WithTransaction(context.Background(), db, nil, func(context.Context, DBPreparerExecutor) error {
+					return nil
+				})
+				require.ErrorIs(t, err, ErrCircuitOpen, desc)
+				require.Equal(t, 2, fake.Begins, desc)
+			},
+		},
+		{
+			desc: "A transaction is recorded as a single call, and failing to begin it counts as a failure",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fake := NewFakeDB(t)
+				fake.BeginFunc = func() error {
+					return errors.New("too many connections")
+				}
+
+				// Hide the *sql.DB's Ping and PingContext methods, so the transaction is the probe.
+				db := WithCircuitBreaker(struct {
+					DBPreparerExecutor
+					DBTxBeginner
+				}{sqlDB, sqlDB}, policy)
+				now := time.Now()
+				db.breaker.now = func() time.Time { return now }
+
+				for i := 0; i < 2; i++ {
+					err := WithTransaction(context.Background(), db, nil, func(context.Context, DBPreparerExecutor) error {
+						return nil
+					})
+					require.EqualError(t, err, "too many connections", desc)
+				}
+				require.Equal(t, CircuitOpen, db.State(), desc)
+
+				now = now.Add(time.Minute)
+				fake.BeginFunc = nil
+				err := WithTransaction(context.Background(), db, nil, func(context.Context, DBPreparerExecutor) error {
+					return nil
+				})
+				require.NoError(t, err, desc)
+				require.Equal(t, CircuitClosed, db.State(), desc)
+
+				for i := 0; i < 2; i++ {
+					err := WithTransaction(context.Background(), db, nil, func(context.Context, DBPreparerExecutor) error {
+						return errors.New("customer not found")
+					})
+					require.EqualError(t, err, "customer not found", desc)
+				}
+				require.Equal(t, CircuitClosed, db.State(), desc)
+				require.Equal(t, 2, fake.Rollbacks, desc)
+			},
+		},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			tc.assertion(t, tc.desc)
+		})
+	}
+}
@@ -0,0 +1,281 @@
+package dbsql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/neumachen/dbsql/internal"
+)
+
+// MappedRower is implemented by types that can be converted to a MappedRow, e.g. the structs given to
+// CopyFromStructs.
+type MappedRower interface {
+	MappedRow() MappedRow
+}
+
+// CopyResult is the result of a COPY FROM bulk load.
+type CopyResult struct {
+	// RowsCopied is the number of rows copied into the table.
+	RowsCopied int64
+}
+
+// CopyFrom bulk loads mappedRows into table with COPY FROM STDIN. The table may be schema-qualified,
+// e.g. "billing.invoices". Every row must have exactly the given columns; the rows are validated before
+// anything is sent.
+//
+// The rows are copied inside a transaction that is started, and committed, by CopyFrom unless dbPrepExec
+// already is a transaction. COPY is a protocol of its own, so the calls bypass the interceptor chain; a
+// CachedDB wrapping dbPrepExec still invalidates the cached queries on the table.
+//
+// Example:
+//
+//	result, err := dbsql.CopyFrom(ctx, db, "customers", dbsql.Columns{"first_name", "last_name"}, mappedRows)
+func CopyFrom(
+	ctx context.Context,
+	dbPrepExec DBPreparerExecutor,
+	table string,
+	columns Columns,
+	mappedRows MappedRows,
+) (
+	CopyResult,
+	error,
+) {
+	if err := validateCopyColumns(columns); err != nil {
+		return CopyResult{}, err
+	}
+
+	for i := range mappedRows {
+		if err := validateCopyRow(columns, mappedRows[i]); err != nil {
+			return CopyResult{}, fmt.Errorf("row %d: %w", i, err)
+		}
+	}
+
+	i := 0
+	return copyFrom(ctx, dbPrepExec, table, columns, func(context.Context) (MappedRow, bool, error) {
+		if i >= len(mappedRows) {
+			return nil, false, nil
+		}
+		i++
+		return mappedRows[i-1], true, nil
+	})
+}
+
+// CopyFromChannel bulk loads the rows received from mappedRows into table with COPY FROM STDIN, until
+// the channel is closed. Each row is validated against columns when it is received; an invalid row
+// aborts the copy and rolls it back. Cancel ctx to stop a producer blocked on a copy that failed.
+//
+// See CopyFrom for the table name and transaction handling.
+func CopyFromChannel(
+	ctx context.Context,
+	dbPrepExec DBPreparerExecutor,
+	table string,
+	columns Columns,
+	mappedRows <-chan MappedRow,
+) (
+	CopyResult,
+	error,
+) {
+	if err := validateCopyColumns(columns); err != nil {
+		return CopyResult{}, err
+	}
+
+	if mappedRows == nil {
+		return CopyResult{}, errors.New("rows channel is nil")
+	}
+
+	i := 0
+	return copyFrom(ctx, dbPrepExec, table, columns, func(ctx context.Context) (MappedRow, bool, error) {
+		select {
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		case mappedRow, ok := <-mappedRows:
+			if !ok {
+				return nil, false, nil
+			}
+			if err := validateCopyRow(columns, mappedRow); err != nil {
+				return nil, false, fmt.Errorf("row %d: %w", i, err)
+			}
+			i++
+			return mappedRow, true, nil
+		}
+	})
+}
+
+// CopyFromStructs bulk loads rows, converted with their MappedRow method, into table with COPY FROM
+// STDIN. The rows are converted and validated before anything is sent.
+//
+// See CopyFrom for the table name and transaction handling.
+func CopyFromStructs[T MappedRower](
+	ctx context.Context,
+	dbPrepExec DBPreparerExecutor,
+	table string,
+	columns Columns,
+	rows []T,
+) (
+	CopyResult,
+	error,
+) {
+	mappedRows := make(MappedRows, len(rows))
+	for i := range rows {
+		if internal.IsNil(rows[i]) {
+			return CopyResult{}, fmt.Errorf("row %d: row is nil", i)
+		}
+		mappedRows[i] = rows[i].MappedRow()
+	}
+
+	return CopyFrom(ctx, dbPrepExec, table, columns, mappedRows)
+}
+
+// copyRowFunc returns the next row to copy, or false once there are no more rows.
+type copyRowFunc func(ctx context.Context) (MappedRow, bool, error)
+
+// copyFrom copies the rows returned by next into table, inside a transaction unless dbPrepExec already
+// is one.
+func copyFrom(
+	ctx context.Context,
+	dbPrepExec DBPreparerExecutor,
+	table string,
+	columns Columns,
+	next copyRowFunc,
+) (
+	CopyResult,
+	error,
+) {
+	if internal.IsNil(dbPrepExec) {
+		return CopyResult{}, errors.New("db connection is nil")
+	}
+
+	if strings.TrimSpace(table) == "" {
+		return CopyResult{}, errors.New("table is empty")
+	}
+
+	ctx = internal.InitIfNilContext(ctx)
+
+	if inTransaction(dbPrepExec) {
+		return copyRows(ctx, dbPrepExec, table, columns, next)
+	}
+
+	var result CopyResult
+	err := WithTransaction(ctx, dbPrepExec, nil, func(ctx context.Context, tx DBPreparerExecutor) error {
+		var err error
+		result, err = copyRows(ctx, tx, table, columns, next)
+		return err
+	})
+	if err != nil {
+		return CopyResult{}, err
+	}
+
+	return result, nil
+}
+
+// copyRows prepares the COPY statement on tx, sends every row and flushes the copy.
+func copyRows(
+	ctx context.Context,
+	tx DBPreparerExecutor,
+	table string,
+	columns Columns,
+	next copyRowFunc,
+) (
+	CopyResult,
+	error,
+) {
+	prepStmnt, err := dbPrepare(ctx, tx, copyInStatement(table, columns))
+	if err != nil {
+		return CopyResult{}, ClassifyError(err)
+	}
+	defer prepStmnt.Close()
+
+	if cached, ok := unwrapTo[*CachedDB](tx); ok {
+		// The table is invalidated even if the copy fails, as for the writes made through the CachedDB.
+		defer cached.wrote([]string{table})
+	}
+
+	var sent int64
+	values := make([]any, len(columns))
+	for {
+		mappedRow, ok, err := next(ctx)
+		if err != nil {
+			return CopyResult{}, err
+		}
+		if !ok {
+			break
+		}
+
+		for i, column := range columns {
+			values[i] = mappedRow[column]
+		}
+		if _, err := prepStmnt.ExecContext(ctx, values...); err != nil {
+			return CopyResult{}, ClassifyError(err)
+		}
+		sent++
+	}
+
+	// Executing the statement without values flushes the copy and reports the rows copied.
+	result, err := prepStmnt.ExecContext(ctx)
+	if err != nil {
+		return CopyResult{}, ClassifyError(err)
+	}
+
+	rowsCopied, err := result.RowsAffected()
+	if err != nil {
+		rowsCopied = sent
+	}
+
+	return CopyResult{RowsCopied: rowsCopied}, nil
+}
+
+// copyInStatement returns the COPY FROM STDIN statement for the optionally schema-qualified table.
+func copyInStatement(table string, columns Columns) string {
+	names := make([]string, len(columns))
+	for i := range columns {
+		names[i] = columns[i].String()
+	}
+
+	if schema, name, ok := strings.Cut(table, "."); ok {
+		return pq.CopyInSchema(schema, name, names...)
+	}
+	return pq.CopyIn(table, names...)
+}
+
+// validateCopyColumns checks that the column list is not empty and has no duplicate or empty columns.
+func validateCopyColumns(columns Columns) error {
+	if len(columns) < 1 {
+		return errors.New("columns are empty")
+	}
+
+	seen := make(map[Column]bool, len(columns))
+	for _, column := range columns {
+		if column == "" {
+			return errors.New("column is empty")
+		}
+		if seen[column] {
+			return fmt.Errorf("duplicate column %s", column)
+		}
+		seen[column] = true
+	}
+
+	return nil
+}
+
+// validateCopyRow checks that the row has exactly the given columns, so no value is silently dropped
+// or defaulted.
+func validateCopyRow(columns Columns, mappedRow MappedRow) error {
+	for _, column := range columns {
+		if !mappedRow.HasColumn(column) {
+			return fmt.Errorf("missing column %s", column)
+		}
+	}
+
+	if len(mappedRow) != len(columns) {
+		for column := range mappedRow {
+			if !columns.HasColumn(column) {
+				return fmt.Errorf("unknown column %s", column)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,138 @@
+package dbsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type copyCustomer struct {
+	firstName string
+	lastName  string
+}
+
+func (c copyCustomer) MappedRow() MappedRow {
+	return MappedRow{"first_name": c.firstName, "last_name": c.lastName}
+}
+
+func TestCopyFrom(t *testing.T) {
+	t.Parallel()
+
+	columns := Columns{"first_name", "last_name"}
+
+	// copyDriver makes the flushing exec, which has no arguments, report the rows sent so far.
+	copyDriver := func(t *testing.T) (DBPreparerExecutor, *fakeDriver) {
+		sqlDB, fd := NewFakeDB(t)
+		sent := int64(0)
+		fd.ExecFunc = func(query string, args []any) (driver.Result, error) {
+			if len(args) < 1 {
+				return driver.RowsAffected(sent), nil
+			}
+			sent++
+			return driver.RowsAffected(0), nil
+		}
+		return sqlDB, fd
+	}
+
+	tests := []struct {
+		desc      string
+		assertion func(*testing.T, string)
+	}{
+		{
+			desc: "MappedRows are copied in a transaction",
+			assertion: func(t *testing.T, desc string) {
+				db, fd := copyDriver(t)
+
+				result, err := CopyFrom(context.Background(), db, "billing.customers", columns, MappedRows{
+					{"first_name": "John", "last_name": "Doe"},
+					{"first_name": "Jane", "last_name": "Roe"},
+				})
+				require.NoError(t, err, desc)
+				require.Equal(t, int64(2), result.RowsCopied, desc)
+				require.Equal(t, []string{`COPY "billing"."customers" ("first_name", "last_name") FROM STDIN`}, fd.Prepared, desc)
+				require.Equal(t, []any{"Jane", "Roe"}, fd.Execs[1].Args, desc)
+				require.Equal(t, 3, fd.ExecCount(), desc)
+				require.Equal(t, 1, fd.Commits, desc)
+			},
+		},
+		{
+			desc: "Rows received from a channel are copied until it is closed",
+			assertion: func(t *testing.T, desc string) {
+				db, _ := copyDriver(t)
+
+				mappedRows := make(chan MappedRow)
+				go func() {
+					defer close(mappedRows)
+					for _, name := range []string{"John", "Jane", "Jim"} {
+						mappedRows <- MappedRow{"first_name": name, "last_name": "Doe"}
+					}
+				}()
+
+				result, err := CopyFromChannel(context.Background(), db, "customers", columns, mappedRows)
+				require.NoError(t, err, desc)
+				require.Equal(t, int64(3), result.RowsCopied, desc)
+			},
+		},
+		{
+			desc: "An invalid row received from a channel rolls the copy back",
+			assertion: func(t *testing.T, desc string) {
+				db, fd := copyDriver(t)
+
+				mappedRows := make(chan MappedRow, 2)
+				mappedRows <- MappedRow{"first_name": "John", "last_name": "Doe"}
+				mappedRows <- MappedRow{"first_name": "Jane"}
+				close(mappedRows)
+
+				_, err := CopyFromChannel(context.Background(), db, "customers", columns, mappedRows)
+				require.EqualError(t, err, "row 1: missing column last_name", desc)
+				require.Equal(t, 1, fd.Rollbacks, desc)
+			},
+		},
+		{
+			desc: "Structs are converted with their MappedRow method",
+			assertion: func(t *testing.T, desc string) {
+				db, fd := copyDriver(t)
+
+				result, err := CopyFromStructs(context.Background(), db, "customers", columns, []copyCustomer{
+					{firstName: "John", lastName: "Doe"},
+				})
+				require.NoError(t, err, desc)
+				require.Equal(t, int64(1), result.RowsCopied, desc)
+				require.Equal(t, []any{"John", "Doe"}, fd.Execs[0].Args, desc)
+			},
+		},
+		{
+			desc: "Rows are validated against the columns before anything is sent",
+			assertion: func(t *testing.T, desc string) {
+				db, fd := copyDriver(t)
+
+				_, err := CopyFrom(context.Background(), db, "customers", columns, MappedRows{
+					{"first_name": "John", "last_name": "Doe"},
+					{"first_name": "Jane", "last_name": "Roe", "email_address": "jane@example.com"},
+				})
+				require.EqualError(t, err, "row 1: unknown column email_address", desc)
+				require.Equal(t, 0, fd.Begins, desc)
+				require.Equal(t, 0, fd.ExecCount(), desc)
+			},
+		},
+		{
+			desc: "Duplicate columns are rejected",
+			assertion: func(t *testing.T, desc string) {
+				db, _ := copyDriver(t)
+
+				_, err := CopyFrom(context.Background(), db, "customers", Columns{"first_name", "first_name"}, nil)
+				require.EqualError(t, err, "duplicate column first_name", desc)
+			},
+		},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			tc.assertion(t, tc.desc)
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package dbsql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/neumachen/dbsql/internal"
+)
+
+// cursorSequence numbers the cursors declared by DeclareCursor so their names are unique.
+var cursorSequence atomic.Uint64
+
+// Cursor is a server-side cursor fetching the rows of a query in pages of a fixed size, so only one
+// page is held in memory at a time. A Cursor lives inside the transaction it was declared in and is not
+// safe for concurrent use.
+type Cursor struct {
+	tx        DBPreparerExecutor
+	name      string
+	fetchSize int
+	fetch     PreparedStatement
+	done      bool
+	closed    bool
+}
+
+// DeclareCursor declares a cursor for the prepared statement, which must be a SELECT or VALUES query, in
+// the transaction tx. The cursor fetches fetchSize rows at a time.
+//
+// Example:
+//
+//	err := dbsql.WithTransaction(ctx, db, nil, func(ctx context.Context, tx dbsql.DBPreparerExecutor) error {
+//		cursor, err := dbsql.DeclareCursor(ctx, tx, selectAddresses, 1000)
+//		if err != nil {
+//			return err
+//		}
+//		defer cursor.Close(ctx)
+//
+//		for !cursor.Done() {
+//			mappedRows, err := cursor.Fetch(ctx)
+//			// process the page
+//		}
+//		return nil
+//	})
+func DeclareCursor(
+	ctx context.Context,
+	tx DBPreparerExecutor,
+	preparedStatement PreparedStatement,
+	fetchSize int,
+	binderFuncs ...BindParameterValueFunc,
+) (
+	*Cursor,
+	error,
+) {
+	if internal.IsNil(tx) {
+		return nil, errors.New("db connection is nil")
+	}
+
+	if internal.IsNil(preparedStatement) {
+		return nil, errors.New("prepared statement is nil")
+	}
+
+	if !inTransaction(tx) {
+		return nil, errors.New("cursor requires a transaction")
+	}
+
+	if fetchSize < 1 {
+		return nil, errors.New("fetch size must be positive")
+	}
+
+	name := "dbsql_cursor_" + strconv.FormatUint(cursorSequence.Add(1), 10)
+
+	var opts []PrepareStatementOption
+	if statementName(preparedStatement) != "" {
+		opts = append(opts, StatementName(statementName(preparedStatement)))
+	}
+
+	declare, err := PrepareStatement(
+		fmt.Sprintf("DECLARE %s NO SCROLL CURSOR FOR %s", name, preparedStatement.UnpreparedStatement()),
+		opts...,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Carry over the values bound to the statement before the call, as the package functions do.
+	for parameter, value := range BoundNamedParameterValues(preparedStatement) {
+		if err := declare.BindParameterValue(parameter, value); err != nil {
+			return nil, err
+		}
+	}
+	preparedStatement.ResetParametersValues()
+
+	if _, err := ExecContext(ctx, tx, declare, binderFuncs...); err != nil {
+		return nil, err
+	}
+
+	fetch, err := PrepareStatement(fmt.Sprintf("FETCH FORWARD %d FROM %s", fetchSize, name))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Cursor{
+		tx:        tx,
+		name:      name,
+		fetchSize: fetchSize,
+		fetch:     fetch,
+	}, nil
+}
+
+// Name returns the name of the cursor.
+func (c *Cursor) Name() string {
+	return c.name
+}
+
+// Fetch returns the next page of rows. The last page has fewer rows than the fetch size, possibly none,
+// after which Done returns true.
+func (c *Cursor) Fetch(ctx context.Context) (MappedRows, error) {
+	if c.closed {
+		return nil, errors.New("cursor is closed")
+	}
+
+	if c.done {
+		return MappedRows{}, nil
+	}
+
+	rows, err := QueryContext(ctx, c.tx, c.fetch)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	mappedRows, err := MapRows(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	c.done = len(mappedRows) < c.fetchSize
+
+	return mappedRows, nil
+}
+
+// Done returns true once the last page has been fetched.
+func (c *Cursor) Done() bool {
+	return c.done
+}
+
+// Close closes the cursor. Cursors are also closed when their transaction ends, so Close is only needed
+// to release the cursor early. It is safe to call Close more than once.
+func (c *Cursor) Close(ctx context.Context) error {
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+
+	if _, err := c.tx.ExecContext(internal.InitIfNilContext(ctx), "CLOSE "+c.name); err != nil {
+		return ClassifyError(err)
+	}
+
+	return nil
+}
+
+// QueryCursor streams the rows of the prepared statement through a server-side cursor, calling pageFunc
+// with every page of at most fetchSize rows. Unless dbPrepExec already is a transaction, the cursor is
+// declared in a read-only transaction started by QueryCursor. The iteration stops at the first error
+// returned by pageFunc, which is returned as is.
+//
+// Example:
+//
+//	err := dbsql.QueryCursor(ctx, db, selectAddresses, 1000, func(mappedRows dbsql.MappedRows) error {
+//		return exportAddresses(mappedRows)
+//	})
+func QueryCursor(
+	ctx context.Context,
+	dbPrepExec DBPreparerExecutor,
+	preparedStatement PreparedStatement,
+	fetchSize int,
+	pageFunc func(mappedRows MappedRows) error,
+	binderFuncs ...BindParameterValueFunc,
+) error {
+	if pageFunc == nil {
+		return errors.New("page func is nil")
+	}
+
+	if internal.IsNil(dbPrepExec) {
+		return errors.New("db connection is nil")
+	}
+
+	ctx = internal.InitIfNilContext(ctx)
+
+	scan := func(ctx context.Context, tx DBPreparerExecutor) error {
+		cursor, err := DeclareCursor(ctx, tx, preparedStatement, fetchSize, binderFuncs...)
+		if err != nil {
+			return err
+		}
+		defer cursor.Close(ctx)
+
+		for !cursor.Done() {
+			mappedRows, err := cursor.Fetch(ctx)
+			if err != nil {
+				return err
+			}
+			if len(mappedRows) < 1 {
+				break
+			}
+			if err := pageFunc(mappedRows); err != nil {
+				return err
+			}
+		}
+
+		return cursor.Close(ctx)
+	}
+
+	if inTransaction(dbPrepExec) {
+		return scan(ctx, dbPrepExec)
+	}
+
+	return WithTransaction(ctx, dbPrepExec, &sql.TxOptions{ReadOnly: true}, scan)
+}
@@ -0,0 +1,118 @@
+package dbsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryCursor(t *testing.T) {
+	t.Parallel()
+
+	// cursorDriver serves the addresses FETCH by FETCH, fetchSize rows at a time.
+	cursorDriver := func(t *testing.T, total, fetchSize int) (DBPreparerExecutor, *fakeDriver) {
+		sqlDB, fd := NewFakeDB(t)
+		served := 0
+		fd.QueryFunc = func(query string, args []any) (driver.Rows, error) {
+			var values [][]driver.Value
+			for i := 0; i < fetchSize && served < total; i++ {
+				served++
+				values = append(values, []driver.Value{int64(served)})
+			}
+			return newFakeRows([]string{"address_id"}, values...), nil
+		}
+		return sqlDB, fd
+	}
+
+	tests := []struct {
+		desc      string
+		assertion func(*testing.T, string)
+	}{
+		{
+			desc: "The rows are fetched in pages inside a transaction",
+			assertion: func(t *testing.T, desc string) {
+				db, fd := cursorDriver(t, 5, 2)
+
+				preparedStatement, err := PrepareStatement("SELECT address_id FROM addresses WHERE country = @country")
+				require.NoError(t, err, desc)
+
+				var pages []int
+				err = QueryCursor(context.Background(), db, preparedStatement, 2, func(mappedRows MappedRows) error {
+					pages = append(pages, len(mappedRows))
+					return nil
+				}, BindParameterValue("country", "NL"))
+				require.NoError(t, err, desc)
+				require.Equal(t, []int{2, 2, 1}, pages, desc)
+				require.Equal(t, 1, fd.Begins, desc)
+				require.Equal(t, 1, fd.Commits, desc)
+
+				require.Equal(t, 3, fd.QueryCount(), desc)
+				require.True(t, strings.HasPrefix(fd.LastQuery().Query, "FETCH FORWARD 2 FROM dbsql_cursor_"), desc)
+
+				require.Len(t, fd.Execs, 2, desc)
+				require.True(t, strings.HasPrefix(fd.Execs[0].Query, "DECLARE dbsql_cursor_"), desc)
+				require.True(t, strings.HasSuffix(fd.Execs[0].Query, "NO SCROLL CURSOR FOR SELECT address_id FROM addresses WHERE country = $1"), desc)
+				require.Equal(t, []any{"NL"}, fd.Execs[0].Args, desc)
+				require.True(t, strings.HasPrefix(fd.Execs[1].Query, "CLOSE dbsql_cursor_"), desc)
+			},
+		},
+		{
+			desc: "An empty last page is not passed to the func",
+			assertion: func(t *testing.T, desc string) {
+				db, _ := cursorDriver(t, 4, 2)
+
+				preparedStatement, err := PrepareStatement("SELECT address_id FROM addresses")
+				require.NoError(t, err, desc)
+
+				pages := 0
+				err = QueryCursor(context.Background(), db, preparedStatement, 2, func(MappedRows) error {
+					pages++
+					return nil
+				})
+				require.NoError(t, err, desc)
+				require.Equal(t, 2, pages, desc)
+			},
+		},
+		{
+			desc: "An error returned by the func rolls the transaction back",
+			assertion: func(t *testing.T, desc string) {
+				db, fd := cursorDriver(t, 5, 2)
+
+				preparedStatement, err := PrepareStatement("SELECT address_id FROM addresses")
+				require.NoError(t, err, desc)
+
+				expectedErr := errors.New("mock error")
+				err = QueryCursor(context.Background(), db, preparedStatement, 2, func(MappedRows) error {
+					return expectedErr
+				})
+				require.Equal(t, expectedErr, err, desc)
+				require.Equal(t, 1, fd.Rollbacks, desc)
+				require.Equal(t, 1, fd.QueryCount(), desc)
+			},
+		},
+		{
+			desc: "DeclareCursor requires a transaction",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, _ := NewFakeDB(t)
+
+				preparedStatement, err := PrepareStatement("SELECT address_id FROM addresses")
+				require.NoError(t, err, desc)
+
+				_, err = DeclareCursor(context.Background(), sqlDB, preparedStatement, 10)
+				require.EqualError(t, err, "cursor requires a transaction", desc)
+			},
+		},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			tc.assertion(t, tc.desc)
+		})
+	}
+}
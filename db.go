@@ -65,6 +65,29 @@ type DBPreparerExecutor interface {
 	DBExecutor
 }
 
+// DBTxBeginner defines an interface for starting transactions. It mirrors database/sql.DB.BeginTx.
+type DBTxBeginner interface {
+	// BeginTx starts a transaction with the given options.
+	// It accepts a context.Context for cancellation and timeout control.
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// DBConnector defines an interface for reserving a single connection from a pool. It mirrors
+// database/sql.DB.Conn.
+type DBConnector interface {
+	// Conn returns a connection reserved for the caller until it is closed.
+	// It accepts a context.Context for cancellation and timeout control.
+	Conn(ctx context.Context) (*sql.Conn, error)
+}
+
+// DBTransactor defines an interface for handles that run transactions themselves rather than exposing
+// BeginTx, typically wrappers that need to observe the transaction or wrap the handle given to the TxFunc.
+// WithTransaction delegates to RunInTx when the handle implements it.
+type DBTransactor interface {
+	// RunInTx runs txFunc inside a transaction, committing it if txFunc returns nil and rolling it back otherwise.
+	RunInTx(ctx context.Context, opts *sql.TxOptions, txFunc TxFunc) error
+}
+
 type DBCloser interface {
 	// Close closes the database, releasing any open resources.
 	Close() error
@@ -76,6 +99,15 @@ type DBPinger interface {
 	Ping() error
 }
 
+// DBContextPinger defines an interface for verifying a connection under a context. It mirrors
+// database/sql.DB.PingContext.
+type DBContextPinger interface {
+	// PingContext verifies a connection to the database is still alive,
+	// establishing a connection if necessary.
+	// It accepts a context.Context for cancellation and timeout control.
+	PingContext(ctx context.Context) error
+}
+
 // DB ...
 type DB interface {
 	DBExecutor
@@ -56,8 +56,9 @@ func ExecContext(
 		preparedStatement.ResetParametersValues()
 	}()
 
-	prepStmnt, err := dbPrepare(
+	callResult, err := dbCall(
 		ctx,
+		OperationExec,
 		dbPrepExec,
 		preparedStatement,
 		binderFuncs...,
@@ -66,8 +67,5 @@ func ExecContext(
 		return nil, err
 	}
 
-	return prepStmnt.ExecContext(
-		ctx,
-		preparedStatement.BoundParameterValues()...,
-	)
+	return callResult.Result, nil
 }
@@ -0,0 +1,334 @@
+package dbsql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/neumachen/dbsql/internal"
+)
+
+// ErrBatchRolledBack is matched by the error of a batch item whose transaction was rolled back or never
+// committed because another item, the prepare or the commit failed.
+var ErrBatchRolledBack = errors.New("batch item rolled back")
+
+// BatchItemResult is the outcome of a single bind set executed by ExecBatch.
+type BatchItemResult struct {
+	// Result is the result of the item's execution. It is nil if the item failed or was not executed.
+	Result sql.Result
+	// Err is the error of the item, if any.
+	Err error
+}
+
+// BatchResults holds the outcome of every bind set executed by ExecBatch, in the order of the bind sets.
+type BatchResults []BatchItemResult
+
+// Failed returns the indexes of the items that failed or were rolled back.
+func (b BatchResults) Failed() []int {
+	var failed []int
+	for i := range b {
+		if b[i].Err != nil {
+			failed = append(failed, i)
+		}
+	}
+	return failed
+}
+
+// RowsAffected returns the total number of rows affected by the items that succeeded.
+func (b BatchResults) RowsAffected() int64 {
+	var total int64
+	for i := range b {
+		if b[i].Err != nil || b[i].Result == nil {
+			continue
+		}
+		if rowsAffected, err := b[i].Result.RowsAffected(); err == nil {
+			total += rowsAffected
+		}
+	}
+	return total
+}
+
+// BatchItemError is the error of a single batch item.
+type BatchItemError struct {
+	// Index is the index of the item's bind set.
+	Index int
+	// Err is the error of the item.
+	Err error
+}
+
+// BatchError is returned by ExecBatch when at least one item failed. It lists the failed items in order.
+type BatchError struct {
+	// Total is the number of items in the batch.
+	Total int
+	// Items are the errors of the failed items.
+	Items []BatchItemError
+}
+
+// maxBatchErrorsInMessage caps the number of item errors included in BatchError.Error.
+const maxBatchErrorsInMessage = 5
+
+// Error summarizes the failed items.
+func (b *BatchError) Error() string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "%d of %d batch items failed", len(b.Items), b.Total)
+	for i, item := range b.Items {
+		if i == maxBatchErrorsInMessage {
+			fmt.Fprintf(&builder, "; and %d more", len(b.Items)-i)
+			break
+		}
+		fmt.Fprintf(&builder, "; item %d: %v", item.Index, item.Err)
+	}
+	return builder.String()
+}
+
+// Unwrap returns the errors of the failed items.
+func (b *BatchError) Unwrap() []error {
+	errs := make([]error, len(b.Items))
+	for i := range b.Items {
+		errs[i] = b.Items[i].Err
+	}
+	return errs
+}
+
+// Indexes returns the indexes of the failed items.
+func (b *BatchError) Indexes() []int {
+	indexes := make([]int, len(b.Items))
+	for i := range b.Items {
+		indexes[i] = b.Items[i].Index
+	}
+	return indexes
+}
+
+// BatchOption configures ExecBatch.
+type BatchOption func(config *batchConfig)
+
+// batchConfig holds the configuration of ExecBatch.
+type batchConfig struct {
+	chunkSize  int
+	savepoints bool
+	txOptions  *sql.TxOptions
+}
+
+// BatchChunkSize commits the batch in transactions of at most size items instead of a single transaction.
+// A failure only rolls back the chunk it happened in; the following chunks are still executed.
+func BatchChunkSize(size int) BatchOption {
+	return func(config *batchConfig) {
+		config.chunkSize = size
+	}
+}
+
+// BatchSavepoints runs every item inside a savepoint, so a failing item is rolled back on its own
+// instead of rolling back the whole chunk. It costs two extra round trips per item.
+func BatchSavepoints() BatchOption {
+	return func(config *batchConfig) {
+		config.savepoints = true
+	}
+}
+
+// BatchTxOptions sets the options of the transactions started by ExecBatch.
+func BatchTxOptions(opts *sql.TxOptions) BatchOption {
+	return func(config *batchConfig) {
+		config.txOptions = opts
+	}
+}
+
+// batchSavepoint is the name of the savepoint used by BatchSavepoints.
+const batchSavepoint = "dbsql_batch_item"
+
+// ExecBatch executes the prepared statement once for every bind set. The statement is prepared once per
+// transaction and, by default, every bind set is executed inside a single transaction; see
+// BatchChunkSize and BatchSavepoints to change how failures are contained.
+//
+// The returned BatchResults always has one entry per bind set. If any item failed, the error is a
+// *BatchError listing the failed indexes. If dbPrepExec is already a transaction, the items are executed
+// in it and chunking is ignored.
+//
+// Each item passes through the interceptor chain of dbPrepExec, if any, as an OperationExec call.
+//
+// Example:
+//
+//	bindSets := make([][]dbsql.BindParameterValueFunc, len(emailAddresses))
+//	for i, emailAddress := range emailAddresses {
+//		bindSets[i] = []dbsql.BindParameterValueFunc{
+//			dbsql.BindParameterValue("customer_id", customerID),
+//			dbsql.BindParameterValue("email_address", emailAddress),
+//		}
+//	}
+//	results, err := dbsql.ExecBatch(ctx, db, insertEmailAddress, bindSets, dbsql.BatchChunkSize(500))
+func ExecBatch(
+	ctx context.Context,
+	dbPrepExec DBPreparerExecutor,
+	preparedStatement PreparedStatement,
+	bindSets [][]BindParameterValueFunc,
+	opts ...BatchOption,
+) (
+	BatchResults,
+	error,
+) {
+	if internal.IsNil(dbPrepExec) {
+		return nil, errors.New("db connection is nil")
+	}
+
+	if internal.IsNil(preparedStatement) {
+		return nil, errors.New("prepared statement is nil")
+	}
+
+	ctx = internal.InitIfNilContext(ctx)
+
+	config := &batchConfig{}
+	for i := range opts {
+		opts[i](config)
+	}
+
+	defer func() {
+		preparedStatement.ResetParametersValues()
+	}()
+
+	results := make(BatchResults, len(bindSets))
+	batch := &batchExecution{
+		preparedStatement: preparedStatement,
+		bindSets:          bindSets,
+		results:           results,
+		savepoints:        config.savepoints,
+	}
+
+	if inTransaction(dbPrepExec) {
+		if err := batch.run(ctx, dbPrepExec, 0, len(bindSets)); err != nil {
+			batch.rollBack(0, len(bindSets), err)
+		}
+		return results, results.err()
+	}
+
+	chunkSize := config.chunkSize
+	if chunkSize <= 0 || chunkSize > len(bindSets) {
+		chunkSize = len(bindSets)
+	}
+
+	for start := 0; start < len(bindSets); start += chunkSize {
+		end := min(start+chunkSize, len(bindSets))
+
+		if err := ctx.Err(); err != nil {
+			batch.rollBack(start, len(bindSets), err)
+			break
+		}
+
+		err := WithTransaction(ctx, dbPrepExec, config.txOptions, func(ctx context.Context, tx DBPreparerExecutor) error {
+			return batch.run(ctx, tx, start, end)
+		})
+		if err != nil {
+			batch.rollBack(start, end, err)
+		}
+	}
+
+	return results, results.err()
+}
+
+// err returns a *BatchError for the failed items, or nil if every item succeeded.
+func (b BatchResults) err() error {
+	batchErr := &BatchError{Total: len(b)}
+	for i := range b {
+		if b[i].Err != nil {
+			batchErr.Items = append(batchErr.Items, BatchItemError{Index: i, Err: b[i].Err})
+		}
+	}
+	if len(batchErr.Items) < 1 {
+		return nil
+	}
+	return batchErr
+}
+
+// batchExecution holds the state of a single ExecBatch call.
+type batchExecution struct {
+	preparedStatement PreparedStatement
+	bindSets          [][]BindParameterValueFunc
+	results           BatchResults
+	savepoints        bool
+}
+
+// run prepares the statement on tx and executes the bind sets from start to end. Without savepoints it
+// stops at the first failing item.
+func (b *batchExecution) run(ctx context.Context, tx DBPreparerExecutor, start, end int) error {
+	prepStmnt, err := dbPrepare(ctx, tx, b.preparedStatement.Revised())
+	if err != nil {
+		return ClassifyError(err)
+	}
+	defer prepStmnt.Close()
+
+	for i := start; i < end; i++ {
+		result, err := b.execItem(ctx, tx, prepStmnt, b.bindSets[i])
+		b.results[i] = BatchItemResult{Result: result, Err: err}
+		if err != nil && !b.savepoints {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// execItem binds a single bind set and executes the prepared statement through the interceptor chain.
+func (b *batchExecution) execItem(
+	ctx context.Context,
+	tx DBPreparerExecutor,
+	prepStmnt *sql.Stmt,
+	binderFuncs []BindParameterValueFunc,
+) (
+	sql.Result,
+	error,
+) {
+	b.preparedStatement.ResetParametersValues()
+	if err := b.preparedStatement.BindParameterValues(binderFuncs...); err != nil {
+		return nil, err
+	}
+
+	if b.savepoints {
+		if _, err := tx.ExecContext(ctx, "SAVEPOINT "+batchSavepoint); err != nil {
+			return nil, ClassifyError(err)
+		}
+	}
+
+	call := &Call{
+		Operation:         OperationExec,
+		DB:                tx,
+		PreparedStatement: b.preparedStatement,
+		Query:             b.preparedStatement.Revised(),
+	}
+	callResult, err := interceptCall(ctx, tx, call, func(ctx context.Context, call *Call) (*CallResult, error) {
+		if call.Comment != "" || call.Query != call.PreparedStatement.Revised() {
+			return executeCall(ctx, call)
+		}
+		result, err := prepStmnt.ExecContext(ctx, call.PreparedStatement.BoundParameterValues()...)
+		if err != nil {
+			return nil, ClassifyError(err)
+		}
+		return &CallResult{Result: result}, nil
+	})
+
+	if b.savepoints {
+		savepointStatement := "RELEASE SAVEPOINT " + batchSavepoint
+		if err != nil {
+			savepointStatement = "ROLLBACK TO SAVEPOINT " + batchSavepoint
+		}
+		if _, savepointErr := tx.ExecContext(ctx, savepointStatement); savepointErr != nil {
+			return nil, errors.Join(err, ClassifyError(savepointErr))
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	if callResult == nil {
+		return nil, nil
+	}
+	return callResult.Result, nil
+}
+
+// rollBack marks the items from start to end that did not fail on their own as rolled back because of err.
+func (b *batchExecution) rollBack(start, end int, err error) {
+	for i := start; i < end; i++ {
+		if b.results[i].Err == nil {
+			b.results[i] = BatchItemResult{Err: fmt.Errorf("%w: %w", ErrBatchRolledBack, err)}
+		}
+	}
+}
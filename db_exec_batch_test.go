@@ -0,0 +1,189 @@
+package dbsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecBatch(t *testing.T) {
+	t.Parallel()
+
+	const query = "INSERT INTO customers (customer_id) VALUES (@customer_id)"
+
+	bindSets := func(customerIDs ...int) [][]BindParameterValueFunc {
+		sets := make([][]BindParameterValueFunc, len(customerIDs))
+		for i, customerID := range customerIDs {
+			sets[i] = []BindParameterValueFunc{BindParameterValue("customer_id", customerID)}
+		}
+		return sets
+	}
+
+	failCustomerID := func(customerID int) func(string, []any) (driver.Result, error) {
+		return func(query string, args []any) (driver.Result, error) {
+			if len(args) == 1 && args[0] == customerID {
+				return nil, errors.New("mock error")
+			}
+			return driver.RowsAffected(1), nil
+		}
+	}
+
+	tests := []struct {
+		desc      string
+		assertion func(*testing.T, string)
+	}{
+		{
+			desc: "Every bind set is executed in a single transaction with one prepare",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fd := NewFakeDB(t)
+
+				preparedStatement, err := PrepareStatement(query)
+				require.NoError(t, err, desc)
+
+				results, err := ExecBatch(context.Background(), sqlDB, preparedStatement, bindSets(1, 2, 3))
+				require.NoError(t, err, desc)
+				require.Len(t, results, 3, desc)
+				require.Empty(t, results.Failed(), desc)
+				require.Equal(t, int64(3), results.RowsAffected(), desc)
+				require.Equal(t, 1, fd.Begins, desc)
+				require.Equal(t, 1, fd.Commits, desc)
+				require.Len(t, fd.Prepared, 1, desc)
+				require.Equal(t, []any{3}, fd.LastExec().Args, desc)
+			},
+		},
+		{
+			desc: "A failing item rolls back its transaction and is reported by index",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fd := NewFakeDB(t)
+				fd.ExecFunc = failCustomerID(2)
+
+				preparedStatement, err := PrepareStatement(query)
+				require.NoError(t, err, desc)
+
+				results, err := ExecBatch(context.Background(), sqlDB, preparedStatement, bindSets(1, 2, 3))
+				var batchErr *BatchError
+				require.ErrorAs(t, err, &batchErr, desc)
+				require.Equal(t, []int{0, 1, 2}, batchErr.Indexes(), desc)
+				require.ErrorIs(t, results[0].Err, ErrBatchRolledBack, desc)
+				require.NotErrorIs(t, results[1].Err, ErrBatchRolledBack, desc)
+				require.ErrorIs(t, results[2].Err, ErrBatchRolledBack, desc)
+				require.Equal(t, 2, fd.ExecCount(), desc)
+				require.Equal(t, 0, fd.Commits, desc)
+				require.Equal(t, 1, fd.Rollbacks, desc)
+			},
+		},
+		{
+			desc: "Chunks are committed independently",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fd := NewFakeDB(t)
+				fd.ExecFunc = failCustomerID(3)
+
+				preparedStatement, err := PrepareStatement(query)
+				require.NoError(t, err, desc)
+
+				results, err := ExecBatch(context.Background(), sqlDB, preparedStatement, bindSets(1, 2, 3, 4, 5), BatchChunkSize(2))
+				require.Error(t, err, desc)
+				require.Equal(t, []int{2, 3}, results.Failed(), desc)
+				require.Equal(t, int64(3), results.RowsAffected(), desc)
+				require.Equal(t, 3, fd.Begins, desc)
+				require.Equal(t, 2, fd.Commits, desc)
+				require.Equal(t, 1, fd.Rollbacks, desc)
+				require.Contains(t, err.Error(), "2 of 5 batch items failed", desc)
+			},
+		},
+		{
+			desc: "Savepoints roll back a failing item on its own",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fd := NewFakeDB(t)
+				fd.ExecFunc = failCustomerID(2)
+
+				preparedStatement, err := PrepareStatement(query)
+				require.NoError(t, err, desc)
+
+				results, err := ExecBatch(context.Background(), sqlDB, preparedStatement, bindSets(1, 2, 3), BatchSavepoints())
+				var batchErr *BatchError
+				require.ErrorAs(t, err, &batchErr, desc)
+				require.Equal(t, []int{1}, batchErr.Indexes(), desc)
+				require.Equal(t, int64(2), results.RowsAffected(), desc)
+				require.Equal(t, 1, fd.Commits, desc)
+
+				var savepoints []string
+				for _, exec := range fd.Execs {
+					if strings.Contains(exec.Query, batchSavepoint) {
+						savepoints = append(savepoints, strings.TrimSuffix(exec.Query, " "+batchSavepoint))
+					}
+				}
+				require.Equal(
+					t,
+					[]string{
+						"SAVEPOINT", "RELEASE SAVEPOINT",
+						"SAVEPOINT", "ROLLBACK TO SAVEPOINT",
+						"SAVEPOINT", "RELEASE SAVEPOINT",
+					},
+					savepoints,
+					desc,
+				)
+			},
+		},
+		{
+			desc: "Items pass through the interceptor chain",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fd := NewFakeDB(t)
+
+				intercepted := 0
+				db := WithInterceptors(sqlDB, func(ctx context.Context, call *Call, next CallHandler) (*CallResult, error) {
+					intercepted++
+					require.Equal(t, OperationExec, call.Operation, desc)
+					return next(ctx, call)
+				})
+
+				preparedStatement, err := PrepareStatement(query)
+				require.NoError(t, err, desc)
+
+				_, err = ExecBatch(context.Background(), db, preparedStatement, bindSets(1, 2))
+				require.NoError(t, err, desc)
+				require.Equal(t, 2, intercepted, desc)
+				require.Len(t, fd.Prepared, 1, desc)
+			},
+		},
+		{
+			desc: "A binding error is reported for its item",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, _ := NewFakeDB(t)
+
+				preparedStatement, err := PrepareStatement(query)
+				require.NoError(t, err, desc)
+
+				sets := bindSets(1)
+				sets = append(sets, []BindParameterValueFunc{func(PreparedStatement) error {
+					return errors.New("mock error")
+				}})
+				results, err := ExecBatch(context.Background(), sqlDB, preparedStatement, sets, BatchSavepoints())
+				require.Error(t, err, desc)
+				require.Equal(t, []int{1}, results.Failed(), desc)
+			},
+		},
+		{
+			desc: "ExecBatch fails if the db connection is nil",
+			assertion: func(t *testing.T, desc string) {
+				preparedStatement, err := PrepareStatement(query)
+				require.NoError(t, err, desc)
+
+				_, err = ExecBatch(context.Background(), nil, preparedStatement, bindSets(1))
+				require.EqualError(t, err, "db connection is nil", desc)
+			},
+		},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			tc.assertion(t, tc.desc)
+		})
+	}
+}
@@ -4,20 +4,24 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 
 	"github.com/neumachen/dbsql/internal"
 )
 
-func dbPrepare(
+// dbCall binds the parameter values to the prepared statement and runs the call through the
+// interceptor chain of dbPrepExec, if any, before preparing and executing it.
+func dbCall(
 	ctx context.Context,
-	dbPrep DBPreparer,
+	operation Operation,
+	dbPrepExec DBPreparerExecutor,
 	preparedStatement PreparedStatement,
 	binderFuncs ...BindParameterValueFunc,
 ) (
-	*sql.Stmt,
+	*CallResult,
 	error,
 ) {
-	if internal.IsNil(dbPrep) {
+	if internal.IsNil(dbPrepExec) {
 		return nil, errors.New("db connection is nil")
 	}
 
@@ -27,18 +31,130 @@ func dbPrepare(
 
 	ctx = internal.InitIfNilContext(ctx)
 
-	prepared, err := dbPrep.PrepareContext(ctx, preparedStatement.Revised())
+	if bindValuesGiven(binderFuncs) {
+		if err := preparedStatement.BindParameterValues(binderFuncs...); err != nil {
+			return nil, err
+		}
+	}
+
+	call := &Call{
+		Operation:         operation,
+		DB:                dbPrepExec,
+		PreparedStatement: preparedStatement,
+		Query:             preparedStatement.Revised(),
+	}
+
+	callResult, err := interceptCall(ctx, dbPrepExec, call, executeCall)
 	if err != nil {
 		return nil, err
 	}
 
-	if bindValuesGiven(binderFuncs) {
-		if err := preparedStatement.BindParameterValues(binderFuncs...); err != nil {
-			return nil, err
+	if callResult == nil {
+		// An interceptor short-circuited the call without producing a result.
+		return &CallResult{}, nil
+	}
+
+	return callResult, nil
+}
+
+// executeCall is the final CallHandler of every interceptor chain. It prepares the call's query and
+// executes it with the bound parameter values. Calls with a comment are executed without preparing them.
+// Errors are classified with ClassifyError.
+func executeCall(ctx context.Context, call *Call) (*CallResult, error) {
+	if call.Comment != "" {
+		return executeCommentedCall(ctx, call)
+	}
+
+	prepStmnt, err := dbPrepare(ctx, call.DB, call.Query)
+	if err != nil {
+		return nil, ClassifyError(err)
+	}
+
+	args := call.PreparedStatement.BoundParameterValues()
+
+	switch call.Operation {
+	case OperationExec:
+		result, err := prepStmnt.ExecContext(ctx, args...)
+		if err != nil {
+			return nil, ClassifyError(err)
+		}
+		return &CallResult{Result: result}, nil
+	case OperationQuery:
+		rows, err := prepStmnt.QueryContext(ctx, args...)
+		if err != nil {
+			return nil, ClassifyError(err)
+		}
+		return &CallResult{Rows: rows}, nil
+	case OperationQueryRow:
+		return &CallResult{Row: prepStmnt.QueryRowContext(ctx, args...)}, nil
+	case OperationQueryRows:
+		return mapCallRows(prepStmnt.QueryContext(ctx, args...))
+	default:
+		return nil, fmt.Errorf("unsupported operation %q", call.Operation)
+	}
+}
+
+// executeCommentedCall appends the call's comment to its query and executes it directly on the handle.
+// Drivers send such queries as unnamed statements, so no server-side prepared statement is created
+// for each distinct comment.
+func executeCommentedCall(ctx context.Context, call *Call) (*CallResult, error) {
+	if internal.IsNil(call.DB) {
+		return nil, errors.New("db connection is nil")
+	}
+
+	query := appendSQLComment(call.Query, call.Comment)
+	args := call.PreparedStatement.BoundParameterValues()
+
+	switch call.Operation {
+	case OperationExec:
+		result, err := call.DB.ExecContext(ctx, query, args...)
+		if err != nil {
+			return nil, ClassifyError(err)
+		}
+		return &CallResult{Result: result}, nil
+	case OperationQuery:
+		rows, err := call.DB.QueryContext(ctx, query, args...)
+		if err != nil {
+			return nil, ClassifyError(err)
 		}
+		return &CallResult{Rows: rows}, nil
+	case OperationQueryRow:
+		return &CallResult{Row: call.DB.QueryRowContext(ctx, query, args...)}, nil
+	case OperationQueryRows:
+		return mapCallRows(call.DB.QueryContext(ctx, query, args...))
+	default:
+		return nil, fmt.Errorf("unsupported operation %q", call.Operation)
+	}
+}
+
+// mapCallRows maps and closes the rows of an OperationQueryRows call.
+func mapCallRows(rows *sql.Rows, err error) (*CallResult, error) {
+	if err != nil {
+		return nil, ClassifyError(err)
+	}
+	defer rows.Close()
+
+	mappedRows, err := MapRows(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CallResult{MappedRows: mappedRows}, nil
+}
+
+func dbPrepare(
+	ctx context.Context,
+	dbPrep DBPreparer,
+	query string,
+) (
+	*sql.Stmt,
+	error,
+) {
+	if internal.IsNil(dbPrep) {
+		return nil, errors.New("db connection is nil")
 	}
 
-	return prepared, nil
+	return dbPrep.PrepareContext(internal.InitIfNilContext(ctx), query)
 }
 
 func bindValuesGiven(binderFuncs []BindParameterValueFunc) bool {
@@ -36,8 +36,9 @@ func QueryContext(
 		preparedStatement.ResetParametersValues()
 	}()
 
-	prepStmnt, err := dbPrepare(
+	callResult, err := dbCall(
 		ctx,
+		OperationQuery,
 		dbPrepExec,
 		preparedStatement,
 		binderFuncs...,
@@ -46,8 +47,36 @@ func QueryContext(
 		return nil, err
 	}
 
-	return prepStmnt.QueryContext(
+	return callResult.Rows, nil
+}
+
+// QueryRows executes the prepared SQL statement as a query with the bound parameters in the provided
+// context and returns its rows mapped with MapRows. The call passes through the interceptor chain of
+// dbPrepExec as an OperationQueryRows call, which lets handles such as SingleflightDB, CachedDB and
+// ShardedDB produce the rows themselves, however deeply they are wrapped.
+func QueryRows(
+	ctx context.Context,
+	dbPrepExec DBPreparerExecutor,
+	preparedStatement PreparedStatement,
+	binderFuncs ...BindParameterValueFunc,
+) (
+	MappedRows,
+	error,
+) {
+	defer func() {
+		preparedStatement.ResetParametersValues()
+	}()
+
+	callResult, err := dbCall(
 		ctx,
-		preparedStatement.BoundParameterValues()...,
+		OperationQueryRows,
+		dbPrepExec,
+		preparedStatement,
+		binderFuncs...,
 	)
+	if err != nil {
+		return nil, err
+	}
+
+	return callResult.MappedRows, nil
 }
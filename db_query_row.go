@@ -36,8 +36,9 @@ func QueryRowContext(
 		preparedStatement.ResetParametersValues()
 	}()
 
-	prepStmnt, err := dbPrepare(
+	callResult, err := dbCall(
 		ctx,
+		OperationQueryRow,
 		dbPrepExec,
 		preparedStatement,
 		binderFuncs...,
@@ -46,8 +47,5 @@ func QueryRowContext(
 		return nil, err
 	}
 
-	return prepStmnt.QueryRowContext(
-		ctx,
-		preparedStatement.BoundParameterValues()...,
-	), nil
+	return callResult.Row, nil
 }
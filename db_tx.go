@@ -0,0 +1,83 @@
+package dbsql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/neumachen/dbsql/internal"
+)
+
+// TxFunc is a function run inside a transaction by WithTransaction. The tx handle must be used for every
+// statement that belongs to the transaction.
+type TxFunc func(ctx context.Context, tx DBPreparerExecutor) error
+
+// WithTransaction runs txFunc inside a transaction started on dbPrepExec. The transaction is committed if
+// txFunc returns nil and rolled back if it returns an error or panics.
+//
+// If dbPrepExec implements DBTransactor, the transaction is delegated to its RunInTx method, which lets
+// wrappers such as InterceptedDB apply to the statements run inside the transaction. Otherwise
+// dbPrepExec must implement DBTxBeginner.
+//
+// Example:
+//
+//	err := dbsql.WithTransaction(ctx, db, nil, func(ctx context.Context, tx dbsql.DBPreparerExecutor) error {
+//		_, err := dbsql.ExecContext(ctx, tx, insertCustomer, dbsql.BindParameterValue("last_name", "Doe"))
+//		return err
+//	})
+func WithTransaction(
+	ctx context.Context,
+	dbPrepExec DBPreparerExecutor,
+	opts *sql.TxOptions,
+	txFunc TxFunc,
+) error {
+	if internal.IsNil(dbPrepExec) {
+		return errors.New("db connection is nil")
+	}
+
+	if txFunc == nil {
+		return errors.New("transaction func is nil")
+	}
+
+	ctx = internal.InitIfNilContext(ctx)
+
+	if transactor, ok := dbPrepExec.(DBTransactor); ok {
+		return transactor.RunInTx(ctx, opts, txFunc)
+	}
+
+	beginner, ok := dbPrepExec.(DBTxBeginner)
+	if !ok {
+		return errors.New("db connection does not support transactions")
+	}
+
+	return runInTx(ctx, beginner, opts, txFunc)
+}
+
+// runInTx begins a transaction on beginner, runs txFunc with it and commits or rolls it back.
+func runInTx(
+	ctx context.Context,
+	beginner DBTxBeginner,
+	opts *sql.TxOptions,
+	txFunc TxFunc,
+) (err error) {
+	tx, err := beginner.BeginTx(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := txFunc(ctx, tx); err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return errors.Join(err, rollbackErr)
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
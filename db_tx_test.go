@@ -0,0 +1,102 @@
+package dbsql
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithTransaction(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		desc      string
+		assertion func(*testing.T, string)
+	}{
+		{
+			desc: "The transaction is committed when the func succeeds",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fd := NewFakeDB(t)
+
+				preparedStatement, err := PrepareStatement("DELETE FROM customers WHERE customer_id = @customer_id")
+				require.NoError(t, err, desc)
+
+				err = WithTransaction(context.Background(), sqlDB, nil, func(ctx context.Context, tx DBPreparerExecutor) error {
+					_, err := ExecContext(ctx, tx, preparedStatement, BindParameterValue("customer_id", 1))
+					return err
+				})
+				require.NoError(t, err, desc)
+				require.Equal(t, 1, fd.Begins, desc)
+				require.Equal(t, 1, fd.Commits, desc)
+				require.Equal(t, 0, fd.Rollbacks, desc)
+				require.Equal(t, 1, fd.ExecCount(), desc)
+			},
+		},
+		{
+			desc: "The transaction is rolled back when the func fails",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fd := NewFakeDB(t)
+
+				expectedErr := errors.New("mock error")
+				err := WithTransaction(context.Background(), sqlDB, nil, func(context.Context, DBPreparerExecutor) error {
+					return expectedErr
+				})
+				require.ErrorIs(t, err, expectedErr, desc)
+				require.Equal(t, 0, fd.Commits, desc)
+				require.Equal(t, 1, fd.Rollbacks, desc)
+			},
+		},
+		{
+			desc: "The transaction is rolled back when the func panics",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fd := NewFakeDB(t)
+
+				require.Panics(t, func() {
+					_ = WithTransaction(context.Background(), sqlDB, nil, func(context.Context, DBPreparerExecutor) error {
+						panic("boom")
+					})
+				}, desc)
+				require.Equal(t, 1, fd.Rollbacks, desc)
+			},
+		},
+		{
+			desc: "Interceptors apply to the statements run inside the transaction",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, _ := NewFakeDB(t)
+
+				intercepted := 0
+				db := WithInterceptors(sqlDB, func(ctx context.Context, call *Call, next CallHandler) (*CallResult, error) {
+					intercepted++
+					return next(ctx, call)
+				})
+
+				preparedStatement, err := PrepareStatement("DELETE FROM customers")
+				require.NoError(t, err, desc)
+
+				err = WithTransaction(context.Background(), db, nil, func(ctx context.Context, tx DBPreparerExecutor) error {
+					_, err := ExecContext(ctx, tx, preparedStatement)
+					return err
+				})
+				require.NoError(t, err, desc)
+				require.Equal(t, 1, intercepted, desc)
+			},
+		},
+		{
+			desc: "Handles without transaction support return an error",
+			assertion: func(t *testing.T, desc string) {
+				err := WithTransaction(context.Background(), &mockDB{}, nil, func(context.Context, DBPreparerExecutor) error {
+					return nil
+				})
+				require.Error(t, err, desc)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			test.assertion(t, test.desc)
+		})
+	}
+}
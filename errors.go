@@ -0,0 +1,134 @@
+package dbsql
+
+import (
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+// Sentinel errors matched by the DBError returned for PostgreSQL failures. Use errors.Is to check them:
+//
+//	if errors.Is(err, dbsql.ErrUniqueViolation) {
+//		// respond with 409 Conflict
+//	}
+var (
+	// ErrUniqueViolation matches unique_violation (23505) errors.
+	ErrUniqueViolation = errors.New("unique violation")
+	// ErrForeignKeyViolation matches foreign_key_violation (23503) errors.
+	ErrForeignKeyViolation = errors.New("foreign key violation")
+	// ErrNotNullViolation matches not_null_violation (23502) errors.
+	ErrNotNullViolation = errors.New("not null violation")
+	// ErrCheckViolation matches check_violation (23514) errors.
+	ErrCheckViolation = errors.New("check violation")
+	// ErrSerialization matches serialization_failure (40001) errors.
+	ErrSerialization = errors.New("serialization failure")
+	// ErrDeadlock matches deadlock_detected (40P01) errors.
+	ErrDeadlock = errors.New("deadlock detected")
+	// ErrQueryCanceled matches query_canceled (57014) errors, raised by statement timeouts and cancel requests.
+	ErrQueryCanceled = errors.New("query canceled")
+	// ErrReadOnly matches read_only_sql_transaction (25006) errors. It is also returned by ReadOnlyDB for
+	// the statements it refuses.
+	ErrReadOnly = errors.New("read only")
+	// ErrLockNotAvailable matches lock_not_available (55P03) errors, raised by NOWAIT locks. It is also
+	// returned by TryAdvisoryLock when the lock is held by another session.
+	ErrLockNotAvailable = errors.New("lock not available")
+)
+
+// sqlStateErrors maps SQLSTATE codes to their sentinel errors.
+var sqlStateErrors = map[string]error{
+	"23505": ErrUniqueViolation,
+	"23503": ErrForeignKeyViolation,
+	"23502": ErrNotNullViolation,
+	"23514": ErrCheckViolation,
+	"40001": ErrSerialization,
+	"40P01": ErrDeadlock,
+	"57014": ErrQueryCanceled,
+	"25006": ErrReadOnly,
+	"55P03": ErrLockNotAvailable,
+}
+
+// DBError is a classified PostgreSQL error. It wraps both the driver error and, for the classified
+// SQLSTATE codes, one of the sentinel errors, so errors.Is matches the sentinel and errors.As still finds
+// the driver error, e.g. *pq.Error.
+type DBError struct {
+	// Kind is the sentinel error for the SQLSTATE code, or nil if the code is not classified.
+	Kind error
+	// Code is the SQLSTATE code.
+	Code string
+	// Message is the primary error message.
+	Message string
+	// Detail is the optional detail message, e.g. the conflicting key of a unique violation.
+	Detail string
+	// Schema is the name of the schema of the object the error relates to, if any.
+	Schema string
+	// Table is the name of the table the error relates to, if any.
+	Table string
+	// Column is the name of the column the error relates to, if any.
+	Column string
+	// Constraint is the name of the violated constraint, if any, e.g. "uniq_email_address".
+	Constraint string
+	// Err is the driver error.
+	Err error
+}
+
+// Error returns the driver error's message.
+func (e *DBError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the sentinel error, if any, and the driver error.
+func (e *DBError) Unwrap() []error {
+	if e.Kind == nil {
+		return []error{e.Err}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+// SQLState returns the SQLSTATE code. It implements SQLStateError.
+func (e *DBError) SQLState() string {
+	return e.Code
+}
+
+// ClassifyError wraps a driver error carrying an SQLSTATE code in a DBError. Errors that are nil, carry
+// no SQLSTATE code or are already classified are returned unchanged.
+//
+// The package-level Exec, Query and QueryRow functions, MapRow and MapRows classify the errors they
+// return; ClassifyError is for errors obtained from the database/sql types directly, e.g. from Scan.
+func ClassifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var dbErr *DBError
+	if errors.As(err, &dbErr) {
+		return err
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return &DBError{
+			Kind:       sqlStateErrors[string(pqErr.Code)],
+			Code:       string(pqErr.Code),
+			Message:    pqErr.Message,
+			Detail:     pqErr.Detail,
+			Schema:     pqErr.Schema,
+			Table:      pqErr.Table,
+			Column:     pqErr.Column,
+			Constraint: pqErr.Constraint,
+			Err:        err,
+		}
+	}
+
+	if sqlState := SQLState(err); sqlState != "" {
+		return &DBError{
+			Kind:    sqlStateErrors[sqlState],
+			Code:    sqlState,
+			Message: err.Error(),
+			Err:     err,
+		}
+	}
+
+	return err
+}
+
+var _ SQLStateError = (*DBError)(nil)
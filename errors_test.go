@@ -0,0 +1,98 @@
+package dbsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Code     pq.ErrorCode
+		Sentinel error
+	}{
+		{Name: "unique violation", Code: "23505", Sentinel: ErrUniqueViolation},
+		{Name: "foreign key violation", Code: "23503", Sentinel: ErrForeignKeyViolation},
+		{Name: "not null violation", Code: "23502", Sentinel: ErrNotNullViolation},
+		{Name: "check violation", Code: "23514", Sentinel: ErrCheckViolation},
+		{Name: "serialization failure", Code: "40001", Sentinel: ErrSerialization},
+		{Name: "deadlock detected", Code: "40P01", Sentinel: ErrDeadlock},
+		{Name: "query canceled", Code: "57014", Sentinel: ErrQueryCanceled},
+		{Name: "read only", Code: "25006", Sentinel: ErrReadOnly},
+		{Name: "lock not available", Code: "55P03", Sentinel: ErrLockNotAvailable},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			err := ClassifyError(fmt.Errorf("wrapped: %w", &pq.Error{Code: test.Code}))
+			require.ErrorIs(t, err, test.Sentinel)
+
+			var pqErr *pq.Error
+			require.ErrorAs(t, err, &pqErr)
+			require.Equal(t, string(test.Code), SQLState(err))
+		})
+	}
+
+	t.Run("constraint details", func(t *testing.T) {
+		err := ClassifyError(&pq.Error{
+			Code:       "23505",
+			Message:    `duplicate key value violates unique constraint "uniq_email_address"`,
+			Detail:     "Key (email_address)=(john@example.com) already exists.",
+			Schema:     "public",
+			Table:      "email_addresses",
+			Constraint: "uniq_email_address",
+		})
+
+		var dbErr *DBError
+		require.ErrorAs(t, err, &dbErr)
+		require.Equal(t, "uniq_email_address", dbErr.Constraint)
+		require.Equal(t, "email_addresses", dbErr.Table)
+		require.Equal(t, "public", dbErr.Schema)
+		require.Equal(t, "Key (email_address)=(john@example.com) already exists.", dbErr.Detail)
+		require.Same(t, err, ClassifyError(err))
+	})
+
+	t.Run("unclassified errors", func(t *testing.T) {
+		require.NoError(t, ClassifyError(nil))
+
+		plainErr := errors.New("mock error")
+		require.Same(t, plainErr, ClassifyError(plainErr))
+
+		err := ClassifyError(&pq.Error{Code: "42P01"})
+		var dbErr *DBError
+		require.ErrorAs(t, err, &dbErr)
+		require.NoError(t, dbErr.Kind)
+		require.Equal(t, "42P01", dbErr.Code)
+	})
+}
+
+func TestExecContext_ClassifiesErrors(t *testing.T) {
+	sqlDB, fd := NewFakeDB(t)
+	fd.ExecFunc = func(string, []any) (driver.Result, error) {
+		return nil, &pq.Error{Code: "23503", Table: "email_addresses", Constraint: "customer_fk"}
+	}
+
+	observed := error(nil)
+	db := WithInterceptors(sqlDB, func(ctx context.Context, call *Call, next CallHandler) (*CallResult, error) {
+		callResult, err := next(ctx, call)
+		observed = err
+		return callResult, err
+	})
+
+	preparedStatement, err := PrepareStatement("INSERT INTO email_addresses (customer_id) VALUES (@customer_id)")
+	require.NoError(t, err)
+
+	_, err = ExecContext(context.Background(), db, preparedStatement, BindParameterValue("customer_id", 1))
+	require.ErrorIs(t, err, ErrForeignKeyViolation)
+	require.ErrorIs(t, observed, ErrForeignKeyViolation)
+
+	var dbErr *DBError
+	require.ErrorAs(t, err, &dbErr)
+	require.Equal(t, "customer_fk", dbErr.Constraint)
+}
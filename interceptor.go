@@ -0,0 +1,168 @@
+package dbsql
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Operation identifies the kind of call made through Exec, Query or QueryRow.
+type Operation string
+
+const (
+	// OperationExec identifies calls made through Exec and ExecContext.
+	OperationExec Operation = "exec"
+	// OperationQuery identifies calls made through Query and QueryContext.
+	OperationQuery Operation = "query"
+	// OperationQueryRow identifies calls made through QueryRow and QueryRowContext.
+	OperationQueryRow Operation = "query_row"
+	// OperationQueryRows identifies calls made through QueryRows. The rows are read and closed before the
+	// call returns, so interceptors see the whole query, including the time spent reading its rows.
+	OperationQueryRows Operation = "query_rows"
+)
+
+// String returns the Operation as a string.
+func (o Operation) String() string {
+	return string(o)
+}
+
+// Call describes a single Exec, Query or QueryRow invocation as it passes through an interceptor chain.
+//
+// By the time an interceptor receives a Call, the binder funcs given to the package-level function have
+// already been applied, so PreparedStatement.BoundParameterValues returns the values that will be sent
+// to the database. Interceptors may rebind values through the PreparedStatement or replace Query before
+// calling the next handler.
+type Call struct {
+	// Operation is the kind of call being made.
+	Operation Operation
+	// DB is the handle the statement will be prepared and executed on.
+	DB DBPreparerExecutor
+	// PreparedStatement is the statement given to the package-level function.
+	PreparedStatement PreparedStatement
+	// Query is the SQL sent to the database. It starts out as PreparedStatement.Revised().
+	Query string
+	// Comment is an SQL comment appended to Query when it is sent to the database, see
+	// SQLCommenterInterceptor. A call with a comment is sent as an unnamed statement instead of being
+	// prepared, so comments that vary between calls never create distinct server-side prepared statements.
+	Comment string
+}
+
+// CallResult holds the outcome of a Call. Only the field matching the Call's Operation is set.
+type CallResult struct {
+	// Result is set for OperationExec.
+	Result sql.Result
+	// Rows is set for OperationQuery.
+	Rows *sql.Rows
+	// Row is set for OperationQueryRow.
+	Row *sql.Row
+	// MappedRows is set for OperationQueryRows.
+	MappedRows MappedRows
+}
+
+// CallHandler executes a Call and returns its outcome.
+type CallHandler func(ctx context.Context, call *Call) (*CallResult, error)
+
+// Interceptor is invoked around a Call. It may observe or modify the call, time it, or short-circuit it
+// by returning without invoking next.
+//
+// Example:
+//
+//	timing := func(ctx context.Context, call *dbsql.Call, next dbsql.CallHandler) (*dbsql.CallResult, error) {
+//		start := time.Now()
+//		defer func() {
+//			log.Printf("%s %s took %s", call.Operation, call.PreparedStatement.UnpreparedStatement(), time.Since(start))
+//		}()
+//		return next(ctx, call)
+//	}
+//	db := dbsql.WithInterceptors(sqlDB, timing)
+type Interceptor func(ctx context.Context, call *Call, next CallHandler) (*CallResult, error)
+
+// Interceptors is an ordered chain of Interceptor. The first Interceptor is the outermost.
+type Interceptors []Interceptor
+
+// Handler returns a CallHandler that runs the chain and ends with final.
+func (i Interceptors) Handler(final CallHandler) CallHandler {
+	handler := final
+	for j := len(i) - 1; j >= 0; j-- {
+		interceptor, next := i[j], handler
+		if interceptor == nil {
+			continue
+		}
+		handler = func(ctx context.Context, call *Call) (*CallResult, error) {
+			return interceptor(ctx, call, next)
+		}
+	}
+
+	return handler
+}
+
+// DBInterceptor is implemented by database handles that intercept the calls made through Exec, Query
+// and QueryRow. When the handle given to one of those functions implements DBInterceptor, InterceptCall
+// is invoked with a next handler that prepares and executes the statement.
+type DBInterceptor interface {
+	InterceptCall(ctx context.Context, call *Call, next CallHandler) (*CallResult, error)
+}
+
+// InterceptedDB is a database handle with an interceptor chain. It is returned by WithInterceptors.
+//
+// Only the calls made through the package-level Exec, Query and QueryRow functions pass through the
+// chain; the embedded DBPreparerExecutor methods are forwarded to the wrapped handle as is.
+type InterceptedDB struct {
+	wrappedDB
+	interceptors Interceptors
+}
+
+// WithInterceptors wraps dbPrepExec so that every Exec, Query and QueryRow made with the returned
+// handle passes through the given interceptors, in order. Wrapping a handle that is itself a
+// DBInterceptor nests its chain inside the new one.
+func WithInterceptors(dbPrepExec DBPreparerExecutor, interceptors ...Interceptor) *InterceptedDB {
+	chain := make(Interceptors, len(interceptors))
+	copy(chain, interceptors)
+
+	return &InterceptedDB{
+		wrappedDB:    wrappedDB{dbPrepExec},
+		interceptors: chain,
+	}
+}
+
+// InterceptCall runs the interceptor chain around next.
+func (i *InterceptedDB) InterceptCall(ctx context.Context, call *Call, next CallHandler) (*CallResult, error) {
+	return i.interceptors.Handler(func(ctx context.Context, call *Call) (*CallResult, error) {
+		return interceptCall(ctx, i.DBPreparerExecutor, call, next)
+	})(ctx, call)
+}
+
+// RunInTx runs txFunc inside a transaction started on the wrapped handle. The tx handle given to txFunc
+// passes through the same interceptors.
+func (i *InterceptedDB) RunInTx(ctx context.Context, opts *sql.TxOptions, txFunc TxFunc) error {
+	return WithTransaction(ctx, i.DBPreparerExecutor, opts, func(ctx context.Context, tx DBPreparerExecutor) error {
+		return txFunc(ctx, WithInterceptors(tx, i.interceptors...))
+	})
+}
+
+// interceptCall invokes the interceptor chain of dbPrepExec, if it has one, around next.
+func interceptCall(
+	ctx context.Context,
+	dbPrepExec DBPreparerExecutor,
+	call *Call,
+	next CallHandler,
+) (
+	*CallResult,
+	error,
+) {
+	if interceptor, ok := dbPrepExec.(DBInterceptor); ok {
+		return interceptor.InterceptCall(ctx, call, next)
+	}
+	return next(ctx, call)
+}
+
+// wrapSession returns conn passing through the same interceptors.
+func (i *InterceptedDB) wrapSession(conn DBPreparerExecutor) DBPreparerExecutor {
+	return WithInterceptors(conn, i.interceptors...)
+}
+
+var (
+	_ DB             = (*InterceptedDB)(nil)
+	_ DBInterceptor  = (*InterceptedDB)(nil)
+	_ DBTransactor   = (*InterceptedDB)(nil)
+	_ sessionWrapper = (*InterceptedDB)(nil)
+)
@@ -0,0 +1,129 @@
+package dbsql
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithInterceptors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		desc      string
+		assertion func(*testing.T, string)
+	}{
+		{
+			desc: "Interceptors run in order and observe the bound values",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fd := NewFakeDB(t)
+
+				var order []string
+				var observed BoundParameterValues
+				record := func(name string) Interceptor {
+					return func(ctx context.Context, call *Call, next CallHandler) (*CallResult, error) {
+						order = append(order, name+":before")
+						observed = append(BoundParameterValues(nil), call.PreparedStatement.BoundParameterValues()...)
+						result, err := next(ctx, call)
+						order = append(order, name+":after")
+						return result, err
+					}
+				}
+
+				db := WithInterceptors(sqlDB, record("outer"), record("inner"))
+
+				preparedStatement, err := PrepareStatement("UPDATE customers SET last_name = @last_name WHERE customer_id = @id")
+				require.NoError(t, err, desc)
+
+				result, err := ExecContext(
+					context.Background(),
+					db,
+					preparedStatement,
+					BindParameterValue("last_name", "Doe"),
+					BindParameterValue("id", 7),
+				)
+				require.NoError(t, err, desc)
+				require.NotNil(t, result, desc)
+
+				require.Equal(t, []string{"outer:before", "inner:before", "inner:after", "outer:after"}, order, desc)
+				require.Equal(t, BoundParameterValues{"Doe", 7}, observed, desc)
+				require.Equal(t, []any{"Doe", 7}, fd.LastExec().Args, desc)
+				require.Nil(t, preparedStatement.BoundParameterValues()[0], desc)
+			},
+		},
+		{
+			desc: "An interceptor can short-circuit the call",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fd := NewFakeDB(t)
+
+				expectedErr := errors.New("injected fault")
+				db := WithInterceptors(sqlDB, func(context.Context, *Call, CallHandler) (*CallResult, error) {
+					return nil, expectedErr
+				})
+
+				preparedStatement, err := PrepareStatement("SELECT * FROM customers")
+				require.NoError(t, err, desc)
+
+				rows, err := QueryContext(context.Background(), db, preparedStatement)
+				require.ErrorIs(t, err, expectedErr, desc)
+				require.Nil(t, rows, desc)
+				require.Empty(t, fd.Prepared, desc)
+			},
+		},
+		{
+			desc: "An interceptor can modify the query",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fd := NewFakeDB(t)
+
+				db := WithInterceptors(sqlDB, func(ctx context.Context, call *Call, next CallHandler) (*CallResult, error) {
+					call.Query += " LIMIT 1"
+					return next(ctx, call)
+				})
+
+				preparedStatement, err := PrepareStatement("SELECT * FROM customers WHERE last_name = @last_name")
+				require.NoError(t, err, desc)
+
+				row, err := QueryRowContext(
+					context.Background(),
+					db,
+					preparedStatement,
+					BindParameterValue("last_name", "Doe"),
+				)
+				require.NoError(t, err, desc)
+				require.NotNil(t, row, desc)
+				require.Equal(t, "SELECT * FROM customers WHERE last_name = $1 LIMIT 1", fd.LastQuery().Query, desc)
+			},
+		},
+		{
+			desc: "Nested intercepted handles run the outer chain first",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, _ := NewFakeDB(t)
+
+				var order []string
+				record := func(name string) Interceptor {
+					return func(ctx context.Context, call *Call, next CallHandler) (*CallResult, error) {
+						order = append(order, name)
+						return next(ctx, call)
+					}
+				}
+
+				db := WithInterceptors(WithInterceptors(sqlDB, record("inner")), record("outer"))
+
+				preparedStatement, err := PrepareStatement("DELETE FROM customers")
+				require.NoError(t, err, desc)
+
+				_, err = ExecContext(context.Background(), db, preparedStatement)
+				require.NoError(t, err, desc)
+				require.Equal(t, []string{"outer", "inner"}, order, desc)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			test.assertion(t, test.desc)
+		})
+	}
+}
@@ -0,0 +1,299 @@
+package dbsql
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/neumachen/dbsql/internal"
+)
+
+// ErrInvalidCursor is returned by KeysetPaginator.Page for a cursor token that is malformed, was
+// tampered with or was issued for another statement.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// keysetLimitParameter is the parameter bound to the page size.
+const keysetLimitParameter = "limit"
+
+// keysetAfterParameter returns the parameter bound to the key's value in the last row of the previous page.
+func keysetAfterParameter(key Column) string {
+	return "after_" + key.String()
+}
+
+// keysetKeyPattern matches the key columns accepted by NewKeysetPaginator.
+var keysetKeyPattern = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// KeysetPage is a page of rows returned by KeysetPaginator.Page.
+type KeysetPage struct {
+	// Rows are the rows of the page.
+	Rows MappedRows
+	// NextCursor is the cursor token of the next page, or an empty string if this is the last page.
+	NextCursor string
+}
+
+// KeysetOption configures a KeysetPaginator.
+type KeysetOption func(paginator *KeysetPaginator)
+
+// KeysetDescending pages through the rows in descending key order.
+func KeysetDescending() KeysetOption {
+	return func(paginator *KeysetPaginator) {
+		paginator.descending = true
+	}
+}
+
+// KeysetPaginator pages through the rows of a query by key rather than by offset, so every page costs
+// the same however deep it is. The query is wrapped in
+//
+//	SELECT * FROM (<query>) AS dbsql_keyset WHERE (k1, k2) > (@after_k1, @after_k2) ORDER BY k1, k2 LIMIT @limit
+//
+// The cursor token handed out for the next page encodes the keys of the page's last row and is signed
+// with HMAC-SHA256, so clients cannot forge it or reuse it with another statement. The keys must
+// identify a row uniquely, and their values must survive a JSON round trip as numbers, strings or times.
+// A KeysetPaginator is safe for concurrent use.
+//
+// Example:
+//
+//	paginator, err := dbsql.NewKeysetPaginator(selectCustomers, dbsql.Columns{"created_at", "customer_id"}, 50, secret)
+//	page, err := paginator.Page(ctx, db, request.URL.Query().Get("cursor"))
+//	// respond with page.Rows and page.NextCursor
+type KeysetPaginator struct {
+	name         string
+	keys         Columns
+	pageSize     int
+	secret       []byte
+	descending   bool
+	firstPageSQL string
+	nextPageSQL  string
+	statementID  []byte
+}
+
+// NewKeysetPaginator returns a KeysetPaginator over the rows of the prepared statement, ordered by the
+// key columns, pageSize rows at a time. The key columns must be lower-case, unquoted column names of
+// the statement's result, and secret is the key used to sign the cursor tokens.
+func NewKeysetPaginator(
+	preparedStatement PreparedStatement,
+	keys Columns,
+	pageSize int,
+	secret []byte,
+	opts ...KeysetOption,
+) (
+	*KeysetPaginator,
+	error,
+) {
+	if internal.IsNil(preparedStatement) {
+		return nil, errors.New("prepared statement is nil")
+	}
+
+	if len(keys) < 1 {
+		return nil, errors.New("keys are empty")
+	}
+
+	if pageSize < 1 {
+		return nil, errors.New("page size must be positive")
+	}
+
+	if len(secret) < 1 {
+		return nil, errors.New("secret is empty")
+	}
+
+	var parameters []string
+	if positions := preparedStatement.ParameterPositions(); positions != nil {
+		parameters = positions.Parameters()
+	}
+	reserved := map[string]bool{keysetLimitParameter: true}
+	for _, key := range keys {
+		if !keysetKeyPattern.MatchString(key.String()) {
+			return nil, fmt.Errorf("key %q is not a lower-case unquoted column name", key)
+		}
+		reserved[keysetAfterParameter(key)] = true
+	}
+	for _, parameter := range parameters {
+		if reserved[parameter] {
+			return nil, fmt.Errorf("parameter @%s is reserved by the paginator", parameter)
+		}
+	}
+
+	paginator := &KeysetPaginator{
+		name:     statementName(preparedStatement),
+		keys:     append(Columns(nil), keys...),
+		pageSize: pageSize,
+		secret:   append([]byte(nil), secret...),
+	}
+	for i := range opts {
+		opts[i](paginator)
+	}
+
+	query := strings.TrimRightFunc(preparedStatement.UnpreparedStatement(), func(r rune) bool {
+		return r == ';' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	})
+
+	keyList := make([]string, len(keys))
+	afterList := make([]string, len(keys))
+	for i, key := range keys {
+		keyList[i] = key.String()
+		afterList[i] = string(parameterPrefix) + keysetAfterParameter(key)
+	}
+
+	comparison, direction := ">", ""
+	if paginator.descending {
+		comparison, direction = "<", " DESC"
+	}
+
+	orderBy := strings.Join(keyList, direction+", ") + direction
+	paginator.firstPageSQL = fmt.Sprintf(
+		"SELECT * FROM (%s) AS dbsql_keyset ORDER BY %s LIMIT @%s",
+		query, orderBy, keysetLimitParameter,
+	)
+	paginator.nextPageSQL = fmt.Sprintf(
+		"SELECT * FROM (%s) AS dbsql_keyset WHERE (%s) %s (%s) ORDER BY %s LIMIT @%s",
+		query, strings.Join(keyList, ", "), comparison, strings.Join(afterList, ", "), orderBy, keysetLimitParameter,
+	)
+
+	// Tokens are bound to the statement they were issued for.
+	statementID := sha256.Sum256([]byte(paginator.nextPageSQL))
+	paginator.statementID = statementID[:]
+
+	return paginator, nil
+}
+
+// Page returns the page following the one the cursor token was issued for, or the first page if the
+// cursor is empty. The binderFuncs bind the parameters of the paginated statement.
+func (p *KeysetPaginator) Page(
+	ctx context.Context,
+	dbPrepExec DBPreparerExecutor,
+	cursor string,
+	binderFuncs ...BindParameterValueFunc,
+) (
+	KeysetPage,
+	error,
+) {
+	query := p.firstPageSQL
+	var afterValues []any
+	if cursor != "" {
+		var err error
+		if afterValues, err = p.decodeCursor(cursor); err != nil {
+			return KeysetPage{}, err
+		}
+		query = p.nextPageSQL
+	}
+
+	var opts []PrepareStatementOption
+	if p.name != "" {
+		opts = append(opts, StatementName(p.name))
+	}
+	preparedStatement, err := PrepareStatement(query, opts...)
+	if err != nil {
+		return KeysetPage{}, err
+	}
+
+	binders := make([]BindParameterValueFunc, 0, len(binderFuncs)+len(afterValues)+1)
+	binders = append(binders, binderFuncs...)
+	for i := range afterValues {
+		binders = append(binders, BindParameterValue(keysetAfterParameter(p.keys[i]), afterValues[i]))
+	}
+	// One more row than the page size tells whether there is a next page.
+	binders = append(binders, BindParameterValue(keysetLimitParameter, p.pageSize+1))
+
+	rows, err := QueryContext(ctx, dbPrepExec, preparedStatement, binders...)
+	if err != nil {
+		return KeysetPage{}, err
+	}
+	defer rows.Close()
+
+	mappedRows, err := MapRows(rows)
+	if err != nil {
+		return KeysetPage{}, err
+	}
+
+	if len(mappedRows) <= p.pageSize {
+		return KeysetPage{Rows: mappedRows}, nil
+	}
+
+	mappedRows = mappedRows[:p.pageSize]
+	nextCursor, err := p.encodeCursor(mappedRows[len(mappedRows)-1])
+	if err != nil {
+		return KeysetPage{}, err
+	}
+
+	return KeysetPage{Rows: mappedRows, NextCursor: nextCursor}, nil
+}
+
+// encodeCursor returns the signed cursor token for the keys of the last row of a page.
+func (p *KeysetPaginator) encodeCursor(lastRow MappedRow) (string, error) {
+	values := make([]any, len(p.keys))
+	for i, key := range p.keys {
+		value, ok := lastRow.Get(key)
+		if !ok {
+			return "", fmt.Errorf("key column %s is missing from the rows", key)
+		}
+		// lib/pq returns uuid and numeric values as the bytes of their text form, which must be encoded as
+		// text to be compared with the column again; binary data such as bytea cannot be.
+		if b, ok := value.([]byte); ok {
+			if !utf8.Valid(b) {
+				return "", fmt.Errorf("key column %s holds binary data, which cannot be encoded in a cursor", key)
+			}
+			value = string(b)
+		}
+		values[i] = value
+	}
+
+	payload, err := json.Marshal(values)
+	if err != nil {
+		return "", fmt.Errorf("encode cursor: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(p.sign(payload)), nil
+}
+
+// decodeCursor verifies the cursor token and returns the key values it encodes.
+func (p *KeysetPaginator) decodeCursor(cursor string) ([]any, error) {
+	encodedPayload, encodedSignature, ok := strings.Cut(cursor, ".")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil || !hmac.Equal(signature, p.sign(payload)) {
+		return nil, ErrInvalidCursor
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+
+	var values []any
+	if err := decoder.Decode(&values); err != nil || len(values) != len(p.keys) {
+		return nil, ErrInvalidCursor
+	}
+
+	for i := range values {
+		// Numbers are sent as text so large integers and decimals keep their precision; PostgreSQL
+		// infers the parameter types from the key columns.
+		if number, ok := values[i].(json.Number); ok {
+			values[i] = number.String()
+		}
+	}
+
+	return values, nil
+}
+
+// sign returns the HMAC-SHA256 of the statement and the payload.
+func (p *KeysetPaginator) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, p.secret)
+	mac.Write(p.statementID)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
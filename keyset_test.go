@@ -0,0 +1,224 @@
+package dbsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeysetPaginator(t *testing.T) {
+	t.Parallel()
+
+	secret := []byte("secret")
+
+	// keysetDriver serves the customers with an id above the after_customer_id argument, if any, up to
+	// the limit argument.
+	keysetDriver := func(t *testing.T, total int) (DBPreparerExecutor, *fakeDriver) {
+		sqlDB, fd := NewFakeDB(t)
+		fd.QueryFunc = func(query string, args []any) (driver.Rows, error) {
+			after, limit := 0, args[len(args)-1].(int)
+			if len(args) > 2 {
+				after = len(args[1].(string))
+			}
+			var values [][]driver.Value
+			for id := after + 1; id <= total && len(values) < limit; id++ {
+				values = append(values, []driver.Value{"NL", strings.Repeat("x", id)})
+			}
+			return newFakeRows([]string{"country", "customer_id"}, values...), nil
+		}
+		return sqlDB, fd
+	}
+
+	newPaginator := func(t *testing.T, opts ...KeysetOption) *KeysetPaginator {
+		preparedStatement, err := PrepareStatement("SELECT country, customer_id FROM customers WHERE country = @country;")
+		require.NoError(t, err)
+
+		paginator, err := NewKeysetPaginator(preparedStatement, Columns{"customer_id"}, 2, secret, opts...)
+		require.NoError(t, err)
+		return paginator
+	}
+
+	tests := []struct {
+		desc      string
+		assertion func(*testing.T, string)
+	}{
+		{
+			desc: "Pages are fetched by key until the last page",
+			assertion: func(t *testing.T, desc string) {
+				db, fd := keysetDriver(t, 5)
+				paginator := newPaginator(t)
+
+				page, err := paginator.Page(context.Background(), db, "", BindParameterValue("country", "NL"))
+				require.NoError(t, err, desc)
+				require.Len(t, page.Rows, 2, desc)
+				require.NotEmpty(t, page.NextCursor, desc)
+				require.Equal(
+					t,
+					fakeDriverCall{
+						Query: "SELECT * FROM (SELECT country, customer_id FROM customers WHERE country = $1) AS dbsql_keyset ORDER BY customer_id LIMIT $2",
+						Args:  []any{"NL", 3},
+						Conn:  1,
+					},
+					fd.LastQuery(),
+					desc,
+				)
+
+				page, err = paginator.Page(context.Background(), db, page.NextCursor, BindParameterValue("country", "NL"))
+				require.NoError(t, err, desc)
+				require.Equal(t, "xxx", page.Rows[0]["customer_id"], desc)
+				require.Equal(
+					t,
+					fakeDriverCall{
+						Query: "SELECT * FROM (SELECT country, customer_id FROM customers WHERE country = $1) AS dbsql_keyset WHERE (customer_id) > ($2) ORDER BY customer_id LIMIT $3",
+						Args:  []any{"NL", "xx", 3},
+						Conn:  1,
+					},
+					fd.LastQuery(),
+					desc,
+				)
+
+				page, err = paginator.Page(context.Background(), db, page.NextCursor, BindParameterValue("country", "NL"))
+				require.NoError(t, err, desc)
+				require.Len(t, page.Rows, 1, desc)
+				require.Empty(t, page.NextCursor, desc)
+			},
+		},
+		{
+			desc: "Keys scanned as bytes, such as uuid values, are encoded as text",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fd := NewFakeDB(t)
+				fd.QueryFunc = func(string, []any) (driver.Rows, error) {
+					return newFakeRows(
+						[]string{"country", "customer_id"},
+						[]driver.Value{"NL", []byte("0b9a5e3c-8f4e-4a51-9d6b-1f2e3c4d5e6f")},
+						[]driver.Value{"NL", []byte("6f1c2b3a-4d5e-4f60-8a7b-9c0d1e2f3a4b")},
+						[]driver.Value{"NL", []byte("a1b2c3d4-e5f6-4a7b-8c9d-0e1f2a3b4c5d")},
+					), nil
+				}
+				paginator := newPaginator(t)
+
+				page, err := paginator.Page(context.Background(), sqlDB, "", BindParameterValue("country", "NL"))
+				require.NoError(t, err, desc)
+
+				_, err = paginator.Page(context.Background(), sqlDB, page.NextCursor, BindParameterValue("country", "NL"))
+				require.NoError(t, err, desc)
+				require.Equal(t, []any{"NL", "6f1c2b3a-4d5e-4f60-8a7b-9c0d1e2f3a4b", 3}, fd.LastQuery().Args, desc)
+
+				fd.QueryFunc = func(string, []any) (driver.Rows, error) {
+					return newFakeRows(
+						[]string{"country", "customer_id"},
+						[]driver.Value{"NL", []byte{0xff}},
+						[]driver.Value{"NL", []byte{0xfe}},
+						[]driver.Value{"NL", []byte{0xfd}},
+					), nil
+				}
+				_, err = paginator.Page(context.Background(), sqlDB, "", BindParameterValue("country", "NL"))
+				require.EqualError(t, err, "key column customer_id holds binary data, which cannot be encoded in a cursor", desc)
+			},
+		},
+		{
+			desc: "Descending pages compare and order the keys downwards",
+			assertion: func(t *testing.T, desc string) {
+				db, fd := keysetDriver(t, 5)
+				paginator := newPaginator(t, KeysetDescending())
+
+				page, err := paginator.Page(context.Background(), db, "", BindParameterValue("country", "NL"))
+				require.NoError(t, err, desc)
+
+				_, err = paginator.Page(context.Background(), db, page.NextCursor, BindParameterValue("country", "NL"))
+				require.NoError(t, err, desc)
+				require.True(t, strings.HasSuffix(fd.LastQuery().Query, "WHERE (customer_id) < ($2) ORDER BY customer_id DESC LIMIT $3"), desc)
+			},
+		},
+		{
+			desc: "Tampered cursors and cursors of other statements are rejected",
+			assertion: func(t *testing.T, desc string) {
+				db, _ := keysetDriver(t, 5)
+				paginator := newPaginator(t)
+
+				page, err := paginator.Page(context.Background(), db, "")
+				require.NoError(t, err, desc)
+
+				payload, signature, _ := strings.Cut(page.NextCursor, ".")
+				for _, cursor := range []string{
+					"garbage",
+					payload + "x." + signature,
+					payload + "." + signature[1:],
+				} {
+					_, err = paginator.Page(context.Background(), db, cursor)
+					require.ErrorIs(t, err, ErrInvalidCursor, desc)
+				}
+
+				_, err = newPaginator(t, KeysetDescending()).Page(context.Background(), db, page.NextCursor)
+				require.ErrorIs(t, err, ErrInvalidCursor, desc)
+
+				// Statements differing only in their literals issue distinct cursors.
+				literalPaginator := func(country string) *KeysetPaginator {
+					preparedStatement, err := PrepareStatement("SELECT country, customer_id FROM customers WHERE country = '" + country + "'")
+					require.NoError(t, err, desc)
+					paginator, err := NewKeysetPaginator(preparedStatement, Columns{"customer_id"}, 2, secret)
+					require.NoError(t, err, desc)
+					return paginator
+				}
+				page, err = literalPaginator("NL").Page(context.Background(), db, "")
+				require.NoError(t, err, desc)
+				_, err = literalPaginator("BE").Page(context.Background(), db, page.NextCursor)
+				require.ErrorIs(t, err, ErrInvalidCursor, desc)
+			},
+		},
+		{
+			desc: "Numbers keep their precision through the cursor",
+			assertion: func(t *testing.T, desc string) {
+				paginator := newPaginator(t)
+
+				cursor, err := paginator.encodeCursor(MappedRow{"customer_id": int64(9007199254740993)})
+				require.NoError(t, err, desc)
+
+				values, err := paginator.decodeCursor(cursor)
+				require.NoError(t, err, desc)
+				require.Equal(t, []any{"9007199254740993"}, values, desc)
+			},
+		},
+		{
+			desc: "Reserved parameters and invalid keys are rejected",
+			assertion: func(t *testing.T, desc string) {
+				preparedStatement, err := PrepareStatement("SELECT customer_id FROM customers LIMIT @limit")
+				require.NoError(t, err, desc)
+
+				_, err = NewKeysetPaginator(preparedStatement, Columns{"customer_id"}, 10, secret)
+				require.EqualError(t, err, "parameter @limit is reserved by the paginator", desc)
+
+				_, err = NewKeysetPaginator(preparedStatement, Columns{"Customer ID"}, 10, secret)
+				require.Error(t, err, desc)
+
+				_, err = NewKeysetPaginator(preparedStatement, Columns{"customer_id"}, 10, nil)
+				require.EqualError(t, err, "secret is empty", desc)
+			},
+		},
+		{
+			desc: "A key column missing from the rows fails the page",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fd := NewFakeDB(t)
+				fd.QueryFunc = func(string, []any) (driver.Rows, error) {
+					return newFakeRows([]string{"country"}, []driver.Value{"NL"}, []driver.Value{"NL"}, []driver.Value{"NL"}), nil
+				}
+
+				_, err := newPaginator(t).Page(context.Background(), sqlDB, "")
+				require.EqualError(t, err, "key column customer_id is missing from the rows", desc)
+				require.False(t, errors.Is(err, ErrInvalidCursor), desc)
+			},
+		},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			tc.assertion(t, tc.desc)
+		})
+	}
+}
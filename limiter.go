@@ -0,0 +1,258 @@
+package dbsql
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"sync"
+)
+
+// Priority orders the calls waiting for a LimitedDB. Higher priorities run first.
+type Priority int
+
+const (
+	// PriorityLow is for background work such as batch jobs.
+	PriorityLow Priority = -10
+	// PriorityNormal is the priority of calls made with a context without a priority.
+	PriorityNormal Priority = 0
+	// PriorityHigh is for interactive requests.
+	PriorityHigh Priority = 10
+)
+
+type priorityKey struct{}
+
+// ContextWithPriority returns a copy of ctx whose calls wait for a LimitedDB with the given priority.
+func ContextWithPriority(ctx context.Context, priority Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, priority)
+}
+
+// contextPriority returns the priority set with ContextWithPriority, or PriorityNormal.
+func contextPriority(ctx context.Context) Priority {
+	priority, ok := ctx.Value(priorityKey{}).(Priority)
+	if !ok {
+		return PriorityNormal
+	}
+	return priority
+}
+
+// LimiterPolicy configures WithLimiter. Zero limits mean no limit.
+type LimiterPolicy struct {
+	// MaxInFlight caps the calls in flight across every statement.
+	MaxInFlight int
+	// MaxInFlightPerStatement caps the calls in flight for each statement, as identified by StatementKey.
+	MaxInFlightPerStatement int
+	// StatementLimits overrides MaxInFlightPerStatement for the statements with the given keys.
+	StatementLimits map[string]int
+}
+
+// limiterWaiter is a call waiting for a slot.
+type limiterWaiter struct {
+	priority  Priority
+	sequence  uint64
+	statement string
+	ready     chan struct{}
+	granted   bool
+}
+
+// limiter holds the slots shared by a LimitedDB and the tx handles it hands out.
+type limiter struct {
+	policy LimiterPolicy
+
+	mu        sync.Mutex
+	inFlight  int
+	perKey    map[string]int
+	waiters   []*limiterWaiter
+	sequences uint64
+}
+
+// LimitedDB is a database handle that caps the calls in flight, globally and per statement, so a burst
+// of requests queues in the application instead of exhausting the database. It is returned by
+// WithLimiter.
+//
+// Calls beyond the limits wait until a slot is free or their context is done. Waiting calls are run by
+// priority, set with ContextWithPriority, and in arrival order within a priority, so interactive requests
+// overtake queued background jobs when the database is saturated. Calls that are already running are
+// never interrupted.
+//
+// A QueryRows call holds its slot until its rows are read and closed. Query and QueryRow calls hold it
+// only until they return, and their rows are read after the slot is released, so prefer QueryRows for
+// queries whose rows take long to read. Only the calls made through the package-level Exec, Query,
+// QueryRow and QueryRows functions are limited.
+type LimitedDB struct {
+	wrappedDB
+	limiter *limiter
+}
+
+// WithLimiter wraps dbPrepExec so that the calls made with it are limited according to policy.
+//
+// Example:
+//
+//	db := dbsql.WithLimiter(sqlDB, dbsql.LimiterPolicy{
+//		MaxInFlight:     20,
+//		StatementLimits: map[string]int{"monthly_report": 2},
+//	})
+//	mappedRows, err := dbsql.QueryRows(dbsql.ContextWithPriority(ctx, dbsql.PriorityHigh), db, selectCustomer)
+func WithLimiter(dbPrepExec DBPreparerExecutor, policy LimiterPolicy) *LimitedDB {
+	statementLimits := make(map[string]int, len(policy.StatementLimits))
+	for statement, limit := range policy.StatementLimits {
+		statementLimits[statement] = limit
+	}
+	policy.StatementLimits = statementLimits
+
+	return &LimitedDB{
+		wrappedDB: wrappedDB{dbPrepExec},
+		limiter: &limiter{
+			policy: policy,
+			perKey: make(map[string]int),
+		},
+	}
+}
+
+// InFlight returns the number of calls in flight.
+func (l *LimitedDB) InFlight() int {
+	l.limiter.mu.Lock()
+	defer l.limiter.mu.Unlock()
+	return l.limiter.inFlight
+}
+
+// Waiting returns the number of calls waiting for a slot.
+func (l *LimitedDB) Waiting() int {
+	l.limiter.mu.Lock()
+	defer l.limiter.mu.Unlock()
+	return len(l.limiter.waiters)
+}
+
+// InterceptCall waits for a slot, then runs the interceptor chain of the wrapped handle, if any. It
+// returns the context's error if the context is done first.
+func (l *LimitedDB) InterceptCall(ctx context.Context, call *Call, next CallHandler) (*CallResult, error) {
+	statement := StatementKey(call.PreparedStatement)
+	if err := l.limiter.acquire(ctx, statement); err != nil {
+		return nil, err
+	}
+	defer l.limiter.release(statement)
+
+	return interceptCall(ctx, l.DBPreparerExecutor, call, next)
+}
+
+// RunInTx runs txFunc inside a transaction started on the wrapped handle. The tx handle given to txFunc
+// shares the limits.
+func (l *LimitedDB) RunInTx(ctx context.Context, opts *sql.TxOptions, txFunc TxFunc) error {
+	return WithTransaction(ctx, l.DBPreparerExecutor, opts, func(ctx context.Context, tx DBPreparerExecutor) error {
+		return txFunc(ctx, &LimitedDB{wrappedDB: wrappedDB{tx}, limiter: l.limiter})
+	})
+}
+
+// statementLimit returns the limit of the statement, or zero if it has none.
+func (l *limiter) statementLimit(statement string) int {
+	if limit, ok := l.policy.StatementLimits[statement]; ok {
+		return limit
+	}
+	return l.policy.MaxInFlightPerStatement
+}
+
+// fits reports whether a call of the statement may run now. The caller must hold the lock.
+func (l *limiter) fits(statement string) bool {
+	if l.policy.MaxInFlight > 0 && l.inFlight >= l.policy.MaxInFlight {
+		return false
+	}
+	limit := l.statementLimit(statement)
+	return limit < 1 || l.perKey[statement] < limit
+}
+
+// take takes a slot for a call of the statement. The caller must hold the lock.
+func (l *limiter) take(statement string) {
+	l.inFlight++
+	l.perKey[statement]++
+}
+
+// acquire waits for a slot for a call of the statement.
+func (l *limiter) acquire(ctx context.Context, statement string) error {
+	l.mu.Lock()
+	// Waiting calls only remain queued while they do not fit, so a call that fits overtakes no one.
+	if l.fits(statement) {
+		l.take(statement)
+		l.mu.Unlock()
+		return nil
+	}
+
+	l.sequences++
+	waiter := &limiterWaiter{
+		priority:  contextPriority(ctx),
+		sequence:  l.sequences,
+		statement: statement,
+		ready:     make(chan struct{}),
+	}
+	i := sort.Search(len(l.waiters), func(i int) bool {
+		return l.waiters[i].priority < waiter.priority
+	})
+	l.waiters = append(l.waiters, nil)
+	copy(l.waiters[i+1:], l.waiters[i:])
+	l.waiters[i] = waiter
+	l.mu.Unlock()
+
+	select {
+	case <-waiter.ready:
+		return nil
+	case <-ctx.Done():
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if waiter.granted {
+		// The slot was granted while the context was done; hand it on.
+		l.releaseLocked(statement)
+		return ctx.Err()
+	}
+
+	for i := range l.waiters {
+		if l.waiters[i] == waiter {
+			l.waiters = append(l.waiters[:i], l.waiters[i+1:]...)
+			break
+		}
+	}
+
+	return ctx.Err()
+}
+
+// release frees the slot of a call of the statement and grants it to the waiting calls that fit.
+func (l *limiter) release(statement string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.releaseLocked(statement)
+}
+
+// releaseLocked is release for a caller holding the lock.
+func (l *limiter) releaseLocked(statement string) {
+	l.inFlight--
+	if l.perKey[statement]--; l.perKey[statement] < 1 {
+		delete(l.perKey, statement)
+	}
+
+	waiters := l.waiters[:0]
+	for _, waiter := range l.waiters {
+		if l.fits(waiter.statement) {
+			l.take(waiter.statement)
+			waiter.granted = true
+			close(waiter.ready)
+			continue
+		}
+		waiters = append(waiters, waiter)
+	}
+	for i := len(waiters); i < len(l.waiters); i++ {
+		l.waiters[i] = nil
+	}
+	l.waiters = waiters
+}
+
+// wrapSession returns conn sharing the limits.
+func (l *LimitedDB) wrapSession(conn DBPreparerExecutor) DBPreparerExecutor {
+	return &LimitedDB{wrappedDB: wrappedDB{conn}, limiter: l.limiter}
+}
+
+var (
+	_ DB             = (*LimitedDB)(nil)
+	_ DBInterceptor  = (*LimitedDB)(nil)
+	_ DBTransactor   = (*LimitedDB)(nil)
+	_ sessionWrapper = (*LimitedDB)(nil)
+)
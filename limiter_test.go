@@ -0,0 +1,182 @@
+package dbsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimitedDB(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		desc      string
+		assertion func(*testing.T, string)
+	}{
+		{
+			desc: "Waiting calls run by priority, then in arrival order",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fake := NewFakeDB(t)
+
+				var mu sync.Mutex
+				var order []any
+				gate := make(chan struct{})
+				fake.ExecFunc = func(_ string, args []any) (driver.Result, error) {
+					mu.Lock()
+					order = append(order, args[0])
+					mu.Unlock()
+					<-gate
+					return driver.RowsAffected(1), nil
+				}
+
+				db := WithLimiter(sqlDB, LimiterPolicy{MaxInFlight: 1})
+
+				errs := make(chan error, 4)
+				exec := func(ctx context.Context, job string) {
+					go func() {
+						insertJob, err := PrepareStatement("INSERT INTO jobs (name) VALUES (@name)")
+						if err == nil {
+							_, err = ExecContext(ctx, db, insertJob, BindParameterValue("name", job))
+						}
+						errs <- err
+					}()
+				}
+
+				exec(context.Background(), "running")
+				require.Eventually(t, func() bool { return db.InFlight() == 1 }, time.Second, time.Millisecond, desc)
+
+				exec(ContextWithPriority(context.Background(), PriorityLow), "batch 1")
+				require.Eventually(t, func() bool { return db.Waiting() == 1 }, time.Second, time.Millisecond, desc)
+				exec(ContextWithPriority(context.Background(), PriorityLow), "batch 2")
+				require.Eventually(t, func() bool { return db.Waiting() == 2 }, time.Second, time.Millisecond, desc)
+				exec(ContextWithPriority(context.Background(), PriorityHigh), "interactive")
+				require.Eventually(t, func() bool { return db.Waiting() == 3 }, time.Second, time.Millisecond, desc)
+
+				for i := 0; i < 4; i++ {
+					gate <- struct{}{}
+					require.NoError(t, <-errs, desc)
+				}
+
+				require.Equal(t, []any{"running", "interactive", "batch 1", "batch 2"}, order, desc)
+				require.Equal(t, 0, db.InFlight(), desc)
+			},
+		},
+		{
+			desc: "QueryRows holds the slot until the rows are read",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fake := NewFakeDB(t)
+				fake.QueryFunc = func(string, []any) (driver.Rows, error) {
+					return newFakeRows([]string{"name"}, []driver.Value{"running"}, []driver.Value{"queued"}), nil
+				}
+
+				var db *LimitedDB
+				var inFlight []int
+				db = WithLimiter(WithInterceptors(sqlDB, func(ctx context.Context, call *Call, next CallHandler) (*CallResult, error) {
+					callResult, err := next(ctx, call)
+					require.Len(t, callResult.MappedRows, 2, desc)
+					inFlight = append(inFlight, db.InFlight())
+					return callResult, err
+				}), LimiterPolicy{MaxInFlight: 1})
+
+				selectJobs, err := PrepareStatement("SELECT name FROM jobs")
+				require.NoError(t, err, desc)
+
+				mappedRows, err := QueryRows(context.Background(), db, selectJobs)
+				require.NoError(t, err, desc)
+				require.Equal(t, MappedRows{{"name": "running"}, {"name": "queued"}}, mappedRows, desc)
+				require.Equal(t, []int{1}, inFlight, desc)
+				require.Equal(t, 0, db.InFlight(), desc)
+			},
+		},
+		{
+			desc: "A waiting call gives up when its context is done",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fake := NewFakeDB(t)
+				gate := make(chan struct{})
+				fake.ExecFunc = func(string, []any) (driver.Result, error) {
+					<-gate
+					return driver.RowsAffected(1), nil
+				}
+
+				db := WithLimiter(sqlDB, LimiterPolicy{MaxInFlight: 1})
+				deleteCarts, err := PrepareStatement("DELETE FROM carts")
+				require.NoError(t, err, desc)
+
+				done := make(chan error)
+				go func() {
+					_, err := ExecContext(context.Background(), db, deleteCarts)
+					done <- err
+				}()
+				require.Eventually(t, func() bool { return db.InFlight() == 1 }, time.Second, time.Millisecond, desc)
+
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+				defer cancel()
+				selectCustomers, err := PrepareStatement("SELECT * FROM customers")
+				require.NoError(t, err, desc)
+				_, err = QueryContext(ctx, db, selectCustomers)
+				require.ErrorIs(t, err, context.DeadlineExceeded, desc)
+				require.Equal(t, 0, db.Waiting(), desc)
+				require.Equal(t, 0, fake.QueryCount(), desc)
+
+				close(gate)
+				require.NoError(t, <-done, desc)
+				require.Equal(t, 0, db.InFlight(), desc)
+			},
+		},
+		{
+			desc: "A statement at its own limit does not hold up other statements",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fake := NewFakeDB(t)
+				gate := make(chan struct{})
+				fake.ExecFunc = func(query string, _ []any) (driver.Result, error) {
+					if strings.Contains(query, "reports") {
+						<-gate
+					}
+					return driver.RowsAffected(1), nil
+				}
+
+				db := WithLimiter(sqlDB, LimiterPolicy{
+					MaxInFlight:     10,
+					StatementLimits: map[string]int{"refresh_reports": 1},
+				})
+
+				done := make(chan error, 2)
+				for i := 0; i < 2; i++ {
+					go func() {
+						refreshReports, err := PrepareStatement("UPDATE reports SET refreshed_at = now()", StatementName("refresh_reports"))
+						if err == nil {
+							_, err = ExecContext(context.Background(), db, refreshReports)
+						}
+						done <- err
+					}()
+				}
+				require.Eventually(t, func() bool {
+					return db.InFlight() == 1 && db.Waiting() == 1
+				}, time.Second, time.Millisecond, desc)
+
+				deleteCarts, err := PrepareStatement("DELETE FROM carts")
+				require.NoError(t, err, desc)
+				_, err = ExecContext(context.Background(), db, deleteCarts)
+				require.NoError(t, err, desc)
+
+				close(gate)
+				require.NoError(t, <-done, desc)
+				require.NoError(t, <-done, desc)
+				require.Equal(t, 3, fake.ExecCount(), desc)
+			},
+		},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			tc.assertion(t, tc.desc)
+		})
+	}
+}
@@ -0,0 +1,345 @@
+package dbsql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/neumachen/dbsql/internal"
+)
+
+// loaderKeysParameter is the default parameter bound to the batched keys.
+const loaderKeysParameter = "ids"
+
+// LoaderOption configures a Loader.
+type LoaderOption func(loader *Loader)
+
+// LoaderWait sets how long a Loader collects keys before querying them. It defaults to 1ms.
+func LoaderWait(wait time.Duration) LoaderOption {
+	return func(loader *Loader) {
+		loader.wait = wait
+	}
+}
+
+// LoaderMaxBatch caps the number of keys queried at once; a full batch is queried without waiting.
+func LoaderMaxBatch(maxBatch int) LoaderOption {
+	return func(loader *Loader) {
+		loader.maxBatch = maxBatch
+	}
+}
+
+// LoaderKeysParameter sets the parameter bound to the array of batched keys. It defaults to "ids".
+func LoaderKeysParameter(parameter string) LoaderOption {
+	return func(loader *Loader) {
+		loader.keysParameter = parameter
+	}
+}
+
+// LoaderBinders binds the other parameters of the statement, e.g. a tenant ID, for every batch.
+func LoaderBinders(binderFuncs ...BindParameterValueFunc) LoaderOption {
+	return func(loader *Loader) {
+		loader.binderFuncs = append(loader.binderFuncs, binderFuncs...)
+	}
+}
+
+// loaderResult is the row loaded for a key, shared by every Load of the key.
+type loaderResult struct {
+	done chan struct{}
+	row  MappedRow
+	err  error
+}
+
+// loaderBatch is the keys collected for one query.
+type loaderBatch struct {
+	ctx     context.Context
+	keys    []any
+	results []*loaderResult
+	timer   *time.Timer
+}
+
+// Loader batches the rows loaded by key, so resolving N objects that each load a related row costs one
+// query instead of N. Keys requested through Load within the wait are queried together by binding them
+// as an array to the statement's @ids parameter, e.g.
+//
+//	SELECT * FROM customers WHERE customer_id = ANY(@ids)
+//
+// and the returned rows are handed back to each caller by the value of the key column. The rows loaded,
+// including keys without a row, are cached for the life of the Loader, so a Loader is meant to be created
+// per request. A Loader is safe for concurrent use.
+//
+// Example:
+//
+//	customers, err := dbsql.NewLoader(db, selectCustomersByID, "customer_id")
+//	// in every resolver
+//	customer, err := customers.Load(ctx, order.CustomerID)
+//	if errors.Is(err, sql.ErrNoRows) {
+//		// no such customer
+//	}
+type Loader struct {
+	db                DBPreparerExecutor
+	preparedStatement PreparedStatement
+	keyColumn         Column
+	keysParameter     string
+	wait              time.Duration
+	maxBatch          int
+	binderFuncs       []BindParameterValueFunc
+
+	mu      sync.Mutex
+	results map[string]*loaderResult
+	batch   *loaderBatch
+}
+
+// NewLoader returns a Loader querying the prepared statement on dbPrepExec, which must bind the keys
+// with a parameter named ids, or the one set with LoaderKeysParameter, and return the key column.
+func NewLoader(
+	dbPrepExec DBPreparerExecutor,
+	preparedStatement PreparedStatement,
+	keyColumn Column,
+	opts ...LoaderOption,
+) (
+	*Loader,
+	error,
+) {
+	if internal.IsNil(dbPrepExec) {
+		return nil, errors.New("db connection is nil")
+	}
+
+	if internal.IsNil(preparedStatement) {
+		return nil, errors.New("prepared statement is nil")
+	}
+
+	if keyColumn == "" {
+		return nil, errors.New("key column is empty")
+	}
+
+	loader := &Loader{
+		db:                dbPrepExec,
+		preparedStatement: preparedStatement,
+		keyColumn:         keyColumn,
+		keysParameter:     loaderKeysParameter,
+		wait:              time.Millisecond,
+		results:           make(map[string]*loaderResult),
+	}
+	for i := range opts {
+		opts[i](loader)
+	}
+
+	if loader.wait <= 0 {
+		return nil, errors.New("wait must be positive")
+	}
+
+	var parameters []string
+	if positions := preparedStatement.ParameterPositions(); positions != nil {
+		parameters = positions.Parameters()
+	}
+	for _, parameter := range parameters {
+		if parameter == loader.keysParameter {
+			return loader, nil
+		}
+	}
+
+	return nil, fmt.Errorf("statement has no @%s parameter", loader.keysParameter)
+}
+
+// Load returns the row of the key, or sql.ErrNoRows if there is none. The caller receives its own copy
+// of the row. The query of the batch runs detached from the caller's cancellation, so a caller giving up
+// returns the context's error without failing the other keys of the batch.
+func (l *Loader) Load(ctx context.Context, key any) (MappedRow, error) {
+	text, err := keyString(key)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = internal.InitIfNilContext(ctx)
+
+	l.mu.Lock()
+	result, ok := l.results[text]
+	if !ok {
+		result = &loaderResult{done: make(chan struct{})}
+		l.results[text] = result
+		l.enqueue(ctx, key, result)
+	}
+	l.mu.Unlock()
+
+	select {
+	case <-result.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	if result.err != nil {
+		return nil, result.err
+	}
+	return result.row.Clone(), nil
+}
+
+// LoadMany returns the rows of the keys, in the order of the keys, batching them like Load. Keys without
+// a row have a nil row; the first other error is returned.
+func (l *Loader) LoadMany(ctx context.Context, keys []any) (MappedRows, error) {
+	rows := make(MappedRows, len(keys))
+	errs := make([]error, len(keys))
+
+	var wg sync.WaitGroup
+	for i := range keys {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rows[i], errs[i] = l.Load(ctx, keys[i])
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range errs {
+		if errs[i] != nil && !errors.Is(errs[i], sql.ErrNoRows) {
+			return nil, errs[i]
+		}
+	}
+
+	return rows, nil
+}
+
+// Flush queries the keys collected so far without waiting for the rest of the wait.
+func (l *Loader) Flush() {
+	l.mu.Lock()
+	batch := l.takeBatch()
+	l.mu.Unlock()
+
+	if batch != nil {
+		l.dispatch(batch)
+	}
+}
+
+// Clear drops the cached row of the key, so the next Load queries it again.
+func (l *Loader) Clear(key any) {
+	text, err := keyString(key)
+	if err != nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if result, ok := l.results[text]; ok && isDone(result.done) {
+		delete(l.results, text)
+	}
+}
+
+// ClearAll drops every cached row.
+func (l *Loader) ClearAll() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for text, result := range l.results {
+		if isDone(result.done) {
+			delete(l.results, text)
+		}
+	}
+}
+
+// enqueue adds the key to the batch being collected. The caller must hold the lock.
+func (l *Loader) enqueue(ctx context.Context, key any, result *loaderResult) {
+	if l.batch == nil {
+		batch := &loaderBatch{ctx: context.WithoutCancel(ctx)}
+		batch.timer = time.AfterFunc(l.wait, func() {
+			l.mu.Lock()
+			if l.batch != batch {
+				// The batch was dispatched because it was full or flushed.
+				l.mu.Unlock()
+				return
+			}
+			l.batch = nil
+			l.mu.Unlock()
+
+			l.dispatch(batch)
+		})
+		l.batch = batch
+	}
+
+	l.batch.keys = append(l.batch.keys, key)
+	l.batch.results = append(l.batch.results, result)
+
+	if l.maxBatch > 0 && len(l.batch.keys) >= l.maxBatch {
+		batch := l.takeBatch()
+		go l.dispatch(batch)
+	}
+}
+
+// takeBatch removes the batch being collected and returns it, or nil. The caller must hold the lock.
+func (l *Loader) takeBatch() *loaderBatch {
+	batch := l.batch
+	if batch != nil {
+		batch.timer.Stop()
+		l.batch = nil
+	}
+	return batch
+}
+
+// dispatch queries the keys of the batch and hands the rows to their results.
+func (l *Loader) dispatch(batch *loaderBatch) {
+	rows, err := l.query(batch)
+
+	byKey := make(map[string]MappedRow, len(rows))
+	for _, row := range rows {
+		value, ok := row.Get(l.keyColumn)
+		if !ok {
+			err = fmt.Errorf("key column %s is missing from the rows", l.keyColumn)
+			break
+		}
+		text, keyErr := keyString(value)
+		if keyErr != nil {
+			err = keyErr
+			break
+		}
+		if _, ok := byKey[text]; !ok {
+			byKey[text] = row
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for i, result := range batch.results {
+		switch text, _ := keyString(batch.keys[i]); {
+		case err != nil:
+			// Errors are not cached, so the key is queried again by the next Load.
+			result.err = err
+			if l.results[text] == result {
+				delete(l.results, text)
+			}
+		case byKey[text] == nil:
+			result.err = sql.ErrNoRows
+		default:
+			result.row = byKey[text]
+		}
+		close(result.done)
+	}
+}
+
+// query runs the statement with the keys of the batch.
+func (l *Loader) query(batch *loaderBatch) (MappedRows, error) {
+	// Batches may run concurrently, so each binds its keys on its own copy of the statement.
+	preparedStatement, err := copyPreparedStatement(l.preparedStatement)
+	if err != nil {
+		return nil, err
+	}
+
+	binderFuncs := make([]BindParameterValueFunc, 0, len(l.binderFuncs)+1)
+	binderFuncs = append(binderFuncs, l.binderFuncs...)
+	binderFuncs = append(binderFuncs, BindParameterValue(l.keysParameter, pq.Array(batch.keys)))
+
+	return QueryRows(batch.ctx, l.db, preparedStatement, binderFuncs...)
+}
+
+// isDone reports whether the channel is closed.
+func isDone(done <-chan struct{}) bool {
+	select {
+	case <-done:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,161 @@
+package dbsql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoader(t *testing.T) {
+	t.Parallel()
+
+	newLoader := func(t *testing.T, opts ...LoaderOption) (*Loader, *fakeDriver) {
+		sqlDB, fake := NewFakeDB(t)
+		fake.QueryFunc = func(_ string, args []any) (driver.Rows, error) {
+			rows := newFakeRows([]string{"customer_id", "first_name"})
+			for _, id := range args[len(args)-1].(pq.GenericArray).A.([]any) {
+				// Customer 2 does not exist.
+				if id != 2 {
+					rows.values = append(rows.values, []driver.Value{int64(id.(int)), "John"})
+				}
+			}
+			return rows, nil
+		}
+
+		selectCustomers, err := PrepareStatement(
+			"SELECT * FROM customers WHERE tenant_id = @tenant_id AND customer_id = ANY(@ids)",
+		)
+		require.NoError(t, err)
+
+		opts = append([]LoaderOption{LoaderBinders(BindParameterValue("tenant_id", "acme"))}, opts...)
+		loader, err := NewLoader(sqlDB, selectCustomers, "customer_id", opts...)
+		require.NoError(t, err)
+		return loader, fake
+	}
+
+	// pending returns the number of keys loaded or being loaded.
+	pending := func(loader *Loader) int {
+		loader.mu.Lock()
+		defer loader.mu.Unlock()
+		return len(loader.results)
+	}
+
+	type result struct {
+		row MappedRow
+		err error
+	}
+
+	tests := []struct {
+		desc      string
+		assertion func(*testing.T, string)
+	}{
+		{
+			desc: "Keys loaded together are queried at once and cached",
+			assertion: func(t *testing.T, desc string) {
+				loader, fake := newLoader(t, LoaderWait(time.Hour))
+
+				results := make([]chan result, 4)
+				for i, id := range []int{1, 2, 3, 2} {
+					results[i] = make(chan result, 1)
+					go func(id int, results chan<- result) {
+						row, err := loader.Load(context.Background(), id)
+						results <- result{row: row, err: err}
+					}(id, results[i])
+				}
+				require.Eventually(t, func() bool { return pending(loader) == 3 }, time.Second, time.Millisecond, desc)
+
+				loader.Flush()
+				first := <-results[0]
+				require.NoError(t, first.err, desc)
+				require.Equal(t, MappedRow{"customer_id": int64(1), "first_name": "John"}, first.row, desc)
+				require.ErrorIs(t, (<-results[1]).err, sql.ErrNoRows, desc)
+				require.NoError(t, (<-results[2]).err, desc)
+				require.ErrorIs(t, (<-results[3]).err, sql.ErrNoRows, desc)
+
+				require.Equal(t, 1, fake.QueryCount(), desc)
+				require.Equal(t, "acme", fake.LastQuery().Args[0], desc)
+
+				row, err := loader.Load(context.Background(), int64(1))
+				require.NoError(t, err, desc)
+				require.Equal(t, first.row, row, desc)
+				require.Equal(t, 1, fake.QueryCount(), desc)
+
+				loader.Clear(1)
+				reloaded := make(chan result, 1)
+				go func() {
+					row, err := loader.Load(context.Background(), 1)
+					reloaded <- result{row: row, err: err}
+				}()
+				require.Eventually(t, func() bool {
+					loader.mu.Lock()
+					defer loader.mu.Unlock()
+					return loader.batch != nil
+				}, time.Second, time.Millisecond, desc)
+				loader.Flush()
+				require.NoError(t, (<-reloaded).err, desc)
+				require.Equal(t, 2, fake.QueryCount(), desc)
+			},
+		},
+		{
+			desc: "Full batches are queried without waiting",
+			assertion: func(t *testing.T, desc string) {
+				loader, fake := newLoader(t, LoaderWait(time.Hour), LoaderMaxBatch(2))
+
+				rows, err := loader.LoadMany(context.Background(), []any{1, 2, 3, 4})
+				require.NoError(t, err, desc)
+				require.Len(t, rows, 4, desc)
+				require.Equal(t, int64(1), rows[0]["customer_id"], desc)
+				require.Nil(t, rows[1], desc)
+				require.Equal(t, int64(4), rows[3]["customer_id"], desc)
+				require.Equal(t, 2, fake.QueryCount(), desc)
+			},
+		},
+		{
+			desc: "Keys are queried after the wait and errors are not cached",
+			assertion: func(t *testing.T, desc string) {
+				loader, fake := newLoader(t)
+				queryFunc := fake.QueryFunc
+				fake.QueryFunc = func(string, []any) (driver.Rows, error) {
+					return nil, errors.New("connection refused")
+				}
+
+				_, err := loader.Load(context.Background(), 1)
+				require.EqualError(t, err, "connection refused", desc)
+
+				fake.QueryFunc = queryFunc
+				row, err := loader.Load(context.Background(), 1)
+				require.NoError(t, err, desc)
+				require.Equal(t, int64(1), row["customer_id"], desc)
+				require.Equal(t, 2, fake.QueryCount(), desc)
+			},
+		},
+		{
+			desc: "NewLoader fails without the keys parameter",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, _ := NewFakeDB(t)
+				selectCustomers, err := PrepareStatement("SELECT * FROM customers WHERE customer_id = ANY(@customer_ids)")
+				require.NoError(t, err, desc)
+
+				_, err = NewLoader(sqlDB, selectCustomers, "customer_id")
+				require.EqualError(t, err, "statement has no @ids parameter", desc)
+
+				_, err = NewLoader(sqlDB, selectCustomers, "customer_id", LoaderKeysParameter("customer_ids"))
+				require.NoError(t, err, desc)
+			},
+		},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			tc.assertion(t, tc.desc)
+		})
+	}
+}
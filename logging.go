@@ -0,0 +1,168 @@
+package dbsql
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// RedactedValue is the value logged in place of a redacted parameter.
+const RedactedValue = "[REDACTED]"
+
+// RedactFunc returns the value to log in place of a sensitive parameter value.
+type RedactFunc func(value any) any
+
+// LoggingOption configures the interceptor returned by LoggingInterceptor.
+type LoggingOption func(config *loggingConfig)
+
+// loggingConfig holds the configuration of a logging interceptor.
+type loggingConfig struct {
+	slowThreshold time.Duration
+	redactions    map[string]RedactFunc
+}
+
+// LogSlowStatements logs every statement that takes at least threshold to complete.
+// A threshold of zero or less disables slow statement logging, which is the default.
+func LogSlowStatements(threshold time.Duration) LoggingOption {
+	return func(config *loggingConfig) {
+		config.slowThreshold = threshold
+	}
+}
+
+// RedactParameters replaces the logged values of the named parameters with RedactedValue.
+func RedactParameters(parameters ...string) LoggingOption {
+	return func(config *loggingConfig) {
+		for i := range parameters {
+			config.redactions[parameters[i]] = redactValue
+		}
+	}
+}
+
+// RedactParameterFunc logs the value returned by redactFunc in place of the named parameter's value.
+//
+// Example:
+//
+//	dbsql.LoggingInterceptor(logger, dbsql.RedactParameterFunc("email_address", dbsql.RedactEmailAddress))
+func RedactParameterFunc(parameter string, redactFunc RedactFunc) LoggingOption {
+	return func(config *loggingConfig) {
+		if redactFunc == nil {
+			redactFunc = redactValue
+		}
+		config.redactions[parameter] = redactFunc
+	}
+}
+
+// RedactEmailAddress is a RedactFunc that keeps the first character, not byte, of the local part and the domain
+// of an email address, e.g. "john.doe@example.com" is logged as "j***@example.com". Values that are
+// not strings containing an '@' are replaced with RedactedValue.
+func RedactEmailAddress(value any) any {
+	emailAddress, ok := value.(string)
+	if !ok {
+		return RedactedValue
+	}
+
+	at := strings.LastIndexByte(emailAddress, '@')
+	if at < 1 {
+		return RedactedValue
+	}
+
+	_, size := utf8.DecodeRuneInString(emailAddress)
+	return emailAddress[:size] + "***" + emailAddress[at:]
+}
+
+func redactValue(any) any {
+	return RedactedValue
+}
+
+// LoggingInterceptor returns an Interceptor that logs failing statements at slog.LevelError and, when
+// enabled with LogSlowStatements, slow statements at slog.LevelWarn. Each record carries the operation,
+// the unprepared statement, the bound values keyed by parameter name, the duration, the rows affected
+// for Exec calls and the error, if any. A nil logger uses slog.Default().
+//
+// For Query calls the duration covers the time until the rows are returned, not the time spent reading them.
+//
+// Example:
+//
+//	db := dbsql.WithInterceptors(
+//		sqlDB,
+//		dbsql.LoggingInterceptor(
+//			logger,
+//			dbsql.LogSlowStatements(200*time.Millisecond),
+//			dbsql.RedactParameters("password"),
+//			dbsql.RedactParameterFunc("email_address", dbsql.RedactEmailAddress),
+//		),
+//	)
+func LoggingInterceptor(logger *slog.Logger, opts ...LoggingOption) Interceptor {
+	config := &loggingConfig{
+		redactions: make(map[string]RedactFunc),
+	}
+	for i := range opts {
+		opts[i](config)
+	}
+
+	return func(ctx context.Context, call *Call, next CallHandler) (*CallResult, error) {
+		start := time.Now()
+		callResult, err := next(ctx, call)
+		duration := time.Since(start)
+
+		slow := config.slowThreshold > 0 && duration >= config.slowThreshold
+		if err == nil && !slow {
+			return callResult, err
+		}
+
+		log := logger
+		if log == nil {
+			log = slog.Default()
+		}
+
+		level, msg := slog.LevelWarn, "slow statement"
+		if err != nil {
+			level, msg = slog.LevelError, "statement failed"
+		}
+		if !log.Enabled(ctx, level) {
+			return callResult, err
+		}
+
+		attrs := []slog.Attr{
+			slog.String("operation", call.Operation.String()),
+			slog.String("statement", call.PreparedStatement.UnpreparedStatement()),
+			config.parametersAttr(call.PreparedStatement),
+			slog.Duration("duration", duration),
+		}
+		if callResult != nil && callResult.Result != nil {
+			if rowsAffected, rowsErr := callResult.Result.RowsAffected(); rowsErr == nil {
+				attrs = append(attrs, slog.Int64("rows_affected", rowsAffected))
+			}
+		}
+		if err != nil {
+			attrs = append(attrs, slog.Any("error", err))
+		}
+
+		log.LogAttrs(ctx, level, msg, attrs...)
+
+		return callResult, err
+	}
+}
+
+// parametersAttr returns a group attribute with the redacted bound values keyed by parameter name.
+func (l *loggingConfig) parametersAttr(preparedStatement PreparedStatement) slog.Attr {
+	namedValues := BoundNamedParameterValues(preparedStatement)
+
+	var parameters []string
+	if positions := preparedStatement.ParameterPositions(); positions != nil {
+		parameters = positions.Parameters()
+	}
+
+	attrs := make([]any, 0, len(parameters))
+	for _, parameter := range parameters {
+		value := namedValues[parameter]
+		if redactFunc, ok := l.redactions[parameter]; ok {
+			value = redactFunc(value)
+		}
+		attrs = append(attrs, slog.Any(parameter, value))
+	}
+
+	return slog.Group("parameters", attrs...)
+}
@@ -0,0 +1,155 @@
+package dbsql
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoggingInterceptor(t *testing.T) {
+	t.Parallel()
+
+	const insertQuery = "INSERT INTO email_addresses (customer_id, email_address, password) VALUES (@customer_id, @email_address, @password)"
+
+	tests := []struct {
+		desc      string
+		assertion func(*testing.T, string)
+	}{
+		{
+			desc: "Failing statements are logged with named and redacted parameters",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fd := NewFakeDB(t)
+				fd.ExecFunc = func(string, []any) (driver.Result, error) {
+					return nil, errors.New("duplicate key value violates unique constraint")
+				}
+
+				buf := &bytes.Buffer{}
+				db := WithInterceptors(
+					sqlDB,
+					LoggingInterceptor(
+						slog.New(slog.NewJSONHandler(buf, nil)),
+						RedactParameters("password"),
+						RedactParameterFunc("email_address", RedactEmailAddress),
+					),
+				)
+
+				preparedStatement, err := PrepareStatement(insertQuery)
+				require.NoError(t, err, desc)
+
+				_, err = ExecContext(
+					context.Background(),
+					db,
+					preparedStatement,
+					BindParameterValue("customer_id", 42),
+					BindParameterValue("email_address", "john.doe@example.com"),
+					BindParameterValue("password", "hunter2"),
+				)
+				require.Error(t, err, desc)
+
+				record := map[string]any{}
+				require.NoError(t, json.Unmarshal(buf.Bytes(), &record), desc)
+				require.Equal(t, "ERROR", record["level"], desc)
+				require.Equal(t, "statement failed", record["msg"], desc)
+				require.Equal(t, "exec", record["operation"], desc)
+				require.Equal(t, insertQuery, record["statement"], desc)
+				require.Equal(t, "duplicate key value violates unique constraint", record["error"], desc)
+				require.Equal(
+					t,
+					map[string]any{
+						"customer_id":   float64(42),
+						"email_address": "j***@example.com",
+						"password":      RedactedValue,
+					},
+					record["parameters"],
+					desc,
+				)
+			},
+		},
+		{
+			desc: "Slow statements are logged with the rows affected",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fd := NewFakeDB(t)
+				fd.ExecFunc = func(string, []any) (driver.Result, error) {
+					time.Sleep(5 * time.Millisecond)
+					return driver.RowsAffected(3), nil
+				}
+
+				buf := &bytes.Buffer{}
+				db := WithInterceptors(
+					sqlDB,
+					LoggingInterceptor(slog.New(slog.NewJSONHandler(buf, nil)), LogSlowStatements(time.Millisecond)),
+				)
+
+				preparedStatement, err := PrepareStatement("DELETE FROM customers WHERE last_name = @last_name")
+				require.NoError(t, err, desc)
+
+				_, err = ExecContext(context.Background(), db, preparedStatement, BindParameterValue("last_name", "Doe"))
+				require.NoError(t, err, desc)
+
+				record := map[string]any{}
+				require.NoError(t, json.Unmarshal(buf.Bytes(), &record), desc)
+				require.Equal(t, "WARN", record["level"], desc)
+				require.Equal(t, "slow statement", record["msg"], desc)
+				require.Equal(t, float64(3), record["rows_affected"], desc)
+				require.Equal(t, map[string]any{"last_name": "Doe"}, record["parameters"], desc)
+				require.NotContains(t, record, "error", desc)
+			},
+		},
+		{
+			desc: "Fast successful statements are not logged",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, _ := NewFakeDB(t)
+
+				buf := &bytes.Buffer{}
+				db := WithInterceptors(
+					sqlDB,
+					LoggingInterceptor(slog.New(slog.NewJSONHandler(buf, nil)), LogSlowStatements(time.Hour)),
+				)
+
+				preparedStatement, err := PrepareStatement("DELETE FROM customers")
+				require.NoError(t, err, desc)
+
+				_, err = ExecContext(context.Background(), db, preparedStatement)
+				require.NoError(t, err, desc)
+				require.Empty(t, buf.String(), desc)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			test.assertion(t, test.desc)
+		})
+	}
+}
+
+func TestRedactEmailAddress(t *testing.T) {
+	tests := []struct {
+		Value    any
+		Redacted any
+	}{
+		{Value: "john.doe@example.com", Redacted: "j***@example.com"},
+		{Value: "émile@example.fr", Redacted: "é***@example.fr"},
+		{Value: "张伟@example.cn", Redacted: "张***@example.cn"},
+		{Value: "@example.com", Redacted: RedactedValue},
+		{Value: "john.doe", Redacted: RedactedValue},
+		{Value: 42, Redacted: RedactedValue},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprint(test.Value), func(t *testing.T) {
+			redacted := RedactEmailAddress(test.Value)
+			require.Equal(t, test.Redacted, redacted)
+			require.True(t, utf8.ValidString(redacted.(string)))
+		})
+	}
+}
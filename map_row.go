@@ -32,7 +32,25 @@ func (m MappedRow) Get(column Column) (any, bool) {
 	return v, ok
 }
 
+// Clone returns a copy of the MappedRow. []byte values are copied, so the copy shares no memory with m.
+func (m MappedRow) Clone() MappedRow {
+	if m == nil {
+		return nil
+	}
+
+	clone := make(MappedRow, len(m))
+	for column, value := range m {
+		if b, ok := value.([]byte); ok {
+			value = append([]byte(nil), b...)
+		}
+		clone[column] = value
+	}
+
+	return clone
+}
+
 // MapRow maps the columns and values of the given sql.Row to a MappedRow.
+// Errors reported by the database are classified with ClassifyError.
 func MapRow(row *sql.Row, columns Columns) (MappedRow, error) {
 	values := make([]any, len(columns))
 	for i := range values {
@@ -41,7 +59,7 @@ func MapRow(row *sql.Row, columns Columns) (MappedRow, error) {
 
 	err := row.Scan(values...)
 	if err != nil {
-		return nil, err
+		return nil, ClassifyError(err)
 	}
 
 	rowData := make(MappedRow)
@@ -15,7 +15,22 @@ func (m MappedRows) Columns() Columns {
 	return m[0].Columns()
 }
 
+// Clone returns a copy of the MappedRows in which every row is cloned with MappedRow.Clone.
+func (m MappedRows) Clone() MappedRows {
+	if m == nil {
+		return nil
+	}
+
+	clone := make(MappedRows, len(m))
+	for i := range m {
+		clone[i] = m[i].Clone()
+	}
+
+	return clone
+}
+
 // MapRows maps the columns and values of the given sql.Rows to a MappedRows.
+// Errors reported by the database, including those encountered while iterating, are classified with ClassifyError.
 func MapRows(rows *sql.Rows) (MappedRows, error) {
 	columns, err := rows.Columns()
 	if err != nil {
@@ -35,7 +50,7 @@ func MapRows(rows *sql.Rows) (MappedRows, error) {
 		}
 
 		if err := rows.Scan(valuePtrs...); err != nil {
-			return nil, err
+			return nil, ClassifyError(err)
 		}
 
 		// Create a map to store the column-value pairs for the current row
@@ -56,5 +71,9 @@ func MapRows(rows *sql.Rows) (MappedRows, error) {
 		result = append(result, rowMap)
 	}
 
+	if err := rows.Err(); err != nil {
+		return nil, ClassifyError(err)
+	}
+
 	return result, nil
 }
@@ -0,0 +1,280 @@
+package dbsql
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultLatencyBuckets are the upper bounds of the latency histogram used when NewMetrics is given none.
+var DefaultLatencyBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// StatementKey returns the key a statement is tracked under: its name if it has one, otherwise the
+// Fingerprint of its revised SQL.
+func StatementKey(preparedStatement PreparedStatement) string {
+	if name := statementName(preparedStatement); name != "" {
+		return name
+	}
+	return Fingerprint(preparedStatement.Revised())
+}
+
+// LatencyBucket is a single bucket of a latency histogram.
+type LatencyBucket struct {
+	// UpperBound is the inclusive upper bound of the bucket. The last bucket has an UpperBound of zero
+	// and counts every call slower than the previous bucket.
+	UpperBound time.Duration
+	// Count is the number of calls that fell into the bucket.
+	Count int64
+}
+
+// StatementMetrics is a snapshot of the counters collected for a single statement.
+type StatementMetrics struct {
+	// Statement is the key the statement is tracked under, see StatementKey.
+	Statement string
+	// Calls is the number of calls made with the statement.
+	Calls int64
+	// Errors is the number of calls that returned an error.
+	Errors int64
+	// RowsAffected is the total number of rows affected by Exec calls.
+	RowsAffected int64
+	// RowsReturned is the total number of rows returned by QueryRows calls. The rows of Query calls are
+	// read after the call returns and are not counted.
+	RowsReturned int64
+	// TotalDuration is the cumulative latency of all calls.
+	TotalDuration time.Duration
+	// MaxDuration is the latency of the slowest call.
+	MaxDuration time.Duration
+	// Histogram is the latency distribution of all calls.
+	Histogram []LatencyBucket
+}
+
+// MeanDuration returns the average latency of the statement's calls.
+func (s StatementMetrics) MeanDuration() time.Duration {
+	if s.Calls < 1 {
+		return 0
+	}
+	return s.TotalDuration / time.Duration(s.Calls)
+}
+
+// Metrics collects per-statement counters for the calls made through its Interceptor.
+// Statements are keyed by StatementKey. The counters can be pulled with Snapshot or Statement, and
+// Metrics implements expvar.Var so it can be published with expvar.Publish or Publish.
+//
+// Example:
+//
+//	metrics := dbsql.NewMetrics()
+//	metrics.Publish("dbsql_statements")
+//	db := dbsql.WithInterceptors(sqlDB, metrics.Interceptor())
+type Metrics struct {
+	mu         sync.Mutex
+	buckets    []time.Duration
+	statements map[string]*statementCounters
+}
+
+// statementCounters holds the counters of a single statement. It is guarded by Metrics.mu.
+type statementCounters struct {
+	calls         int64
+	errors        int64
+	rowsAffected  int64
+	rowsReturned  int64
+	totalDuration time.Duration
+	maxDuration   time.Duration
+	histogram     []int64
+}
+
+// NewMetrics returns an empty Metrics whose latency histogram uses the given bucket upper bounds, or
+// DefaultLatencyBuckets if none are given.
+func NewMetrics(buckets ...time.Duration) *Metrics {
+	if len(buckets) < 1 {
+		buckets = DefaultLatencyBuckets
+	}
+
+	sorted := make([]time.Duration, len(buckets))
+	copy(sorted, buckets)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	return &Metrics{
+		buckets:    sorted,
+		statements: make(map[string]*statementCounters),
+	}
+}
+
+// Interceptor returns an Interceptor that records the latency, outcome and rows affected or returned of
+// every call.
+// For Query calls the latency covers the time until the rows are returned, not the time spent reading them;
+// for QueryRows calls it covers both.
+func (m *Metrics) Interceptor() Interceptor {
+	return func(ctx context.Context, call *Call, next CallHandler) (*CallResult, error) {
+		start := time.Now()
+		callResult, err := next(ctx, call)
+
+		var rowsAffected, rowsReturned int64
+		if err == nil && callResult != nil {
+			if callResult.Result != nil {
+				if affected, rowsErr := callResult.Result.RowsAffected(); rowsErr == nil {
+					rowsAffected = affected
+				}
+			}
+			rowsReturned = int64(len(callResult.MappedRows))
+		}
+
+		m.Record(StatementKey(call.PreparedStatement), time.Since(start), rowsAffected, rowsReturned, err)
+
+		return callResult, err
+	}
+}
+
+// Record adds a single call to the counters of the statement tracked under key.
+func (m *Metrics) Record(key string, duration time.Duration, rowsAffected, rowsReturned int64, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	counters, ok := m.statements[key]
+	if !ok {
+		counters = &statementCounters{histogram: make([]int64, len(m.buckets)+1)}
+		m.statements[key] = counters
+	}
+
+	counters.calls++
+	if err != nil {
+		counters.errors++
+	}
+	counters.rowsAffected += rowsAffected
+	counters.rowsReturned += rowsReturned
+	counters.totalDuration += duration
+	if duration > counters.maxDuration {
+		counters.maxDuration = duration
+	}
+	counters.histogram[sort.Search(len(m.buckets), func(i int) bool { return m.buckets[i] >= duration })]++
+}
+
+// Statement returns a snapshot of the counters of the statement tracked under key.
+func (m *Metrics) Statement(key string) (StatementMetrics, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	counters, ok := m.statements[key]
+	if !ok {
+		return StatementMetrics{}, false
+	}
+	return m.snapshot(key, counters), true
+}
+
+// Snapshot returns a snapshot of the counters of every statement, ordered by statement key.
+func (m *Metrics) Snapshot() []StatementMetrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snapshots := make([]StatementMetrics, 0, len(m.statements))
+	for key, counters := range m.statements {
+		snapshots = append(snapshots, m.snapshot(key, counters))
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Statement < snapshots[j].Statement })
+
+	return snapshots
+}
+
+// Reset discards the counters of every statement.
+func (m *Metrics) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.statements = make(map[string]*statementCounters)
+}
+
+// Publish publishes the metrics with expvar under name. Like expvar.Publish, it panics if name is
+// already in use.
+func (m *Metrics) Publish(name string) {
+	expvar.Publish(name, m)
+}
+
+// String returns the metrics as a JSON object keyed by statement. It implements expvar.Var.
+func (m *Metrics) String() string {
+	type bucketJSON struct {
+		LessOrEqual string `json:"le"`
+		Count       int64  `json:"count"`
+	}
+	type statementJSON struct {
+		Calls           int64        `json:"calls"`
+		Errors          int64        `json:"errors"`
+		RowsAffected    int64        `json:"rows_affected"`
+		RowsReturned    int64        `json:"rows_returned"`
+		TotalDurationMS float64      `json:"total_duration_ms"`
+		MeanDurationMS  float64      `json:"mean_duration_ms"`
+		MaxDurationMS   float64      `json:"max_duration_ms"`
+		Histogram       []bucketJSON `json:"histogram"`
+	}
+
+	snapshots := m.Snapshot()
+	statements := make(map[string]statementJSON, len(snapshots))
+	for _, snapshot := range snapshots {
+		histogram := make([]bucketJSON, len(snapshot.Histogram))
+		for i, bucket := range snapshot.Histogram {
+			histogram[i] = bucketJSON{LessOrEqual: "+Inf", Count: bucket.Count}
+			if bucket.UpperBound > 0 {
+				histogram[i].LessOrEqual = bucket.UpperBound.String()
+			}
+		}
+
+		statements[snapshot.Statement] = statementJSON{
+			Calls:           snapshot.Calls,
+			Errors:          snapshot.Errors,
+			RowsAffected:    snapshot.RowsAffected,
+			RowsReturned:    snapshot.RowsReturned,
+			TotalDurationMS: durationMilliseconds(snapshot.TotalDuration),
+			MeanDurationMS:  durationMilliseconds(snapshot.MeanDuration()),
+			MaxDurationMS:   durationMilliseconds(snapshot.MaxDuration),
+			Histogram:       histogram,
+		}
+	}
+
+	b, err := json.Marshal(statements)
+	if err != nil {
+		return "{}"
+	}
+	return string(b)
+}
+
+// snapshot copies counters into a StatementMetrics. It must be called with m.mu held.
+func (m *Metrics) snapshot(key string, counters *statementCounters) StatementMetrics {
+	histogram := make([]LatencyBucket, len(counters.histogram))
+	for i := range counters.histogram {
+		histogram[i].Count = counters.histogram[i]
+		if i < len(m.buckets) {
+			histogram[i].UpperBound = m.buckets[i]
+		}
+	}
+
+	return StatementMetrics{
+		Statement:     key,
+		Calls:         counters.calls,
+		Errors:        counters.errors,
+		RowsAffected:  counters.rowsAffected,
+		RowsReturned:  counters.rowsReturned,
+		TotalDuration: counters.totalDuration,
+		MaxDuration:   counters.maxDuration,
+		Histogram:     histogram,
+	}
+}
+
+func durationMilliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+var _ expvar.Var = (*Metrics)(nil)
@@ -0,0 +1,82 @@
+package dbsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	t.Parallel()
+
+	sqlDB, fd := NewFakeDB(t)
+	fd.ExecFunc = func(query string, _ []any) (driver.Result, error) {
+		if query == "DELETE FROM customers WHERE customer_id = $1" {
+			return nil, errors.New("mock error")
+		}
+		return driver.RowsAffected(2), nil
+	}
+	fd.QueryFunc = func(string, []any) (driver.Rows, error) {
+		return newFakeRows([]string{"customer_id"}, []driver.Value{int64(1)}, []driver.Value{int64(2)}), nil
+	}
+
+	metrics := NewMetrics(time.Hour)
+	db := WithInterceptors(sqlDB, metrics.Interceptor())
+
+	named, err := PrepareStatement("UPDATE customers SET last_name = @last_name", StatementName("update_last_name"))
+	require.NoError(t, err)
+	unnamed, err := PrepareStatement("DELETE FROM customers WHERE customer_id = @customer_id")
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		_, err = ExecContext(context.Background(), db, named, BindParameterValue("last_name", "Doe"))
+		require.NoError(t, err)
+	}
+	_, err = ExecContext(context.Background(), db, unnamed, BindParameterValue("customer_id", 1))
+	require.Error(t, err)
+
+	read, err := PrepareStatement("SELECT customer_id FROM customers", StatementName("select_customers"))
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		mappedRows, err := QueryRows(context.Background(), db, read)
+		require.NoError(t, err)
+		require.Len(t, mappedRows, 2)
+	}
+
+	snapshot, ok := metrics.Statement("update_last_name")
+	require.True(t, ok)
+	require.Equal(t, int64(3), snapshot.Calls)
+	require.Equal(t, int64(0), snapshot.Errors)
+	require.Equal(t, int64(6), snapshot.RowsAffected)
+	require.Equal(t, int64(0), snapshot.RowsReturned)
+	require.Len(t, snapshot.Histogram, 2)
+	require.Equal(t, time.Hour, snapshot.Histogram[0].UpperBound)
+	require.Equal(t, int64(3), snapshot.Histogram[0].Count)
+
+	snapshot, ok = metrics.Statement("delete from customers where customer_id = ?")
+	require.True(t, ok)
+	require.Equal(t, int64(1), snapshot.Calls)
+	require.Equal(t, int64(1), snapshot.Errors)
+
+	snapshot, ok = metrics.Statement("select_customers")
+	require.True(t, ok)
+	require.Equal(t, int64(2), snapshot.Calls)
+	require.Equal(t, int64(0), snapshot.RowsAffected)
+	require.Equal(t, int64(4), snapshot.RowsReturned)
+
+	require.Len(t, metrics.Snapshot(), 3)
+
+	published := map[string]map[string]any{}
+	require.NoError(t, json.Unmarshal([]byte(metrics.String()), &published))
+	require.Equal(t, float64(3), published["update_last_name"]["calls"])
+	require.Equal(t, float64(6), published["update_last_name"]["rows_affected"])
+	require.Equal(t, float64(4), published["select_customers"]["rows_returned"])
+
+	metrics.Reset()
+	require.Empty(t, metrics.Snapshot())
+}
@@ -0,0 +1,341 @@
+package dbsql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/neumachen/dbsql/internal"
+)
+
+// MaxStatementParameters is the maximum number of parameters PostgreSQL accepts in a single statement.
+const MaxStatementParameters = 65535
+
+// MultiRowInsertOption configures a MultiRowInsert.
+type MultiRowInsertOption func(insert *MultiRowInsert)
+
+// MultiRowInsertMaxParameters lowers the number of parameters per statement, and so the number of rows
+// per chunk, below MaxStatementParameters.
+func MultiRowInsertMaxParameters(maxParameters int) MultiRowInsertOption {
+	return func(insert *MultiRowInsert) {
+		insert.maxParameters = maxParameters
+	}
+}
+
+// MultiRowInsert builds multi-row INSERT ... VALUES (...), (...) statements from a row template with
+// named parameters, for inserts that need ON CONFLICT or RETURNING and so cannot use CopyFrom.
+//
+// The statement is split into chunks of as many rows as fit in the parameter limit. Parameters of the
+// row template are bound separately for every row; parameters of the insert and suffix are shared by
+// all rows.
+//
+// Example:
+//
+//	insert, err := dbsql.NewMultiRowInsert(
+//		"INSERT INTO customers (first_name, last_name)",
+//		"(@first_name, @last_name)",
+//		"ON CONFLICT DO NOTHING RETURNING customer_id",
+//	)
+//	mappedRows, err := insert.QueryContext(ctx, db, bindSets)
+type MultiRowInsert struct {
+	insert           string
+	suffix           string
+	rowSegments      []string
+	rowParameters    []string
+	isRowParameter   map[string]bool
+	sharedParameters int
+	maxParameters    int
+}
+
+// NewMultiRowInsert returns a MultiRowInsert for the INSERT statement, up to but excluding the VALUES
+// keyword, the row template, e.g. "(@first_name, @last_name)", and an optional suffix such as an
+// ON CONFLICT or RETURNING clause.
+func NewMultiRowInsert(
+	insert string,
+	rowTemplate string,
+	suffix string,
+	opts ...MultiRowInsertOption,
+) (
+	*MultiRowInsert,
+	error,
+) {
+	if statementCommand(insert) != "INSERT" {
+		return nil, errors.New("insert must be an INSERT statement")
+	}
+
+	multiRowInsert := &MultiRowInsert{
+		insert:        strings.TrimSpace(insert),
+		suffix:        strings.TrimSpace(suffix),
+		maxParameters: MaxStatementParameters,
+	}
+	for i := range opts {
+		opts[i](multiRowInsert)
+	}
+
+	if multiRowInsert.maxParameters < 1 || multiRowInsert.maxParameters > MaxStatementParameters {
+		return nil, fmt.Errorf("max parameters must be between 1 and %d", MaxStatementParameters)
+	}
+
+	if err := multiRowInsert.parseRowTemplate(strings.TrimSpace(rowTemplate)); err != nil {
+		return nil, err
+	}
+
+	for _, statement := range []string{multiRowInsert.insert, multiRowInsert.suffix} {
+		for _, token := range lexSQL(statement) {
+			if token.kind != sqlTokenPlaceholder {
+				continue
+			}
+			if token.text[0] != parameterPrefix {
+				return nil, errors.New("insert and suffix must use named parameters")
+			}
+			multiRowInsert.sharedParameters++
+		}
+	}
+
+	if multiRowInsert.rowsPerStatement() < 1 {
+		return nil, fmt.Errorf("a single row does not fit in %d parameters", multiRowInsert.maxParameters)
+	}
+
+	return multiRowInsert, nil
+}
+
+// parseRowTemplate splits the row template into the text around its parameters.
+func (m *MultiRowInsert) parseRowTemplate(rowTemplate string) error {
+	tokens := lexSQL(rowTemplate)
+	if len(tokens) < 2 || tokens[0].text != "(" || tokens[len(tokens)-1].text != ")" {
+		return errors.New("row template must be enclosed in parentheses")
+	}
+
+	m.isRowParameter = make(map[string]bool)
+
+	cursor := 0
+	segment := 0
+	for _, token := range tokens {
+		offset := cursor + strings.Index(rowTemplate[cursor:], token.text)
+		cursor = offset + len(token.text)
+
+		switch {
+		case token.kind == sqlTokenComment:
+			return errors.New("row template must not contain comments")
+		case token.kind != sqlTokenPlaceholder:
+			continue
+		case token.text[0] != parameterPrefix:
+			return errors.New("row template must use named parameters")
+		}
+
+		parameter := token.text[1:]
+		m.rowSegments = append(m.rowSegments, rowTemplate[segment:offset])
+		m.rowParameters = append(m.rowParameters, parameter)
+		m.isRowParameter[parameter] = true
+		segment = cursor
+	}
+	m.rowSegments = append(m.rowSegments, rowTemplate[segment:])
+
+	return nil
+}
+
+// rowsPerStatement returns the number of rows that fit in a single statement.
+func (m *MultiRowInsert) rowsPerStatement() int {
+	if len(m.rowParameters) < 1 {
+		return m.maxParameters
+	}
+	return (m.maxParameters - m.sharedParameters) / len(m.rowParameters)
+}
+
+// multiRowParameter returns the name a row template parameter has in the given row of a statement.
+func multiRowParameter(parameter string, row int) string {
+	return fmt.Sprintf("%s__%d", parameter, row)
+}
+
+// statement returns the SQL statement inserting the given number of rows.
+func (m *MultiRowInsert) statement(rows int) string {
+	var builder strings.Builder
+	builder.WriteString(m.insert)
+	builder.WriteString(" VALUES ")
+	for row := 0; row < rows; row++ {
+		if row > 0 {
+			builder.WriteString(", ")
+		}
+		for i, parameter := range m.rowParameters {
+			builder.WriteString(m.rowSegments[i])
+			builder.WriteRune(parameterPrefix)
+			builder.WriteString(multiRowParameter(parameter, row))
+		}
+		builder.WriteString(m.rowSegments[len(m.rowSegments)-1])
+	}
+	if m.suffix != "" {
+		builder.WriteByte(' ')
+		builder.WriteString(m.suffix)
+	}
+	return builder.String()
+}
+
+// multiRowStatement binds the row template parameters of a single row of a multi-row statement.
+type multiRowStatement struct {
+	PreparedStatement
+	insert *MultiRowInsert
+	row    int
+}
+
+// BindParameterValue binds the value to the row's parameter if it belongs to the row template, and to
+// the shared parameter otherwise.
+func (m multiRowStatement) BindParameterValue(parameter string, value any) error {
+	if m.insert.isRowParameter[parameter] {
+		parameter = multiRowParameter(parameter, m.row)
+	}
+	return m.PreparedStatement.BindParameterValue(parameter, value)
+}
+
+// BindParameterValues binds the values through BindParameterValue.
+func (m multiRowStatement) BindParameterValues(binderFuncs ...BindParameterValueFunc) error {
+	for i := range binderFuncs {
+		if internal.IsNilOrZeroValue(binderFuncs[i]) {
+			continue
+		}
+		if err := binderFuncs[i](m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PrepareStatements returns the chunked statements inserting one row per bind set, with the values bound.
+// The binderFuncs bind the parameters of the insert and suffix shared by all rows.
+func (m *MultiRowInsert) PrepareStatements(
+	bindSets [][]BindParameterValueFunc,
+	binderFuncs ...BindParameterValueFunc,
+) (
+	[]PreparedStatement,
+	error,
+) {
+	rowsPerStatement := m.rowsPerStatement()
+
+	var preparedStatements []PreparedStatement
+	for start := 0; start < len(bindSets); start += rowsPerStatement {
+		end := min(start+rowsPerStatement, len(bindSets))
+
+		preparedStatement, err := PrepareStatement(m.statement(end - start))
+		if err != nil {
+			return nil, err
+		}
+
+		if err := preparedStatement.BindParameterValues(binderFuncs...); err != nil {
+			return nil, err
+		}
+
+		for i := start; i < end; i++ {
+			rowStatement := multiRowStatement{PreparedStatement: preparedStatement, insert: m, row: i - start}
+			if err := rowStatement.BindParameterValues(bindSets[i]...); err != nil {
+				return nil, fmt.Errorf("row %d: %w", i, err)
+			}
+		}
+
+		preparedStatements = append(preparedStatements, preparedStatement)
+	}
+
+	return preparedStatements, nil
+}
+
+// ExecContext inserts one row per bind set and returns the number of rows affected. When the rows need
+// more than one statement, the statements are executed in a single transaction unless dbPrepExec already
+// is one.
+func (m *MultiRowInsert) ExecContext(
+	ctx context.Context,
+	dbPrepExec DBPreparerExecutor,
+	bindSets [][]BindParameterValueFunc,
+	binderFuncs ...BindParameterValueFunc,
+) (
+	int64,
+	error,
+) {
+	var rowsAffected int64
+	err := m.run(ctx, dbPrepExec, bindSets, binderFuncs, func(ctx context.Context, db DBPreparerExecutor, preparedStatement PreparedStatement) error {
+		result, err := ExecContext(ctx, db, preparedStatement)
+		if err != nil {
+			return err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		rowsAffected += affected
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return rowsAffected, nil
+}
+
+// QueryContext inserts one row per bind set and returns the rows of the RETURNING clause of every
+// statement, concatenated in order. See ExecContext for the transaction handling.
+func (m *MultiRowInsert) QueryContext(
+	ctx context.Context,
+	dbPrepExec DBPreparerExecutor,
+	bindSets [][]BindParameterValueFunc,
+	binderFuncs ...BindParameterValueFunc,
+) (
+	MappedRows,
+	error,
+) {
+	mappedRows := make(MappedRows, 0, len(bindSets))
+	err := m.run(ctx, dbPrepExec, bindSets, binderFuncs, func(ctx context.Context, db DBPreparerExecutor, preparedStatement PreparedStatement) error {
+		rows, err := QueryContext(ctx, db, preparedStatement)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		statementRows, err := MapRows(rows)
+		if err != nil {
+			return err
+		}
+		mappedRows = append(mappedRows, statementRows...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return mappedRows, nil
+}
+
+// run prepares the statements for the bind sets and runs each with runFunc, inside a transaction if
+// there is more than one statement.
+func (m *MultiRowInsert) run(
+	ctx context.Context,
+	dbPrepExec DBPreparerExecutor,
+	bindSets [][]BindParameterValueFunc,
+	binderFuncs []BindParameterValueFunc,
+	runFunc func(ctx context.Context, db DBPreparerExecutor, preparedStatement PreparedStatement) error,
+) error {
+	if internal.IsNil(dbPrepExec) {
+		return errors.New("db connection is nil")
+	}
+
+	preparedStatements, err := m.PrepareStatements(bindSets, binderFuncs...)
+	if err != nil {
+		return err
+	}
+
+	runAll := func(ctx context.Context, db DBPreparerExecutor) error {
+		for i := range preparedStatements {
+			if err := runFunc(ctx, db, preparedStatements[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	ctx = internal.InitIfNilContext(ctx)
+
+	if len(preparedStatements) < 2 || inTransaction(dbPrepExec) {
+		return runAll(ctx, dbPrepExec)
+	}
+
+	return WithTransaction(ctx, dbPrepExec, nil, func(ctx context.Context, tx DBPreparerExecutor) error {
+		return runAll(ctx, tx)
+	})
+}
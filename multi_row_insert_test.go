@@ -0,0 +1,163 @@
+package dbsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMultiRowInsert(t *testing.T) {
+	t.Parallel()
+
+	customerBindSets := func(names ...string) [][]BindParameterValueFunc {
+		bindSets := make([][]BindParameterValueFunc, len(names))
+		for i, name := range names {
+			bindSets[i] = []BindParameterValueFunc{
+				BindParameterValue("first_name", name),
+				BindParameterValue("last_name", "Doe"),
+			}
+		}
+		return bindSets
+	}
+
+	tests := []struct {
+		desc      string
+		assertion func(*testing.T, string)
+	}{
+		{
+			desc: "The rows are inserted with a single statement",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fd := NewFakeDB(t)
+				fd.ExecFunc = func(query string, args []any) (driver.Result, error) {
+					return driver.RowsAffected(int64(len(args) / 2)), nil
+				}
+
+				insert, err := NewMultiRowInsert(
+					"INSERT INTO customers (first_name, last_name)",
+					"(@first_name, lower(@last_name))",
+					"",
+				)
+				require.NoError(t, err, desc)
+
+				rowsAffected, err := insert.ExecContext(context.Background(), sqlDB, customerBindSets("John", "Jane"))
+				require.NoError(t, err, desc)
+				require.Equal(t, int64(2), rowsAffected, desc)
+				require.Equal(
+					t,
+					fakeDriverCall{
+						Query: "INSERT INTO customers (first_name, last_name) VALUES ($1, lower($2)), ($3, lower($4))",
+						Args:  []any{"John", "Doe", "Jane", "Doe"},
+						Conn:  1,
+					},
+					fd.LastExec(),
+					desc,
+				)
+				require.Equal(t, 0, fd.Begins, desc)
+			},
+		},
+		{
+			desc: "The rows are chunked to stay under the parameter limit",
+			assertion: func(t *testing.T, desc string) {
+				insert, err := NewMultiRowInsert(
+					"INSERT INTO customers (first_name, last_name, tenant_id)",
+					"(@first_name, @last_name, @tenant_id)",
+					"ON CONFLICT DO NOTHING",
+					MultiRowInsertMaxParameters(7),
+				)
+				require.NoError(t, err, desc)
+
+				preparedStatements, err := insert.PrepareStatements(customerBindSets("John", "Jane", "Jim"))
+				require.NoError(t, err, desc)
+				require.Len(t, preparedStatements, 2, desc)
+				require.Len(t, preparedStatements[0].BoundParameterValues(), 6, desc)
+				require.Len(t, preparedStatements[1].BoundParameterValues(), 3, desc)
+				require.Equal(
+					t,
+					"INSERT INTO customers (first_name, last_name, tenant_id) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING",
+					preparedStatements[1].Revised(),
+					desc,
+				)
+			},
+		},
+		{
+			desc: "Shared parameters are bound once and count against the limit",
+			assertion: func(t *testing.T, desc string) {
+				insert, err := NewMultiRowInsert(
+					"INSERT INTO customers (first_name, last_name)",
+					"(@first_name, @last_name)",
+					"ON CONFLICT (first_name, last_name) DO UPDATE SET updated_at = @updated_at",
+					MultiRowInsertMaxParameters(5),
+				)
+				require.NoError(t, err, desc)
+
+				preparedStatements, err := insert.PrepareStatements(
+					customerBindSets("John", "Jane", "Jim"),
+					BindParameterValue("updated_at", "now"),
+				)
+				require.NoError(t, err, desc)
+				require.Len(t, preparedStatements, 2, desc)
+				require.Equal(t, BoundParameterValues{"John", "Doe", "Jane", "Doe", "now"}, preparedStatements[0].BoundParameterValues(), desc)
+			},
+		},
+		{
+			desc: "The RETURNING rows of every chunk are concatenated inside a transaction",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fd := NewFakeDB(t)
+				customerID := int64(0)
+				fd.QueryFunc = func(query string, args []any) (driver.Rows, error) {
+					var values [][]driver.Value
+					for range args {
+						customerID++
+						values = append(values, []driver.Value{customerID})
+					}
+					return newFakeRows([]string{"customer_id"}, values...), nil
+				}
+
+				insert, err := NewMultiRowInsert(
+					"INSERT INTO customers (first_name)",
+					"(@first_name)",
+					"RETURNING customer_id",
+					MultiRowInsertMaxParameters(2),
+				)
+				require.NoError(t, err, desc)
+
+				bindSets := [][]BindParameterValueFunc{
+					{BindParameterValue("first_name", "John")},
+					{BindParameterValue("first_name", "Jane")},
+					{BindParameterValue("first_name", "Jim")},
+				}
+				mappedRows, err := insert.QueryContext(context.Background(), sqlDB, bindSets)
+				require.NoError(t, err, desc)
+				require.Equal(t, MappedRows{{"customer_id": int64(1)}, {"customer_id": int64(2)}, {"customer_id": int64(3)}}, mappedRows, desc)
+				require.Equal(t, 2, fd.QueryCount(), desc)
+				require.Equal(t, 1, fd.Commits, desc)
+			},
+		},
+		{
+			desc: "Invalid templates are rejected",
+			assertion: func(t *testing.T, desc string) {
+				_, err := NewMultiRowInsert("UPDATE customers", "(@first_name)", "")
+				require.EqualError(t, err, "insert must be an INSERT statement", desc)
+
+				_, err = NewMultiRowInsert("INSERT INTO customers (first_name)", "@first_name", "")
+				require.EqualError(t, err, "row template must be enclosed in parentheses", desc)
+
+				_, err = NewMultiRowInsert("INSERT INTO customers (first_name)", "($1)", "")
+				require.EqualError(t, err, "row template must use named parameters", desc)
+
+				_, err = NewMultiRowInsert("INSERT INTO customers (first_name, last_name)", "(@first_name, @last_name)", "", MultiRowInsertMaxParameters(1))
+				require.EqualError(t, err, "a single row does not fit in 1 parameters", desc)
+			},
+		},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			tc.assertion(t, tc.desc)
+		})
+	}
+}
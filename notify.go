@@ -0,0 +1,387 @@
+package dbsql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/neumachen/dbsql/internal"
+)
+
+// Notification is a notification received on a channel the Subscriber listens to.
+type Notification struct {
+	// Channel is the channel the notification was sent on.
+	Channel string
+	// Payload is the payload of the notification, empty if none was given.
+	Payload string
+	// BackendPID is the process ID of the session that sent the notification.
+	BackendPID int
+}
+
+// MappedRow decodes the JSON object payload of the notification, e.g. one sent with
+// pg_notify('orders', row_to_json(NEW)::text) by a trigger. Numbers are decoded as json.Number, so
+// bigint values keep their precision.
+func (n Notification) MappedRow() (MappedRow, error) {
+	decoder := json.NewDecoder(bytes.NewReader([]byte(n.Payload)))
+	decoder.UseNumber()
+
+	var mappedRow MappedRow
+	if err := decoder.Decode(&mappedRow); err != nil {
+		return nil, err
+	}
+	if mappedRow == nil {
+		return nil, errors.New("payload is not a JSON object")
+	}
+
+	return mappedRow, nil
+}
+
+// NotificationHandler handles the notifications received on a channel.
+type NotificationHandler func(ctx context.Context, notification Notification) error
+
+// NotificationListener is the connection a Subscriber listens on. It is implemented by *pq.Listener, which
+// re-establishes the connection when it is lost, listens again to its channels and then sends a nil
+// notification.
+type NotificationListener interface {
+	Listen(channel string) error
+	Unlisten(channel string) error
+	NotificationChannel() <-chan *pq.Notification
+	Close() error
+}
+
+// SubscriberOption configures a Subscriber.
+type SubscriberOption func(subscriber *Subscriber)
+
+// SubscriberReconnectInterval sets how long NewSubscriber waits before reconnecting after the connection
+// is lost; the wait doubles after each failed attempt, up to maxInterval. It defaults to 1s and 1m.
+func SubscriberReconnectInterval(minInterval, maxInterval time.Duration) SubscriberOption {
+	return func(subscriber *Subscriber) {
+		subscriber.minReconnectInterval = minInterval
+		subscriber.maxReconnectInterval = maxInterval
+	}
+}
+
+// SubscriberOnReconnect sets a function called after the connection was re-established. Notifications
+// sent while it was down are lost, so this is where to catch up, e.g. by re-reading the pending rows. It
+// is called from a goroutine of its own, so it may run concurrently with the handlers.
+func SubscriberOnReconnect(onReconnect func(ctx context.Context)) SubscriberOption {
+	return func(subscriber *Subscriber) {
+		subscriber.onReconnect = onReconnect
+	}
+}
+
+// SubscriberOnError sets a function called with the errors returned by the handlers, and with the
+// errors of listening again to a channel after a reconnect, in which case notification is empty but for
+// its channel and the function is called from the goroutine listening again.
+func SubscriberOnError(onError func(ctx context.Context, notification Notification, err error)) SubscriberOption {
+	return func(subscriber *Subscriber) {
+		subscriber.onError = onError
+	}
+}
+
+// subscription is a handler subscribed to a channel. It is a pointer so it can be removed by identity.
+type subscription struct {
+	handler NotificationHandler
+}
+
+// Subscriber dispatches the notifications sent with NOTIFY, or Notify, to the handlers subscribed to
+// their channel. Call Run to receive the notifications; the handlers are called one at a time, in the
+// order the notifications were received.
+//
+// A Subscriber holds a connection of its own, outside of any pool. When it is lost, it is re-established
+// and every subscribed channel is listened to again, but the notifications sent in between are lost: use
+// SubscriberOnReconnect to catch up. A Subscriber is safe for concurrent use.
+//
+// Example:
+//
+//	subscriber := dbsql.NewSubscriber(dsn, dbsql.SubscriberOnReconnect(resyncOrders))
+//	defer subscriber.Close()
+//
+//	unsubscribe, err := subscriber.Subscribe("orders", func(ctx context.Context, notification dbsql.Notification) error {
+//		order, err := notification.MappedRow()
+//		if err != nil {
+//			return err
+//		}
+//		return shipOrder(ctx, order)
+//	})
+//	go subscriber.Run(ctx)
+type Subscriber struct {
+	listener             NotificationListener
+	minReconnectInterval time.Duration
+	maxReconnectInterval time.Duration
+	onReconnect          func(ctx context.Context)
+	onError              func(ctx context.Context, notification Notification, err error)
+
+	// listenMu serializes LISTEN and UNLISTEN, including listening again after a reconnect; it is never
+	// held by Run, which must keep receiving notifications for the listener to process the replies.
+	listenMu sync.Mutex
+
+	mu       sync.Mutex
+	handlers map[string][]*subscription
+	closed   bool
+}
+
+// NewSubscriber returns a Subscriber listening on a connection opened with connInfo, a connection string
+// as accepted by lib/pq. The connection is opened in the background and re-established when it is lost.
+func NewSubscriber(connInfo string, opts ...SubscriberOption) *Subscriber {
+	subscriber := newSubscriber(opts)
+	subscriber.listener = pq.NewListener(
+		connInfo,
+		subscriber.minReconnectInterval,
+		subscriber.maxReconnectInterval,
+		nil,
+	)
+	return subscriber
+}
+
+// NewListenerSubscriber returns a Subscriber listening on listener, e.g. a *pq.Listener created with a
+// custom dialer.
+func NewListenerSubscriber(listener NotificationListener, opts ...SubscriberOption) (*Subscriber, error) {
+	if internal.IsNil(listener) {
+		return nil, errors.New("listener is nil")
+	}
+
+	subscriber := newSubscriber(opts)
+	subscriber.listener = listener
+	return subscriber, nil
+}
+
+// newSubscriber returns a Subscriber without a listener, configured by opts.
+func newSubscriber(opts []SubscriberOption) *Subscriber {
+	subscriber := &Subscriber{
+		minReconnectInterval: time.Second,
+		maxReconnectInterval: time.Minute,
+		handlers:             make(map[string][]*subscription),
+	}
+	for i := range opts {
+		opts[i](subscriber)
+	}
+	return subscriber
+}
+
+// Subscribe calls handler with the notifications received on channel, and returns a function removing
+// it. The channel is listened to when its first handler is subscribed, which waits for the connection if
+// it is down, and no longer when its last handler is removed. Channel names are case-sensitive.
+//
+// Subscribe and the function it returns wait for the listener to process the LISTEN or UNLISTEN, which
+// it only does while Run keeps receiving notifications. They must not be called from a handler, or from
+// the SubscriberOnError function for a handler's error, since Run is blocked until those return; call
+// them from another goroutine instead.
+func (s *Subscriber) Subscribe(channel string, handler NotificationHandler) (func() error, error) {
+	if channel == "" {
+		return nil, errors.New("channel is empty")
+	}
+
+	if handler == nil {
+		return nil, errors.New("notification handler is nil")
+	}
+
+	s.listenMu.Lock()
+	defer s.listenMu.Unlock()
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil, errors.New("subscriber is closed")
+	}
+	listening := len(s.handlers[channel]) > 0
+	s.mu.Unlock()
+
+	if !listening {
+		if err := s.listener.Listen(channel); err != nil && !errors.Is(err, pq.ErrChannelAlreadyOpen) {
+			return nil, ClassifyError(err)
+		}
+	}
+
+	sub := &subscription{handler: handler}
+
+	s.mu.Lock()
+	s.handlers[channel] = append(s.handlers[channel], sub)
+	s.mu.Unlock()
+
+	var once sync.Once
+	return func() error {
+		var err error
+		once.Do(func() {
+			err = s.unsubscribe(channel, sub)
+		})
+		return err
+	}, nil
+}
+
+// unsubscribe removes the subscription, and stops listening to the channel if it was the last one.
+func (s *Subscriber) unsubscribe(channel string, sub *subscription) error {
+	s.listenMu.Lock()
+	defer s.listenMu.Unlock()
+
+	s.mu.Lock()
+	subs := s.handlers[channel]
+	for i := range subs {
+		if subs[i] == sub {
+			subs = append(subs[:i:i], subs[i+1:]...)
+			break
+		}
+	}
+	if len(subs) > 0 {
+		s.handlers[channel] = subs
+		s.mu.Unlock()
+		return nil
+	}
+	delete(s.handlers, channel)
+	closed := s.closed
+	s.mu.Unlock()
+
+	if closed {
+		return nil
+	}
+
+	if err := s.listener.Unlisten(channel); err != nil && !errors.Is(err, pq.ErrChannelNotOpen) {
+		return ClassifyError(err)
+	}
+	return nil
+}
+
+// Run receives the notifications and calls the handlers subscribed to their channel, until ctx is done
+// or the Subscriber is closed. It returns ctx's error, or nil once the Subscriber is closed.
+func (s *Subscriber) Run(ctx context.Context) error {
+	ctx = internal.InitIfNilContext(ctx)
+
+	notifications := s.listener.NotificationChannel()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case notification, ok := <-notifications:
+			if !ok {
+				return nil
+			}
+
+			// The listener sends nil once it reconnected. Listening again waits for the listener's replies,
+			// which it only processes while notifications are received, so it is done in the background.
+			if notification == nil {
+				go s.reconnected(ctx)
+				continue
+			}
+
+			s.dispatch(ctx, Notification{
+				Channel:    notification.Channel,
+				Payload:    notification.Extra,
+				BackendPID: notification.BePid,
+			})
+		}
+	}
+}
+
+// reconnected listens again to the subscribed channels the listener has not, then calls the
+// SubscriberOnReconnect function. It holds listenMu, so channels are not subscribed or unsubscribed
+// meanwhile.
+func (s *Subscriber) reconnected(ctx context.Context) {
+	s.listenMu.Lock()
+	s.mu.Lock()
+	closed := s.closed
+	channels := make([]string, 0, len(s.handlers))
+	for channel := range s.handlers {
+		channels = append(channels, channel)
+	}
+	s.mu.Unlock()
+
+	if closed {
+		s.listenMu.Unlock()
+		return
+	}
+
+	for _, channel := range channels {
+		// *pq.Listener listens again by itself and reports the channel as already open.
+		if err := s.listener.Listen(channel); err != nil && !errors.Is(err, pq.ErrChannelAlreadyOpen) {
+			s.handleError(ctx, Notification{Channel: channel}, ClassifyError(err))
+		}
+	}
+	s.listenMu.Unlock()
+
+	if s.onReconnect != nil {
+		s.onReconnect(ctx)
+	}
+}
+
+// dispatch calls the handlers subscribed to the channel of the notification.
+func (s *Subscriber) dispatch(ctx context.Context, notification Notification) {
+	s.mu.Lock()
+	subs := s.handlers[notification.Channel]
+	s.mu.Unlock()
+
+	for _, sub := range subs {
+		if err := sub.handler(ctx, notification); err != nil {
+			s.handleError(ctx, notification, err)
+		}
+	}
+}
+
+// handleError passes err to the SubscriberOnError function, if any.
+func (s *Subscriber) handleError(ctx context.Context, notification Notification, err error) {
+	if s.onError != nil {
+		s.onError(ctx, notification, err)
+	}
+}
+
+// Close closes the connection of the Subscriber, which makes Run return.
+func (s *Subscriber) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.mu.Unlock()
+
+	return s.listener.Close()
+}
+
+// Notify sends a notification on channel with pg_notify. A string or []byte payload is sent as is, and
+// any other payload as JSON, e.g. a MappedRow. Notifications sent inside a transaction are delivered
+// when it commits; PostgreSQL limits payloads to 8000 bytes.
+//
+// The statement is classified as a write, so a Router sends it to the primary and RetryInterceptor does
+// not send it twice.
+//
+// Example:
+//
+//	err := dbsql.Notify(ctx, tx, "orders", dbsql.MappedRow{"order_id": orderID, "status": "paid"})
+func Notify(ctx context.Context, dbPrepExec DBPreparerExecutor, channel string, payload any) error {
+	if channel == "" {
+		return errors.New("channel is empty")
+	}
+
+	var text string
+	switch payload := payload.(type) {
+	case string:
+		text = payload
+	case []byte:
+		text = string(payload)
+	default:
+		b, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		text = string(b)
+	}
+
+	preparedStatement, err := PrepareStatement("SELECT pg_notify(@channel, @payload)", ClassifyAs(StatementWrite))
+	if err != nil {
+		return err
+	}
+
+	_, err = ExecContext(
+		ctx,
+		dbPrepExec,
+		preparedStatement,
+		BindParameterValue("channel", channel),
+		BindParameterValue("payload", text),
+	)
+	return err
+}
+
+var _ NotificationListener = (*pq.Listener)(nil)
@@ -0,0 +1,276 @@
+package dbsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeListener is a NotificationListener recording the channels listened to.
+type fakeListener struct {
+	mu        sync.Mutex
+	channels  map[string]bool
+	listens   []string
+	unlistens []string
+	notify    chan *pq.Notification
+	// listened, if set, is waited for by Listen, as *pq.Listener waits for the reply of the database.
+	listened chan struct{}
+}
+
+func newFakeListener() *fakeListener {
+	return &fakeListener{channels: make(map[string]bool), notify: make(chan *pq.Notification, 8)}
+}
+
+func (f *fakeListener) Listen(channel string) error {
+	if f.listened != nil {
+		<-f.listened
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.channels[channel] {
+		return pq.ErrChannelAlreadyOpen
+	}
+	f.channels[channel] = true
+	f.listens = append(f.listens, channel)
+	return nil
+}
+
+func (f *fakeListener) Unlisten(channel string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.channels[channel] {
+		return pq.ErrChannelNotOpen
+	}
+	delete(f.channels, channel)
+	f.unlistens = append(f.unlistens, channel)
+	return nil
+}
+
+func (f *fakeListener) NotificationChannel() <-chan *pq.Notification {
+	return f.notify
+}
+
+func (f *fakeListener) Close() error {
+	close(f.notify)
+	return nil
+}
+
+// lose forgets the channels, as a listener whose connection was lost.
+func (f *fakeListener) lose() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.channels = make(map[string]bool)
+}
+
+func TestSubscriber(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		desc      string
+		assertion func(*testing.T, string)
+	}{
+		{
+			desc: "Notifications are dispatched in order to the handlers of their channel",
+			assertion: func(t *testing.T, desc string) {
+				listener := newFakeListener()
+				subscriber, err := NewListenerSubscriber(listener)
+				require.NoError(t, err, desc)
+
+				var received []string
+				handler := func(name string) NotificationHandler {
+					return func(_ context.Context, notification Notification) error {
+						received = append(received, name+":"+notification.Payload)
+						return nil
+					}
+				}
+
+				unsubscribeFirst, err := subscriber.Subscribe("orders", handler("first"))
+				require.NoError(t, err, desc)
+				unsubscribeSecond, err := subscriber.Subscribe("orders", handler("second"))
+				require.NoError(t, err, desc)
+				_, err = subscriber.Subscribe("invoices", handler("invoices"))
+				require.NoError(t, err, desc)
+				require.Equal(t, []string{"orders", "invoices"}, listener.listens, desc)
+
+				listener.notify <- &pq.Notification{Channel: "orders", Extra: "1"}
+				listener.notify <- &pq.Notification{Channel: "carts", Extra: "2"}
+				listener.notify <- &pq.Notification{Channel: "orders", Extra: "3"}
+				require.NoError(t, subscriber.Close(), desc)
+				require.NoError(t, subscriber.Run(context.Background()), desc)
+				require.Equal(t, []string{"first:1", "second:1", "first:3", "second:3"}, received, desc)
+
+				require.NoError(t, unsubscribeFirst(), desc)
+				require.NoError(t, unsubscribeSecond(), desc)
+				require.NoError(t, unsubscribeSecond(), desc)
+				require.Empty(t, listener.unlistens, desc)
+
+				_, err = subscriber.Subscribe("orders", handler("third"))
+				require.EqualError(t, err, "subscriber is closed", desc)
+			},
+		},
+		{
+			desc: "Channels are listened to again after a reconnect and errors are reported",
+			assertion: func(t *testing.T, desc string) {
+				listener := newFakeListener()
+
+				reconnects := make(chan struct{}, 1)
+				errs := make(chan error, 1)
+				subscriber, err := NewListenerSubscriber(
+					listener,
+					SubscriberOnReconnect(func(context.Context) {
+						reconnects <- struct{}{}
+					}),
+					SubscriberOnError(func(_ context.Context, notification Notification, err error) {
+						errs <- err
+					}),
+				)
+				require.NoError(t, err, desc)
+
+				unsubscribe, err := subscriber.Subscribe("orders", func(context.Context, Notification) error {
+					return errors.New("handler failed")
+				})
+				require.NoError(t, err, desc)
+
+				ctx, cancel := context.WithCancel(context.Background())
+				done := make(chan error, 1)
+				go func() {
+					done <- subscriber.Run(ctx)
+				}()
+
+				listener.lose()
+				listener.notify <- nil
+				select {
+				case <-reconnects:
+				case <-time.After(5 * time.Second):
+					t.Fatal(desc)
+				}
+				listener.notify <- &pq.Notification{Channel: "orders"}
+				select {
+				case err := <-errs:
+					require.EqualError(t, err, "handler failed", desc)
+				case <-time.After(5 * time.Second):
+					t.Fatal(desc)
+				}
+
+				require.NoError(t, unsubscribe(), desc)
+				cancel()
+				require.ErrorIs(t, <-done, context.Canceled, desc)
+
+				require.Equal(t, []string{"orders", "orders"}, listener.listens, desc)
+				require.Equal(t, []string{"orders"}, listener.unlistens, desc)
+			},
+		},
+		{
+			desc: "Run keeps dispatching notifications while channels are listened to again",
+			assertion: func(t *testing.T, desc string) {
+				listener := newFakeListener()
+				reconnects := make(chan struct{}, 1)
+				subscriber, err := NewListenerSubscriber(listener, SubscriberOnReconnect(func(context.Context) {
+					reconnects <- struct{}{}
+				}))
+				require.NoError(t, err, desc)
+
+				received := make(chan string, 1)
+				_, err = subscriber.Subscribe("orders", func(_ context.Context, notification Notification) error {
+					received <- notification.Payload
+					return nil
+				})
+				require.NoError(t, err, desc)
+
+				listener.listened = make(chan struct{})
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				go func() {
+					_ = subscriber.Run(ctx)
+				}()
+
+				listener.lose()
+				listener.notify <- nil
+				listener.notify <- &pq.Notification{Channel: "orders", Extra: "1"}
+				select {
+				case payload := <-received:
+					require.Equal(t, "1", payload, desc)
+				case <-time.After(5 * time.Second):
+					t.Fatal(desc)
+				}
+
+				close(listener.listened)
+				select {
+				case <-reconnects:
+				case <-time.After(5 * time.Second):
+					t.Fatal(desc)
+				}
+				require.Equal(t, []string{"orders", "orders"}, listener.listens, desc)
+			},
+		},
+		{
+			desc: "JSON payloads are decoded into a MappedRow",
+			assertion: func(t *testing.T, desc string) {
+				mappedRow, err := Notification{Payload: `{"order_id": 9007199254740993, "status": "paid"}`}.MappedRow()
+				require.NoError(t, err, desc)
+				require.Equal(t, MappedRow{"order_id": json.Number("9007199254740993"), "status": "paid"}, mappedRow, desc)
+
+				_, err = Notification{Payload: "null"}.MappedRow()
+				require.EqualError(t, err, "payload is not a JSON object", desc)
+				_, err = Notification{Payload: "paid"}.MappedRow()
+				require.Error(t, err, desc)
+			},
+		},
+		{
+			desc: "Notify sends the payload with pg_notify",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fake := NewFakeDB(t)
+
+				require.NoError(t, Notify(context.Background(), sqlDB, "orders", MappedRow{"order_id": 7}), desc)
+				require.Equal(
+					t,
+					fakeDriverCall{Query: "SELECT pg_notify($1, $2)", Args: []any{"orders", `{"order_id":7}`}, Conn: 1},
+					fake.LastExec(),
+					desc,
+				)
+
+				require.NoError(t, Notify(context.Background(), sqlDB, "orders", "7"), desc)
+				require.Equal(t, []any{"orders", "7"}, fake.LastExec().Args, desc)
+
+				require.EqualError(t, Notify(context.Background(), sqlDB, "", "7"), "channel is empty", desc)
+			},
+		},
+		{
+			desc: "Notify is sent to the primary and not retried",
+			assertion: func(t *testing.T, desc string) {
+				primaryDB, primary := NewFakeDB(t)
+				replicaDB, replica := NewFakeDB(t)
+				primary.ExecFunc = func(string, []any) (driver.Result, error) {
+					return nil, errors.New("connection reset by peer")
+				}
+
+				router, err := NewRouter(primaryDB, []DBPreparerExecutor{replicaDB})
+				require.NoError(t, err, desc)
+				db := WithInterceptors(router, RetryInterceptor(RetryPolicy{
+					MaxAttempts: 3,
+					Classifier:  func(error) bool { return true },
+				}))
+
+				require.Error(t, Notify(context.Background(), db, "orders", "7"), desc)
+				require.Equal(t, 0, replica.ExecCount(), desc)
+				require.Equal(t, 1, primary.ExecCount(), desc)
+			},
+		},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			tc.assertion(t, tc.desc)
+		})
+	}
+}
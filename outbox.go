@@ -0,0 +1,380 @@
+package dbsql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/neumachen/dbsql/internal"
+)
+
+// OutboxEvent is an event stored in an outbox table.
+type OutboxEvent struct {
+	// ID is the identifier of the event, increasing in the order the events were written.
+	ID int64
+	// Topic is where the event is published, e.g. a message broker topic.
+	Topic string
+	// Key identifies the entity the event is about, e.g. to partition the topic; empty if none was given.
+	Key string
+	// Payload is the JSON payload of the event.
+	Payload json.RawMessage
+	// CreatedAt is when the event was written.
+	CreatedAt time.Time
+	// Attempts is the number of failed attempts to publish the event so far.
+	Attempts int
+}
+
+// Outbox writes events to an outbox table within the transaction that changes the data they describe,
+// so an event is stored if and only if the change is committed. An OutboxRelay then publishes the stored
+// events. The table must have the following columns:
+//
+//	CREATE TABLE outbox (
+//		event_id         bigserial PRIMARY KEY,
+//		topic            text NOT NULL,
+//		event_key        text NOT NULL DEFAULT '',
+//		payload          jsonb NOT NULL,
+//		created_at       timestamptz NOT NULL DEFAULT now(),
+//		attempts         integer NOT NULL DEFAULT 0,
+//		next_attempt_at  timestamptz NOT NULL DEFAULT now(),
+//		last_error       text,
+//		delivered_at     timestamptz,
+//		dead_lettered_at timestamptz
+//	);
+//	CREATE INDEX ON outbox (next_attempt_at) WHERE delivered_at IS NULL AND dead_lettered_at IS NULL;
+type Outbox struct {
+	table string
+}
+
+// NewOutbox returns an Outbox storing its events in table, which may be schema-qualified, e.g.
+// "billing.outbox".
+func NewOutbox(table string) (*Outbox, error) {
+	if strings.TrimSpace(table) == "" {
+		return nil, errors.New("table is empty")
+	}
+
+	return &Outbox{table: quoteTable(table)}, nil
+}
+
+// Write stores an event in the outbox with tx, which must be a transaction, or wrap one, so the event is
+// committed or rolled back together with the change it describes. A []byte or json.RawMessage payload is
+// stored as is and must hold JSON; any other payload is encoded to JSON.
+//
+// Example:
+//
+//	err := dbsql.WithTransaction(ctx, db, nil, func(ctx context.Context, tx dbsql.DBPreparerExecutor) error {
+//		if _, err := dbsql.ExecContext(ctx, tx, insertOrder, dbsql.BindParameterValue("order_id", orderID)); err != nil {
+//			return err
+//		}
+//		return outbox.Write(ctx, tx, "orders", orderID, dbsql.MappedRow{"order_id": orderID, "status": "placed"})
+//	})
+func (o *Outbox) Write(ctx context.Context, tx DBPreparerExecutor, topic, key string, payload any) error {
+	if internal.IsNil(tx) {
+		return errors.New("db connection is nil")
+	}
+
+	if !inTransaction(tx) {
+		return errors.New("outbox events must be written inside a transaction")
+	}
+
+	if topic == "" {
+		return errors.New("topic is empty")
+	}
+
+	var text string
+	switch payload := payload.(type) {
+	case json.RawMessage:
+		text = string(payload)
+	case []byte:
+		text = string(payload)
+	default:
+		b, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		text = string(b)
+	}
+
+	preparedStatement, err := PrepareStatement(
+		"INSERT INTO " + o.table + " (topic, event_key, payload) VALUES (@topic, @event_key, @payload)",
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = ExecContext(
+		ctx,
+		tx,
+		preparedStatement,
+		BindParameterValue("topic", topic),
+		BindParameterValue("event_key", key),
+		BindParameterValue("payload", text),
+	)
+	return err
+}
+
+// quoteTable quotes the optionally schema-qualified table name.
+func quoteTable(table string) string {
+	if schema, name, ok := strings.Cut(table, "."); ok {
+		return pq.QuoteIdentifier(schema) + "." + pq.QuoteIdentifier(name)
+	}
+	return pq.QuoteIdentifier(table)
+}
+
+// OutboxPublisher publishes a batch of events, e.g. to a message broker, in the order of their IDs. It
+// returns nil only if every event was published; otherwise the whole batch is attempted again later, so
+// events may be published more than once and consumers must be idempotent.
+type OutboxPublisher func(ctx context.Context, events []OutboxEvent) error
+
+// OutboxRelayPolicy configures an OutboxRelay.
+type OutboxRelayPolicy struct {
+	// BatchSize is the largest number of events handed to the publisher at once. Values below 1 are
+	// treated as 1.
+	BatchSize int
+	// PollInterval is how long the relay waits before polling again once the outbox is drained, or after
+	// an error. Values below 1 are treated as 1s.
+	PollInterval time.Duration
+	// MaxAttempts is the number of failed attempts after which an event is dead-lettered: it stays in the
+	// table, with dead_lettered_at set, but is no longer published. Zero means events are attempted forever.
+	MaxAttempts int
+	// Backoff gives the delay before attempting an event again, from its InitialBackoff, MaxBackoff,
+	// Multiplier and Jitter.
+	Backoff RetryPolicy
+	// OnError, if set, is called with the errors of the relay and of the publisher.
+	OnError func(ctx context.Context, err error)
+	// OnDeadLetter, if set, is called with the events dead-lettered and the error of their last attempt.
+	OnDeadLetter func(ctx context.Context, event OutboxEvent, err error)
+}
+
+// DefaultOutboxRelayPolicy returns an OutboxRelayPolicy with batches of 100 events, polling every second,
+// dead-lettering events after 10 failed attempts, and an exponential backoff starting at 1s and capped at
+// 5m, with 20% jitter.
+func DefaultOutboxRelayPolicy() OutboxRelayPolicy {
+	return OutboxRelayPolicy{
+		BatchSize:    100,
+		PollInterval: time.Second,
+		MaxAttempts:  10,
+		Backoff: RetryPolicy{
+			InitialBackoff: time.Second,
+			MaxBackoff:     5 * time.Minute,
+			Multiplier:     2,
+			Jitter:         0.2,
+		},
+	}
+}
+
+// OutboxRelay publishes the events stored in an Outbox. It is returned by NewOutboxRelay.
+//
+// Each batch is claimed with SELECT ... FOR UPDATE SKIP LOCKED inside a transaction that lasts until the
+// publisher returns, so several relays, e.g. one per replica, can run against the same outbox without
+// publishing the same events concurrently. Published events are marked delivered; the events of a failed
+// batch are attempted again after a backoff, and dead-lettered after MaxAttempts.
+type OutboxRelay struct {
+	db        DBPreparerExecutor
+	outbox    *Outbox
+	publisher OutboxPublisher
+	policy    OutboxRelayPolicy
+}
+
+// NewOutboxRelay returns an OutboxRelay publishing the events of outbox, read and updated with
+// dbPrepExec, with publisher.
+//
+// Example:
+//
+//	relay, err := dbsql.NewOutboxRelay(db, outbox, publishToBroker, dbsql.DefaultOutboxRelayPolicy())
+//	go relay.Run(ctx)
+func NewOutboxRelay(
+	dbPrepExec DBPreparerExecutor,
+	outbox *Outbox,
+	publisher OutboxPublisher,
+	policy OutboxRelayPolicy,
+) (
+	*OutboxRelay,
+	error,
+) {
+	if internal.IsNil(dbPrepExec) {
+		return nil, errors.New("db connection is nil")
+	}
+
+	if outbox == nil {
+		return nil, errors.New("outbox is nil")
+	}
+
+	if publisher == nil {
+		return nil, errors.New("outbox publisher is nil")
+	}
+
+	if policy.BatchSize < 1 {
+		policy.BatchSize = 1
+	}
+	if policy.PollInterval < 1 {
+		policy.PollInterval = time.Second
+	}
+
+	return &OutboxRelay{
+		db:        dbPrepExec,
+		outbox:    outbox,
+		publisher: publisher,
+		policy:    policy,
+	}, nil
+}
+
+// Run publishes the events of the outbox until ctx is done, and returns ctx's error. Batches are relayed
+// back to back while the outbox holds more events than a batch; once it is drained, or after an error,
+// the relay waits for PollInterval.
+func (r *OutboxRelay) Run(ctx context.Context) error {
+	ctx = internal.InitIfNilContext(ctx)
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		events, err := r.RelayBatch(ctx)
+		if err != nil && ctx.Err() == nil && r.policy.OnError != nil {
+			r.policy.OnError(ctx, err)
+		}
+
+		if err == nil && events >= r.policy.BatchSize {
+			timer.Reset(0)
+			continue
+		}
+		timer.Reset(r.policy.PollInterval)
+	}
+}
+
+// RelayBatch claims the next batch of events due, hands it to the publisher and records the outcome. It
+// returns the number of events in the batch, and the error of the publisher, if any, once the events
+// were scheduled to be attempted again.
+func (r *OutboxRelay) RelayBatch(ctx context.Context) (int, error) {
+	ctx = internal.InitIfNilContext(ctx)
+
+	var (
+		events     []OutboxEvent
+		publishErr error
+	)
+	err := WithTransaction(ctx, r.db, nil, func(ctx context.Context, tx DBPreparerExecutor) error {
+		var err error
+		events, err = r.claim(ctx, tx)
+		if err != nil || len(events) < 1 {
+			return err
+		}
+
+		if publishErr = r.publisher(ctx, events); publishErr == nil {
+			return r.delivered(ctx, tx, events)
+		}
+		return r.failed(ctx, tx, events, publishErr)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if publishErr != nil {
+		for _, event := range events {
+			if r.deadLettered(event) && r.policy.OnDeadLetter != nil {
+				r.policy.OnDeadLetter(ctx, event, publishErr)
+			}
+		}
+		return len(events), fmt.Errorf("publishing outbox events: %w", publishErr)
+	}
+
+	return len(events), nil
+}
+
+// claim locks and returns the next batch of events due, skipping those locked by other relays.
+func (r *OutboxRelay) claim(ctx context.Context, tx DBPreparerExecutor) ([]OutboxEvent, error) {
+	preparedStatement, err := PrepareStatement(
+		"SELECT event_id, topic, event_key, payload, created_at, attempts FROM " + r.outbox.table +
+			" WHERE delivered_at IS NULL AND dead_lettered_at IS NULL AND next_attempt_at <= now()" +
+			" ORDER BY event_id LIMIT @batch_size FOR UPDATE SKIP LOCKED",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := QueryContext(ctx, tx, preparedStatement, BindParameterValue("batch_size", r.policy.BatchSize))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []OutboxEvent
+	for rows.Next() {
+		var (
+			event   OutboxEvent
+			payload []byte
+		)
+		err := rows.Scan(&event.ID, &event.Topic, &event.Key, &payload, &event.CreatedAt, &event.Attempts)
+		if err != nil {
+			return nil, ClassifyError(err)
+		}
+		event.Payload = json.RawMessage(payload)
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, ClassifyError(err)
+	}
+
+	return events, nil
+}
+
+// delivered marks the events delivered.
+func (r *OutboxRelay) delivered(ctx context.Context, tx DBPreparerExecutor, events []OutboxEvent) error {
+	preparedStatement, err := PrepareStatement(
+		"UPDATE " + r.outbox.table + " SET delivered_at = now() WHERE event_id = ANY(@event_ids)",
+	)
+	if err != nil {
+		return err
+	}
+
+	eventIDs := make([]int64, len(events))
+	for i := range events {
+		eventIDs[i] = events[i].ID
+	}
+
+	_, err = ExecContext(ctx, tx, preparedStatement, BindParameterValue("event_ids", pq.Array(eventIDs)))
+	return err
+}
+
+// failed records the failed attempt of the events, scheduling them to be attempted again after their
+// backoff or dead-lettering them.
+func (r *OutboxRelay) failed(ctx context.Context, tx DBPreparerExecutor, events []OutboxEvent, publishErr error) error {
+	preparedStatement, err := PrepareStatement(
+		"UPDATE " + r.outbox.table + " SET attempts = attempts + 1, last_error = @last_error," +
+			" next_attempt_at = now() + make_interval(secs => @backoff_seconds)," +
+			" dead_lettered_at = CASE WHEN @dead_letter THEN now() END WHERE event_id = @event_id",
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, event := range events {
+		_, err := ExecContext(
+			ctx,
+			tx,
+			preparedStatement,
+			BindParameterValue("last_error", publishErr.Error()),
+			BindParameterValue("backoff_seconds", r.policy.Backoff.Backoff(event.Attempts+1).Seconds()),
+			BindParameterValue("dead_letter", r.deadLettered(event)),
+			BindParameterValue("event_id", event.ID),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deadLettered reports whether the failed attempt of the event was its last.
+func (r *OutboxRelay) deadLettered(event OutboxEvent) bool {
+	return r.policy.MaxAttempts > 0 && event.Attempts+1 >= r.policy.MaxAttempts
+}
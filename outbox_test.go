@@ -0,0 +1,220 @@
+package dbsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutbox(t *testing.T) {
+	t.Parallel()
+
+	createdAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	outboxRows := func(attempts ...int) *fakeRows {
+		rows := newFakeRows([]string{"event_id", "topic", "event_key", "payload", "created_at", "attempts"})
+		for i := range attempts {
+			rows.values = append(rows.values, []driver.Value{
+				i + 1, "orders", "7", []byte(`{"order_id":7}`), createdAt, attempts[i],
+			})
+		}
+		return rows
+	}
+
+	tests := []struct {
+		desc      string
+		assertion func(*testing.T, string)
+	}{
+		{
+			desc: "Events are written with the caller's transaction",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fake := NewFakeDB(t)
+
+				outbox, err := NewOutbox("billing.outbox")
+				require.NoError(t, err, desc)
+
+				err = outbox.Write(context.Background(), sqlDB, "orders", "7", MappedRow{"order_id": 7})
+				require.EqualError(t, err, "outbox events must be written inside a transaction", desc)
+
+				err = WithTransaction(context.Background(), sqlDB, nil, func(ctx context.Context, tx DBPreparerExecutor) error {
+					if err := outbox.Write(ctx, tx, "orders", "7", MappedRow{"order_id": 7}); err != nil {
+						return err
+					}
+					return outbox.Write(ctx, WithSingleflight(tx), "invoices", "", json.RawMessage(`{"invoice_id":3}`))
+				})
+				require.NoError(t, err, desc)
+				require.Equal(t, 1, fake.Commits, desc)
+				require.Len(t, fake.Execs, 2, desc)
+				require.Equal(
+					t,
+					`INSERT INTO "billing"."outbox" (topic, event_key, payload) VALUES ($1, $2, $3)`,
+					fake.Execs[0].Query,
+					desc,
+				)
+				require.Equal(t, []any{"orders", "7", `{"order_id":7}`}, fake.Execs[0].Args, desc)
+				require.Equal(t, []any{"invoices", "", `{"invoice_id":3}`}, fake.Execs[1].Args, desc)
+
+				_, err = NewOutbox(" ")
+				require.EqualError(t, err, "table is empty", desc)
+			},
+		},
+		{
+			desc: "Published batches are claimed with SKIP LOCKED and marked delivered",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fake := NewFakeDB(t)
+				fake.QueryFunc = func(string, []any) (driver.Rows, error) {
+					return outboxRows(0, 1), nil
+				}
+
+				outbox, err := NewOutbox("outbox")
+				require.NoError(t, err, desc)
+
+				var published []OutboxEvent
+				relay, err := NewOutboxRelay(sqlDB, outbox, func(_ context.Context, events []OutboxEvent) error {
+					published = events
+					return nil
+				}, DefaultOutboxRelayPolicy())
+				require.NoError(t, err, desc)
+
+				events, err := relay.RelayBatch(context.Background())
+				require.NoError(t, err, desc)
+				require.Equal(t, 2, events, desc)
+				require.Equal(
+					t,
+					[]OutboxEvent{
+						{ID: 1, Topic: "orders", Key: "7", Payload: json.RawMessage(`{"order_id":7}`), CreatedAt: createdAt},
+						{ID: 2, Topic: "orders", Key: "7", Payload: json.RawMessage(`{"order_id":7}`), CreatedAt: createdAt, Attempts: 1},
+					},
+					published,
+					desc,
+				)
+
+				require.Equal(
+					t,
+					fakeDriverCall{
+						Query: `SELECT event_id, topic, event_key, payload, created_at, attempts FROM "outbox"` +
+							` WHERE delivered_at IS NULL AND dead_lettered_at IS NULL AND next_attempt_at <= now()` +
+							` ORDER BY event_id LIMIT $1 FOR UPDATE SKIP LOCKED`,
+						Args: []any{100},
+						Conn: 1,
+					},
+					fake.LastQuery(),
+					desc,
+				)
+				require.Equal(
+					t,
+					fakeDriverCall{
+						Query: `UPDATE "outbox" SET delivered_at = now() WHERE event_id = ANY($1)`,
+						Args:  []any{pq.Array([]int64{1, 2})},
+						Conn:  1,
+					},
+					fake.LastExec(),
+					desc,
+				)
+				require.Equal(t, 1, fake.Begins, desc)
+				require.Equal(t, 1, fake.Commits, desc)
+			},
+		},
+		{
+			desc: "Failed batches are attempted again after a backoff and dead-lettered after MaxAttempts",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fake := NewFakeDB(t)
+				fake.QueryFunc = func(string, []any) (driver.Rows, error) {
+					return outboxRows(0, 2), nil
+				}
+
+				outbox, err := NewOutbox("outbox")
+				require.NoError(t, err, desc)
+
+				publishErr := errors.New("broker unavailable")
+				var deadLettered []int64
+				policy := DefaultOutboxRelayPolicy()
+				policy.MaxAttempts = 3
+				policy.Backoff = RetryPolicy{InitialBackoff: time.Second, Multiplier: 2}
+				policy.OnDeadLetter = func(_ context.Context, event OutboxEvent, err error) {
+					require.ErrorIs(t, err, publishErr, desc)
+					deadLettered = append(deadLettered, event.ID)
+				}
+
+				relay, err := NewOutboxRelay(sqlDB, outbox, func(context.Context, []OutboxEvent) error {
+					return publishErr
+				}, policy)
+				require.NoError(t, err, desc)
+
+				events, err := relay.RelayBatch(context.Background())
+				require.ErrorIs(t, err, publishErr, desc)
+				require.Equal(t, 2, events, desc)
+				require.Equal(t, []int64{2}, deadLettered, desc)
+
+				require.Len(t, fake.Execs, 2, desc)
+				require.Equal(
+					t,
+					`UPDATE "outbox" SET attempts = attempts + 1, last_error = $1,`+
+						` next_attempt_at = now() + make_interval(secs => $2),`+
+						` dead_lettered_at = CASE WHEN $3 THEN now() END WHERE event_id = $4`,
+					fake.Execs[0].Query,
+					desc,
+				)
+				require.Equal(t, []any{"broker unavailable", 1.0, false, int64(1)}, fake.Execs[0].Args, desc)
+				require.Equal(t, []any{"broker unavailable", 4.0, true, int64(2)}, fake.Execs[1].Args, desc)
+				require.Equal(t, 1, fake.Commits, desc)
+			},
+		},
+		{
+			desc: "Run relays full batches back to back until the outbox is drained",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fake := NewFakeDB(t)
+
+				batches := make(chan *fakeRows, 3)
+				batches <- outboxRows(0, 0)
+				batches <- outboxRows(0, 0)
+				batches <- outboxRows(0)
+				fake.QueryFunc = func(string, []any) (driver.Rows, error) {
+					select {
+					case rows := <-batches:
+						return rows, nil
+					default:
+						return outboxRows(), nil
+					}
+				}
+
+				outbox, err := NewOutbox("outbox")
+				require.NoError(t, err, desc)
+
+				policy := DefaultOutboxRelayPolicy()
+				policy.BatchSize = 2
+				policy.PollInterval = time.Hour
+				relay, err := NewOutboxRelay(sqlDB, outbox, func(context.Context, []OutboxEvent) error {
+					return nil
+				}, policy)
+				require.NoError(t, err, desc)
+
+				ctx, cancel := context.WithCancel(context.Background())
+				done := make(chan error, 1)
+				go func() {
+					done <- relay.Run(ctx)
+				}()
+
+				require.Eventually(t, func() bool {
+					return fake.ExecCount() == 3
+				}, 5*time.Second, time.Millisecond, desc)
+				cancel()
+				require.ErrorIs(t, <-done, context.Canceled, desc)
+				require.Equal(t, 3, fake.QueryCount(), desc)
+			},
+		},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			tc.assertion(t, tc.desc)
+		})
+	}
+}
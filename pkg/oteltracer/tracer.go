@@ -0,0 +1,93 @@
+// Package oteltracer adapts an OpenTelemetry trace.Tracer to the dbsql.Tracer interface.
+package oteltracer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/neumachen/dbsql"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// New returns a dbsql.Tracer that starts client spans with tracer.
+//
+// Example:
+//
+//	db := dbsql.WithTracer(sqlDB, oteltracer.New(otel.Tracer("github.com/neumachen/dbsql")))
+func New(tracer trace.Tracer) dbsql.Tracer {
+	return &otelTracer{tracer: tracer}
+}
+
+type otelTracer struct {
+	tracer trace.Tracer
+}
+
+// StartSpan starts an OpenTelemetry client span as a child of the span in ctx.
+func (o *otelTracer) StartSpan(ctx context.Context, name string) (context.Context, dbsql.Span) {
+	ctx, span := o.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient))
+	return ctx, &otelSpan{span: span}
+}
+
+type otelSpan struct {
+	span trace.Span
+}
+
+// SetAttributes converts the attributes to OpenTelemetry attributes and sets them on the span.
+func (o *otelSpan) SetAttributes(attrs ...dbsql.Attribute) {
+	keyValues := make([]attribute.KeyValue, 0, len(attrs))
+	for i := range attrs {
+		keyValues = append(keyValues, keyValue(attrs[i]))
+	}
+	o.span.SetAttributes(keyValues...)
+}
+
+// End records err, if any, and ends the span.
+func (o *otelSpan) End(err error) {
+	if err != nil {
+		o.span.RecordError(err)
+		o.span.SetStatus(codes.Error, err.Error())
+	}
+	o.span.End()
+}
+
+// keyValue converts a dbsql.Attribute to an OpenTelemetry attribute, falling back to the value's
+// string representation for types OpenTelemetry does not support.
+func keyValue(attr dbsql.Attribute) attribute.KeyValue {
+	key := attribute.Key(attr.Key)
+
+	switch value := attr.Value.(type) {
+	case string:
+		return key.String(value)
+	case bool:
+		return key.Bool(value)
+	case int:
+		return key.Int(value)
+	case int64:
+		return key.Int64(value)
+	case float64:
+		return key.Float64(value)
+	case []string:
+		return key.StringSlice(value)
+	case fmt.Stringer:
+		return key.String(value.String())
+	default:
+		return key.String(fmt.Sprint(value))
+	}
+}
+
+// TraceparentSQLCommentTag returns a dbsql.SQLCommenterOption that adds the W3C traceparent of the span
+// in the call's context to the SQL comment.
+func TraceparentSQLCommentTag() dbsql.SQLCommenterOption {
+	return dbsql.WithSQLCommentTagFunc("traceparent", Traceparent)
+}
+
+// Traceparent returns the W3C traceparent of the span in ctx, or an empty string if ctx has no valid span.
+func Traceparent(ctx context.Context) string {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.IsValid() {
+		return ""
+	}
+	return fmt.Sprintf("00-%s-%s-%s", spanContext.TraceID(), spanContext.SpanID(), spanContext.TraceFlags())
+}
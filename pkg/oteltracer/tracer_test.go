@@ -0,0 +1,64 @@
+package oteltracer
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/neumachen/dbsql"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracer(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	tracer := New(provider.Tracer("dbsql"))
+
+	ctx, parent := tracer.StartSpan(context.Background(), "dbsql.transaction")
+	_, child := tracer.StartSpan(ctx, "SELECT")
+	child.SetAttributes(
+		dbsql.Attribute{Key: dbsql.AttributeDBStatement, Value: "SELECT 1"},
+		dbsql.Attribute{Key: dbsql.AttributeParameterCount, Value: 2},
+		dbsql.Attribute{Key: dbsql.AttributeRowsAffected, Value: int64(3)},
+	)
+	child.End(errors.New("mock error"))
+	parent.End(nil)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+
+	require.Equal(t, "SELECT", spans[0].Name())
+	require.Equal(t, spans[1].SpanContext().SpanID(), spans[0].Parent().SpanID())
+	require.Equal(t, codes.Error, spans[0].Status().Code)
+	require.Equal(
+		t,
+		[]attribute.KeyValue{
+			attribute.String(dbsql.AttributeDBStatement, "SELECT 1"),
+			attribute.Int(dbsql.AttributeParameterCount, 2),
+			attribute.Int64(dbsql.AttributeRowsAffected, 3),
+		},
+		spans[0].Attributes(),
+	)
+
+	require.Equal(t, "dbsql.transaction", spans[1].Name())
+	require.Equal(t, codes.Unset, spans[1].Status().Code)
+}
+
+func TestTraceparent(t *testing.T) {
+	require.Empty(t, Traceparent(context.Background()))
+
+	provider := sdktrace.NewTracerProvider()
+	ctx, span := provider.Tracer("dbsql").Start(context.Background(), "request")
+	defer span.End()
+
+	spanContext := span.SpanContext()
+	require.Equal(
+		t,
+		"00-"+spanContext.TraceID().String()+"-"+spanContext.SpanID().String()+"-01",
+		Traceparent(ctx),
+	)
+}
@@ -26,6 +26,8 @@ const (
 // 2. Stores the positions of the named parameters in a NamedParameterPositions struct.
 // 3. Returns a preparedStatement struct that implements the PreparedStatement interface.
 //
+// Options such as StatementName can be given to attach metadata to the statement.
+//
 // Example usage:
 //
 //	preparedStmt, err := PrepareStatement("SELECT * FROM users WHERE name = @name AND age > @age")
@@ -45,7 +47,7 @@ const (
 //	for rows.Next() {
 //		// process rows
 //	}
-func PrepareStatement(unpreparedStatement string) (PreparedStatement, error) {
+func PrepareStatement(unpreparedStatement string, opts ...PrepareStatementOption) (PreparedStatement, error) {
 	var revisedStatement []byte
 	var namedParameter []byte
 	unpreparedStatementByte := []byte(unpreparedStatement)
@@ -111,12 +113,109 @@ func PrepareStatement(unpreparedStatement string) (PreparedStatement, error) {
 	}
 
 	// Return a new preparedStatement struct with the revised statement, named parameter positions, and other information
-	return &preparedStatement{
+	prepared := &preparedStatement{
 		originalStatement:     unpreparedStatement,
 		namedParamPositions:   &namedParamPositions,
 		revisedStatement:      string(revisedStatement),
 		boundNamedParamValues: make(BoundParameterValues, positionIndex),
-	}, nil
+		classification:        ClassifyStatement(unpreparedStatement),
+	}
+	for i := range opts {
+		if opts[i] != nil {
+			opts[i](prepared)
+		}
+	}
+
+	return prepared, nil
+}
+
+// PrepareStatementOption is a function type used to attach metadata to a statement created by PrepareStatement.
+type PrepareStatementOption func(statement *preparedStatement)
+
+// StatementName names the statement. The name is used instead of the SQL fingerprint to identify the
+// statement in metrics and other per-statement bookkeeping.
+//
+// Example:
+//
+//	preparedStmt, err := PrepareStatement(createCustomerQuery, StatementName("create_customer"))
+func StatementName(name string) PrepareStatementOption {
+	return func(statement *preparedStatement) {
+		statement.name = name
+	}
+}
+
+// Idempotent marks the statement as safe to execute more than once, allowing RetryInterceptor to retry
+// it after a transient error even if it writes.
+//
+// Example:
+//
+//	preparedStmt, err := PrepareStatement(upsertCustomerQuery, Idempotent())
+func Idempotent() PrepareStatementOption {
+	return func(statement *preparedStatement) {
+		statement.idempotent = true
+	}
+}
+
+// Volatile marks the statement as returning different results for identical calls, e.g. a SELECT
+// calling nextval() or random(), so SingleflightDB never shares its round trip and CachedDB never caches
+// its rows.
+//
+// Example:
+//
+//	preparedStmt, err := PrepareStatement("SELECT nextval('order_numbers')", Volatile())
+func Volatile() PrepareStatementOption {
+	return func(statement *preparedStatement) {
+		statement.volatile = true
+	}
+}
+
+// Cacheable allows CachedDB to cache the rows of the statement. Reads are not cached unless marked, since
+// the cache cannot tell from the SQL whether a query calls functions or reads tables it does not see.
+//
+// Example:
+//
+//	preparedStmt, err := PrepareStatement(selectCountriesQuery, Cacheable())
+func Cacheable() PrepareStatementOption {
+	return func(statement *preparedStatement) {
+		statement.cacheable = true
+	}
+}
+
+// ClassifyAs overrides the kind the statement is classified as from its SQL, for statements whose SQL
+// hides what they do, e.g. a SELECT calling a function that writes. The kind decides, among others, where
+// a Router sends the statement and whether RetryInterceptor may retry it.
+//
+// Example:
+//
+//	preparedStmt, err := PrepareStatement("SELECT archive_orders(@before)", ClassifyAs(StatementWrite))
+func ClassifyAs(kind StatementKind) PrepareStatementOption {
+	return func(statement *preparedStatement) {
+		statement.classification.Kind = kind
+	}
+}
+
+// ShardKey nominates the parameter whose bound value picks the shard a ShardedDB runs the statement on.
+//
+// Example:
+//
+//	preparedStmt, err := PrepareStatement(selectCustomerQuery, ShardKey("customer_id"))
+func ShardKey(parameter string) PrepareStatementOption {
+	return func(statement *preparedStatement) {
+		statement.shardKey = parameter
+	}
+}
+
+// ShardBroadcast allows a ShardedDB to run the statement on every shard when it is sent without a shard
+// key, e.g. a cleanup job. Without it, only statements that read data are scattered to every shard and
+// the others fail with ErrNoShardKey.
+//
+// Example:
+//
+//	preparedStmt, err := PrepareStatement(deleteExpiredCartsQuery, ShardBroadcast())
+func ShardBroadcast() PrepareStatementOption {
+	return func(statement *preparedStatement) {
+		statement.broadcast = true
+	}
 }
 
 // isStartOfNamedParameter checks if the current character is the start of a named parameter.
@@ -1,6 +1,8 @@
 package dbsql
 
 import (
+	"sort"
+
 	"github.com/neumachen/dbsql/internal"
 )
 
@@ -44,6 +46,24 @@ func (p *ParameterPositions) insert(parameter string, position int) {
 	p.totalPositions++
 }
 
+// Parameters returns the parameter names, ordered by their first position in the SQL statement.
+func (p ParameterPositions) Parameters() []string {
+	if len(p.parameterPositions) < 1 {
+		return nil
+	}
+
+	parameters := make([]string, 0, len(p.parameterPositions))
+	for parameter := range p.parameterPositions {
+		parameters = append(parameters, parameter)
+	}
+
+	sort.Slice(parameters, func(i, j int) bool {
+		return p.parameterPositions[parameters[i]][0] < p.parameterPositions[parameters[j]][0]
+	})
+
+	return parameters
+}
+
 // BoundParameterValues is a type alias for a slice of any (an empty interface).
 // It represents the positional parameters in an SQL statement.
 type BoundParameterValues []any
@@ -66,12 +86,129 @@ type PreparedStatement interface {
 	BindParameterValues(binderFuncs ...BindParameterValueFunc) error
 }
 
+// The metadata attached to a statement by the PrepareStatementOptions is exposed through the optional
+// interfaces below rather than through PreparedStatement, so implementations of PreparedStatement made
+// outside this package keep satisfying it. The statements returned by PrepareStatement implement all of
+// them; for other statements the package checks them with a type assertion and falls back to a default.
+
+// NamedStatement is implemented by statements that carry a name, given with StatementName.
+type NamedStatement interface {
+	// Name returns the name given with StatementName, or an empty string if the statement is unnamed.
+	Name() string
+}
+
+// IdempotentStatement is implemented by statements that can be marked with Idempotent.
+type IdempotentStatement interface {
+	// Idempotent returns true if the statement was marked with Idempotent.
+	Idempotent() bool
+}
+
+// VolatileStatement is implemented by statements that can be marked with Volatile.
+type VolatileStatement interface {
+	// Volatile returns true if the statement was marked with Volatile.
+	Volatile() bool
+}
+
+// CacheableStatement is implemented by statements that can be marked with Cacheable.
+type CacheableStatement interface {
+	// Cacheable returns true if the statement was marked with Cacheable.
+	Cacheable() bool
+}
+
+// ShardedStatement is implemented by statements that can be routed by a shard key, given with ShardKey.
+type ShardedStatement interface {
+	// ShardKey returns the parameter given with ShardKey, or an empty string if none was given.
+	ShardKey() string
+	// Broadcast returns true if the statement was marked with ShardBroadcast.
+	Broadcast() bool
+}
+
+// ClassifiedStatement is implemented by statements that carry their classification. Statements that do
+// not implement it are classified with ClassifyStatement.
+type ClassifiedStatement interface {
+	// Kind returns the classification of the statement, e.g. StatementRead or StatementWrite.
+	Kind() StatementKind
+	// Tables returns the tables referenced by the statement.
+	Tables() []string
+}
+
+// statementName returns the name of the statement, or an empty string if it has none.
+func statementName(preparedStatement PreparedStatement) string {
+	if named, ok := preparedStatement.(NamedStatement); ok {
+		return named.Name()
+	}
+	return ""
+}
+
+// statementIdempotent reports whether the statement was marked with Idempotent.
+func statementIdempotent(preparedStatement PreparedStatement) bool {
+	if idempotent, ok := preparedStatement.(IdempotentStatement); ok {
+		return idempotent.Idempotent()
+	}
+	return false
+}
+
+// statementVolatile reports whether the statement was marked with Volatile.
+func statementVolatile(preparedStatement PreparedStatement) bool {
+	if volatile, ok := preparedStatement.(VolatileStatement); ok {
+		return volatile.Volatile()
+	}
+	return false
+}
+
+// statementCacheable reports whether the statement was marked with Cacheable.
+func statementCacheable(preparedStatement PreparedStatement) bool {
+	if cacheable, ok := preparedStatement.(CacheableStatement); ok {
+		return cacheable.Cacheable()
+	}
+	return false
+}
+
+// statementShardKey returns the shard key parameter of the statement, or an empty string if it has none.
+func statementShardKey(preparedStatement PreparedStatement) string {
+	if sharded, ok := preparedStatement.(ShardedStatement); ok {
+		return sharded.ShardKey()
+	}
+	return ""
+}
+
+// statementBroadcast reports whether the statement was marked with ShardBroadcast.
+func statementBroadcast(preparedStatement PreparedStatement) bool {
+	if sharded, ok := preparedStatement.(ShardedStatement); ok {
+		return sharded.Broadcast()
+	}
+	return false
+}
+
+// statementKind returns the kind of the statement.
+func statementKind(preparedStatement PreparedStatement) StatementKind {
+	if classified, ok := preparedStatement.(ClassifiedStatement); ok {
+		return classified.Kind()
+	}
+	return ClassifyStatement(preparedStatement.UnpreparedStatement()).Kind
+}
+
+// statementTables returns the tables referenced by the statement.
+func statementTables(preparedStatement PreparedStatement) []string {
+	if classified, ok := preparedStatement.(ClassifiedStatement); ok {
+		return classified.Tables()
+	}
+	return ClassifyStatement(preparedStatement.UnpreparedStatement()).Tables
+}
+
 // preparedStatement is a struct that handles the translation of named parameters to positional parameters for SQL statements.
 type preparedStatement struct {
 	boundNamedParamValues BoundParameterValues
 	namedParamPositions   *ParameterPositions
 	revisedStatement      string
 	originalStatement     string
+	name                  string
+	idempotent            bool
+	volatile              bool
+	cacheable             bool
+	shardKey              string
+	broadcast             bool
+	classification        StatementClassification
 }
 
 // getTotalIndices returns the total number of parameter positions in the statement.
@@ -89,6 +226,49 @@ func (p *preparedStatement) ResetParametersValues() {
 	}
 }
 
+// Name returns the name given with StatementName, or an empty string if the statement is unnamed.
+func (p preparedStatement) Name() string {
+	return p.name
+}
+
+// Idempotent returns true if the statement was marked with Idempotent.
+func (p preparedStatement) Idempotent() bool {
+	return p.idempotent
+}
+
+// Volatile returns true if the statement was marked with Volatile.
+func (p preparedStatement) Volatile() bool {
+	return p.volatile
+}
+
+// Cacheable returns true if the statement was marked with Cacheable.
+func (p preparedStatement) Cacheable() bool {
+	return p.cacheable
+}
+
+// ShardKey returns the parameter given with ShardKey, or an empty string if none was given.
+func (p preparedStatement) ShardKey() string {
+	return p.shardKey
+}
+
+// Broadcast returns true if the statement was marked with ShardBroadcast.
+func (p preparedStatement) Broadcast() bool {
+	return p.broadcast
+}
+
+// Kind returns the classification of the statement, e.g. StatementRead or StatementWrite.
+func (p preparedStatement) Kind() StatementKind {
+	return p.classification.Kind
+}
+
+// Tables returns the tables referenced by the statement, in order of first appearance.
+func (p preparedStatement) Tables() []string {
+	if len(p.classification.Tables) < 1 {
+		return nil
+	}
+	return append([]string(nil), p.classification.Tables...)
+}
+
 // UnpreparedStatement returns the original SQL statement before preparation.
 func (p preparedStatement) UnpreparedStatement() string {
 	return p.originalStatement
@@ -136,6 +316,69 @@ func (p *preparedStatement) BindParameterValue(parameterName string, bindValue a
 	return nil
 }
 
+// NamedParameterValues maps parameter names to their bound values.
+type NamedParameterValues map[string]any
+
+// BoundNamedParameterValues returns the values bound to the prepared statement keyed by parameter name
+// rather than by position. It returns nil if the statement has no parameters.
+func BoundNamedParameterValues(preparedStatement PreparedStatement) NamedParameterValues {
+	if internal.IsNil(preparedStatement) {
+		return nil
+	}
+
+	positions := preparedStatement.ParameterPositions()
+	if positions == nil {
+		return nil
+	}
+
+	boundValues := preparedStatement.BoundParameterValues()
+	namedValues := make(NamedParameterValues, len(positions.parameterPositions))
+	for parameter, indices := range positions.parameterPositions {
+		if len(indices) < 1 || indices[0] >= len(boundValues) {
+			namedValues[parameter] = nil
+			continue
+		}
+		namedValues[parameter] = boundValues[indices[0]]
+	}
+
+	return namedValues
+}
+
+// copyPreparedStatement returns a copy of the prepared statement with the same options and bound values,
+// which can be used while the original is rebound.
+func copyPreparedStatement(preparedStatement PreparedStatement) (PreparedStatement, error) {
+	opts := []PrepareStatementOption{
+		StatementName(statementName(preparedStatement)),
+		ShardKey(statementShardKey(preparedStatement)),
+		ClassifyAs(statementKind(preparedStatement)),
+	}
+	if statementIdempotent(preparedStatement) {
+		opts = append(opts, Idempotent())
+	}
+	if statementVolatile(preparedStatement) {
+		opts = append(opts, Volatile())
+	}
+	if statementCacheable(preparedStatement) {
+		opts = append(opts, Cacheable())
+	}
+	if statementBroadcast(preparedStatement) {
+		opts = append(opts, ShardBroadcast())
+	}
+
+	copied, err := PrepareStatement(preparedStatement.UnpreparedStatement(), opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	for parameter, value := range BoundNamedParameterValues(preparedStatement) {
+		if err := copied.BindParameterValue(parameter, value); err != nil {
+			return nil, err
+		}
+	}
+
+	return copied, nil
+}
+
 // BindParameterValueFunc is a function that sets the value for a named parameter in the query.
 type BindParameterValueFunc func(p PreparedStatement) error
 
@@ -174,4 +417,12 @@ func (p *preparedStatement) BindParameterValues(binderFuncs ...BindParameterValu
 	return nil
 }
 
-var _ PreparedStatement = (*preparedStatement)(nil)
+var (
+	_ PreparedStatement   = (*preparedStatement)(nil)
+	_ NamedStatement      = (*preparedStatement)(nil)
+	_ IdempotentStatement = (*preparedStatement)(nil)
+	_ VolatileStatement   = (*preparedStatement)(nil)
+	_ CacheableStatement  = (*preparedStatement)(nil)
+	_ ShardedStatement    = (*preparedStatement)(nil)
+	_ ClassifiedStatement = (*preparedStatement)(nil)
+)
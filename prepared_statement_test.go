@@ -1 +1,55 @@
 package dbsql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBoundNamedParameterValues(t *testing.T) {
+	preparedStatement, err := PrepareStatement("SELECT * FROM table WHERE col1 = @foo AND col2 = @bar AND col3 = @foo")
+	require.NoError(t, err)
+	require.NoError(t, preparedStatement.BindParameterValues(
+		BindParameterValue("foo", "something"),
+		BindParameterValue("bar", 2),
+	))
+
+	require.Equal(t, []string{"foo", "bar"}, preparedStatement.ParameterPositions().Parameters())
+	require.Equal(
+		t,
+		NamedParameterValues{"foo": "something", "bar": 2},
+		BoundNamedParameterValues(preparedStatement),
+	)
+}
+
+// externalStatement is a PreparedStatement implemented outside the package, without the optional
+// metadata interfaces.
+type externalStatement struct {
+	PreparedStatement
+}
+
+func TestPreparedStatementOptionalInterfaces(t *testing.T) {
+	preparedStatement, err := PrepareStatement(
+		"DELETE FROM customers WHERE customer_id = @customer_id",
+		StatementName("delete_customer"),
+		Idempotent(),
+		Volatile(),
+		Cacheable(),
+		ShardKey("customer_id"),
+	)
+	require.NoError(t, err)
+	require.Equal(t, "delete_customer", statementName(preparedStatement))
+	require.True(t, statementIdempotent(preparedStatement))
+	require.True(t, statementVolatile(preparedStatement))
+	require.True(t, statementCacheable(preparedStatement))
+	require.Equal(t, "customer_id", statementShardKey(preparedStatement))
+
+	external := externalStatement{PreparedStatement: preparedStatement}
+	require.Empty(t, statementName(external))
+	require.False(t, statementIdempotent(external))
+	require.False(t, statementVolatile(external))
+	require.False(t, statementCacheable(external))
+	require.Empty(t, statementShardKey(external))
+	require.Equal(t, StatementWrite, statementKind(external))
+	require.Equal(t, []string{"customers"}, statementTables(external))
+}
@@ -0,0 +1,118 @@
+package dbsql
+
+import (
+	"context"
+	"database/sql"
+)
+
+// readOnlyKinds are the kinds of statements refused by ReadOnlyDB. Statements that cannot be classified,
+// such as EXECUTE, may write and are refused as well.
+var readOnlyKinds = map[StatementKind]bool{
+	StatementUnknown: true,
+	StatementWrite:   true,
+	StatementDDL:     true,
+}
+
+// ReadOnlyDB is a database handle that refuses statements that write data or change the schema before
+// they are sent, returning ErrReadOnly. It is returned by WithReadOnly. Statements that cannot be
+// classified, such as EXECUTE of a statement prepared with PREPARE, are refused as well.
+//
+// Statements are classified from their SQL, see ClassifyStatement, so writes hidden in functions called
+// from a SELECT are only caught by the database: transactions opened through a ReadOnlyDB are made read
+// only with SET TRANSACTION READ ONLY, and the read_only_sql_transaction error they raise also matches
+// ErrReadOnly. QueryRow and QueryRowContext cannot report an error before the statement is sent and are
+// forwarded as is; use the package-level QueryRowContext instead.
+type ReadOnlyDB struct {
+	wrappedDB
+}
+
+// WithReadOnly wraps dbPrepExec so that the statements that write data or change the schema are refused,
+// e.g. during a maintenance window or on a handle backed by a replica.
+//
+// Example:
+//
+//	db := dbsql.WithReadOnly(sqlDB)
+//	_, err := dbsql.ExecContext(ctx, db, updateCustomer)
+//	errors.Is(err, dbsql.ErrReadOnly) // true
+func WithReadOnly(dbPrepExec DBPreparerExecutor) *ReadOnlyDB {
+	return &ReadOnlyDB{wrappedDB: wrappedDB{dbPrepExec}}
+}
+
+// InterceptCall returns ErrReadOnly for a call that writes data or changes the schema, and otherwise runs
+// the interceptor chain of the wrapped handle, if any.
+func (r *ReadOnlyDB) InterceptCall(ctx context.Context, call *Call, next CallHandler) (*CallResult, error) {
+	if readOnlyKinds[callKind(call)] {
+		return nil, ErrReadOnly
+	}
+	return interceptCall(ctx, r.DBPreparerExecutor, call, next)
+}
+
+// RunInTx runs txFunc inside a read-only transaction started on the wrapped handle. The tx handle given
+// to txFunc refuses writes as well.
+func (r *ReadOnlyDB) RunInTx(ctx context.Context, opts *sql.TxOptions, txFunc TxFunc) error {
+	return WithTransaction(ctx, r.DBPreparerExecutor, opts, func(ctx context.Context, tx DBPreparerExecutor) error {
+		if _, err := tx.ExecContext(ctx, "SET TRANSACTION READ ONLY"); err != nil {
+			return ClassifyError(err)
+		}
+		return txFunc(ctx, WithReadOnly(tx))
+	})
+}
+
+// checkQuery returns ErrReadOnly if the query writes data or changes the schema.
+func (r *ReadOnlyDB) checkQuery(query string) error {
+	if readOnlyKinds[ClassifyStatement(query).Kind] {
+		return ErrReadOnly
+	}
+	return nil
+}
+
+// Prepare prepares the query on the wrapped handle unless it writes data or changes the schema.
+func (r *ReadOnlyDB) Prepare(query string) (*sql.Stmt, error) {
+	return r.PrepareContext(context.Background(), query)
+}
+
+// Exec executes the query on the wrapped handle unless it writes data or changes the schema.
+func (r *ReadOnlyDB) Exec(query string, args ...any) (sql.Result, error) {
+	return r.ExecContext(context.Background(), query, args...)
+}
+
+// Query executes the query on the wrapped handle unless it writes data or changes the schema.
+func (r *ReadOnlyDB) Query(query string, args ...any) (*sql.Rows, error) {
+	return r.QueryContext(context.Background(), query, args...)
+}
+
+// PrepareContext prepares the query on the wrapped handle unless it writes data or changes the schema.
+func (r *ReadOnlyDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	if err := r.checkQuery(query); err != nil {
+		return nil, err
+	}
+	return r.DBPreparerExecutor.PrepareContext(ctx, query)
+}
+
+// ExecContext executes the query on the wrapped handle unless it writes data or changes the schema.
+func (r *ReadOnlyDB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	if err := r.checkQuery(query); err != nil {
+		return nil, err
+	}
+	return r.DBPreparerExecutor.ExecContext(ctx, query, args...)
+}
+
+// QueryContext executes the query on the wrapped handle unless it writes data or changes the schema.
+func (r *ReadOnlyDB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	if err := r.checkQuery(query); err != nil {
+		return nil, err
+	}
+	return r.DBPreparerExecutor.QueryContext(ctx, query, args...)
+}
+
+// wrapSession returns conn refusing writes as well.
+func (r *ReadOnlyDB) wrapSession(conn DBPreparerExecutor) DBPreparerExecutor {
+	return WithReadOnly(conn)
+}
+
+var (
+	_ DB             = (*ReadOnlyDB)(nil)
+	_ DBInterceptor  = (*ReadOnlyDB)(nil)
+	_ DBTransactor   = (*ReadOnlyDB)(nil)
+	_ sessionWrapper = (*ReadOnlyDB)(nil)
+)
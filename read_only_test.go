@@ -0,0 +1,114 @@
+package dbsql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadOnlyDB(t *testing.T) {
+	t.Parallel()
+
+	selectCustomers, err := PrepareStatement("SELECT * FROM customers")
+	require.NoError(t, err)
+
+	tests := []struct {
+		desc      string
+		assertion func(*testing.T, string)
+	}{
+		{
+			desc: "Reads are sent and writes and DDL are refused before they are sent",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fake := NewFakeDB(t)
+				db := WithReadOnly(sqlDB)
+
+				rows, err := QueryContext(context.Background(), db, selectCustomers)
+				require.NoError(t, err, desc)
+				require.NoError(t, rows.Close(), desc)
+
+				for _, query := range []string{
+					"UPDATE customers SET first_name = @first_name",
+					"WITH d AS (DELETE FROM carts RETURNING *) SELECT * FROM d",
+					"SELECT * FROM customers FOR UPDATE",
+					"DROP TABLE customers",
+					"PREPARE p AS DELETE FROM customers",
+					"EXECUTE p",
+					"NOTIFY orders",
+					"VACUUM customers",
+					"CLUSTER customers",
+				} {
+					preparedStatement, err := PrepareStatement(query)
+					require.NoError(t, err, desc)
+
+					_, err = ExecContext(context.Background(), db, preparedStatement, BindParameterValue("first_name", "John"))
+					require.ErrorIs(t, err, ErrReadOnly, query)
+				}
+
+				_, err = db.ExecContext(context.Background(), "INSERT INTO customers DEFAULT VALUES")
+				require.ErrorIs(t, err, ErrReadOnly, desc)
+				_, err = db.Prepare("TRUNCATE customers")
+				require.ErrorIs(t, err, ErrReadOnly, desc)
+
+				require.Equal(t, 1, fake.QueryCount(), desc)
+				require.Equal(t, 0, fake.ExecCount(), desc)
+				require.Len(t, fake.Prepared, 1, desc)
+			},
+		},
+		{
+			desc: "Transactions are made read only and refuse writes",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fake := NewFakeDB(t)
+				db := WithReadOnly(sqlDB)
+
+				updateCustomers, err := PrepareStatement("UPDATE customers SET first_name = 'John'")
+				require.NoError(t, err, desc)
+
+				err = WithTransaction(context.Background(), db, nil, func(ctx context.Context, tx DBPreparerExecutor) error {
+					rows, err := QueryContext(ctx, tx, selectCustomers)
+					if err != nil {
+						return err
+					}
+					if err := rows.Close(); err != nil {
+						return err
+					}
+
+					_, err = ExecContext(ctx, tx, updateCustomers)
+					return err
+				})
+				require.ErrorIs(t, err, ErrReadOnly, desc)
+
+				require.Equal(t, 1, fake.Begins, desc)
+				require.Equal(t, 1, fake.Rollbacks, desc)
+				require.Equal(t, 1, fake.ExecCount(), desc)
+				require.Equal(t, "SET TRANSACTION READ ONLY", fake.Execs[0].Query, desc)
+				require.Equal(t, 1, fake.QueryCount(), desc)
+			},
+		},
+		{
+			desc: "Interceptors of the wrapped handle apply",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, _ := NewFakeDB(t)
+
+				intercepted := 0
+				db := WithReadOnly(WithInterceptors(sqlDB, func(ctx context.Context, call *Call, next CallHandler) (*CallResult, error) {
+					intercepted++
+					return next(ctx, call)
+				}))
+
+				rows, err := QueryContext(context.Background(), db, selectCustomers)
+				require.NoError(t, err, desc)
+				require.NoError(t, rows.Close(), desc)
+				require.Equal(t, 1, intercepted, desc)
+			},
+		},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			tc.assertion(t, tc.desc)
+		})
+	}
+}
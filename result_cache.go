@@ -0,0 +1,332 @@
+package dbsql
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CachePolicy configures WithResultCache.
+type CachePolicy struct {
+	// TTL is how long the rows of a query are cached. Values below 1 disable caching.
+	TTL time.Duration
+	// MaxEntries caps the number of cached queries; the least recently used query is evicted first. Zero
+	// means no cap.
+	MaxEntries int
+	// MaxRows is the largest number of rows a query may return to be cached. Zero means no cap.
+	MaxRows int
+}
+
+// cacheEntry is the cached rows of a query.
+type cacheEntry struct {
+	key     string
+	rows    MappedRows
+	tables  []string
+	expires time.Time
+}
+
+// resultCache holds the entries shared by a CachedDB and the tx handles it hands out.
+type resultCache struct {
+	policy CachePolicy
+	now    func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	// generation counts the invalidations, so rows read before an invalidation are not cached after it.
+	generation uint64
+}
+
+// CachedDB is a database handle that caches the rows of read statements marked with Cacheable and
+// queried through QueryRows, or the functions built on it, keyed by their revised SQL and bound values.
+// Statements that are not marked, or are also marked with Volatile, are never cached. It is returned by WithResultCache.
+//
+// Every write or DDL statement executed through the CachedDB, and every CopyFrom into a table through
+// it, invalidates the cached queries that reference one of the tables it references, as listed by
+// ClassifiedStatement.Tables. Tables are matched by
+// name without their schema, so a write to public.customers also invalidates queries on other.customers.
+// Writes made inside a transaction invalidate when the transaction ends. Writes made by other processes,
+// or reaching a table through views, functions or triggers, are not seen: the TTL bounds how stale the
+// rows may get, and Invalidate drops them explicitly.
+type CachedDB struct {
+	wrappedDB
+	cache *resultCache
+	// txWrites collects the tables written inside a transaction; it is nil outside transactions.
+	txWrites *[]string
+}
+
+// WithResultCache wraps dbPrepExec with a result cache configured by policy.
+//
+// Example:
+//
+//	db := dbsql.WithResultCache(sqlDB, dbsql.CachePolicy{TTL: time.Minute, MaxEntries: 1000})
+//	selectCountries, err := dbsql.PrepareStatement(selectCountriesQuery, dbsql.Cacheable())
+//	mappedRows, err := dbsql.QueryRows(ctx, db, selectCountries) // cached for a minute
+//	_, err = dbsql.ExecContext(ctx, db, insertCountry)           // invalidates selectCountries
+func WithResultCache(dbPrepExec DBPreparerExecutor, policy CachePolicy) *CachedDB {
+	return &CachedDB{
+		wrappedDB: wrappedDB{dbPrepExec},
+		cache: &resultCache{
+			policy:  policy,
+			now:     time.Now,
+			entries: make(map[string]*list.Element),
+			lru:     list.New(),
+		},
+	}
+}
+
+// Len returns the number of cached queries, expired ones included until they are evicted.
+func (c *CachedDB) Len() int {
+	c.cache.mu.Lock()
+	defer c.cache.mu.Unlock()
+	return c.cache.lru.Len()
+}
+
+// Invalidate drops the cached queries that reference any of the tables.
+func (c *CachedDB) Invalidate(tables ...string) {
+	c.cache.invalidate(tables)
+}
+
+// Purge drops every cached query.
+func (c *CachedDB) Purge() {
+	c.cache.mu.Lock()
+	defer c.cache.mu.Unlock()
+	c.cache.generation++
+	c.cache.entries = make(map[string]*list.Element)
+	c.cache.lru.Init()
+}
+
+// InterceptCall runs the interceptor chain of the wrapped handle, if any, and invalidates the cached
+// queries on the tables written by the call. QueryRows calls of reads return the cached rows if they have
+// not expired, and otherwise cache a copy of the rows they return.
+func (c *CachedDB) InterceptCall(ctx context.Context, call *Call, next CallHandler) (*CallResult, error) {
+	if c.cacheable(call) {
+		if key, ok := boundQueryKey(call.PreparedStatement); ok {
+			return c.queryCached(ctx, key, call, next)
+		}
+	}
+
+	callResult, err := interceptCall(ctx, c.DBPreparerExecutor, call, next)
+
+	// A failed write may still have been committed, e.g. when the connection broke before the reply.
+	if kind := callKind(call); kind == StatementWrite || kind == StatementDDL {
+		c.wrote(callTables(call))
+	}
+
+	return callResult, err
+}
+
+// cacheable reports whether the rows of the call may be served from, and stored in, the cache. Reads
+// made inside a transaction bypass the cache, since they may see the transaction's own writes.
+func (c *CachedDB) cacheable(call *Call) bool {
+	return call.Operation == OperationQueryRows && c.cache.policy.TTL > 0 && callKind(call) == StatementRead &&
+		statementCacheable(call.PreparedStatement) && !statementVolatile(call.PreparedStatement) &&
+		c.txWrites == nil && !inTransaction(c.DBPreparerExecutor)
+}
+
+// queryCached returns the cached rows of the call if they have not expired, and otherwise runs the call
+// and caches a copy of its rows under key.
+func (c *CachedDB) queryCached(ctx context.Context, key string, call *Call, next CallHandler) (*CallResult, error) {
+	if rows, ok := c.cache.get(key); ok {
+		return &CallResult{MappedRows: rows}, nil
+	}
+
+	generation := c.cache.currentGeneration()
+	callResult, err := interceptCall(ctx, c.DBPreparerExecutor, call, next)
+	if err != nil {
+		return nil, err
+	}
+
+	if callResult != nil {
+		c.cache.put(key, callResult.MappedRows, callTables(call), generation)
+	}
+
+	return callResult, nil
+}
+
+// wrote invalidates the tables, or records them to invalidate when the transaction ends.
+func (c *CachedDB) wrote(tables []string) {
+	if c.txWrites != nil {
+		*c.txWrites = append(*c.txWrites, tables...)
+		return
+	}
+	c.cache.invalidate(tables)
+}
+
+// RunInTx runs txFunc inside a transaction started on the wrapped handle. Reads made inside the
+// transaction bypass the cache, and the tables written by it are invalidated when it ends.
+func (c *CachedDB) RunInTx(ctx context.Context, opts *sql.TxOptions, txFunc TxFunc) error {
+	var txWrites []string
+	defer func() {
+		c.cache.invalidate(txWrites)
+	}()
+
+	return WithTransaction(ctx, c.DBPreparerExecutor, opts, func(ctx context.Context, tx DBPreparerExecutor) error {
+		return txFunc(ctx, &CachedDB{wrappedDB: wrappedDB{tx}, cache: c.cache, txWrites: &txWrites})
+	})
+}
+
+// get returns a copy of the cached rows of the query, if they have not expired.
+func (r *resultCache) get(key string) (MappedRows, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	element, ok := r.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := element.Value.(*cacheEntry)
+	if !r.now().Before(entry.expires) {
+		r.remove(element)
+		return nil, false
+	}
+
+	r.lru.MoveToFront(element)
+	return entry.rows.Clone(), true
+}
+
+// currentGeneration returns the number of invalidations so far.
+func (r *resultCache) currentGeneration() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.generation
+}
+
+// put caches a copy of the rows of the query, unless they are too many or an invalidation happened since
+// the query started at the given generation.
+func (r *resultCache) put(key string, rows MappedRows, tables []string, generation uint64) {
+	if r.policy.MaxRows > 0 && len(rows) > r.policy.MaxRows {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.generation != generation {
+		return
+	}
+
+	if element, ok := r.entries[key]; ok {
+		r.remove(element)
+	}
+
+	entry := &cacheEntry{
+		key:     key,
+		rows:    rows.Clone(),
+		tables:  make([]string, len(tables)),
+		expires: r.now().Add(r.policy.TTL),
+	}
+	for i := range tables {
+		entry.tables[i] = unqualifiedTable(tables[i])
+	}
+	r.entries[key] = r.lru.PushFront(entry)
+
+	for r.policy.MaxEntries > 0 && r.lru.Len() > r.policy.MaxEntries {
+		r.remove(r.lru.Back())
+	}
+}
+
+// invalidate drops the cached queries that reference any of the tables.
+func (r *resultCache) invalidate(tables []string) {
+	if len(tables) < 1 {
+		return
+	}
+
+	invalidated := make(map[string]bool, len(tables))
+	for _, table := range tables {
+		invalidated[unqualifiedTable(table)] = true
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.generation++
+	for element := r.lru.Front(); element != nil; {
+		nextElement := element.Next()
+		for _, table := range element.Value.(*cacheEntry).tables {
+			if invalidated[table] {
+				r.remove(element)
+				break
+			}
+		}
+		element = nextElement
+	}
+}
+
+// remove drops the entry. The caller must hold the lock.
+func (r *resultCache) remove(element *list.Element) {
+	delete(r.entries, element.Value.(*cacheEntry).key)
+	r.lru.Remove(element)
+}
+
+// unqualifiedTable returns the table name without its schema.
+func unqualifiedTable(table string) string {
+	if i := strings.LastIndexByte(table, '.'); i >= 0 {
+		return table[i+1:]
+	}
+	return table
+}
+
+// Exec executes the query on the wrapped handle and invalidates the cached queries on the tables it writes.
+func (c *CachedDB) Exec(query string, args ...any) (sql.Result, error) {
+	return c.ExecContext(context.Background(), query, args...)
+}
+
+// Query executes the query on the wrapped handle and invalidates the cached queries on the tables it
+// writes, e.g. with INSERT ... RETURNING.
+func (c *CachedDB) Query(query string, args ...any) (*sql.Rows, error) {
+	return c.QueryContext(context.Background(), query, args...)
+}
+
+// QueryRow executes the query on the wrapped handle and invalidates the cached queries on the tables it
+// writes.
+func (c *CachedDB) QueryRow(query string, args ...any) *sql.Row {
+	return c.QueryRowContext(context.Background(), query, args...)
+}
+
+// ExecContext executes the query on the wrapped handle and invalidates the cached queries on the tables it
+// writes.
+func (c *CachedDB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	result, err := c.DBPreparerExecutor.ExecContext(ctx, query, args...)
+	c.wroteQuery(query)
+	return result, err
+}
+
+// QueryContext executes the query on the wrapped handle and invalidates the cached queries on the tables
+// it writes.
+func (c *CachedDB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	rows, err := c.DBPreparerExecutor.QueryContext(ctx, query, args...)
+	c.wroteQuery(query)
+	return rows, err
+}
+
+// QueryRowContext executes the query on the wrapped handle and invalidates the cached queries on the
+// tables it writes.
+func (c *CachedDB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	row := c.DBPreparerExecutor.QueryRowContext(ctx, query, args...)
+	c.wroteQuery(query)
+	return row
+}
+
+// wroteQuery invalidates the tables written by the query, if it writes data or changes the schema.
+func (c *CachedDB) wroteQuery(query string) {
+	if classification := ClassifyStatement(query); classification.Kind == StatementWrite || classification.Kind == StatementDDL {
+		c.wrote(classification.Tables)
+	}
+}
+
+// wrapSession returns conn sharing the cache.
+func (c *CachedDB) wrapSession(conn DBPreparerExecutor) DBPreparerExecutor {
+	return &CachedDB{wrappedDB: wrappedDB{conn}, cache: c.cache}
+}
+
+var (
+	_ DB             = (*CachedDB)(nil)
+	_ DBInterceptor  = (*CachedDB)(nil)
+	_ DBTransactor   = (*CachedDB)(nil)
+	_ sessionWrapper = (*CachedDB)(nil)
+)
@@ -0,0 +1,195 @@
+package dbsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCachedDB(t *testing.T) {
+	t.Parallel()
+
+	newCachedDB := func(t *testing.T, policy CachePolicy) (*CachedDB, *fakeDriver, *time.Time) {
+		sqlDB, fake := NewFakeDB(t)
+		fake.QueryFunc = func(_ string, args []any) (driver.Rows, error) {
+			var value driver.Value = "all"
+			if len(args) > 0 {
+				value = args[0]
+			}
+			return newFakeRows([]string{"value"}, []driver.Value{value}), nil
+		}
+
+		db := WithResultCache(sqlDB, policy)
+		now := time.Now()
+		db.cache.now = func() time.Time { return now }
+		return db, fake, &now
+	}
+
+	prepare := func(t *testing.T, query string, opts ...PrepareStatementOption) PreparedStatement {
+		preparedStatement, err := PrepareStatement(query, append([]PrepareStatementOption{Cacheable()}, opts...)...)
+		require.NoError(t, err)
+		return preparedStatement
+	}
+
+	tests := []struct {
+		desc      string
+		assertion func(*testing.T, string)
+	}{
+		{
+			desc: "Reads are cached by SQL and bound values until they expire",
+			assertion: func(t *testing.T, desc string) {
+				db, fake, now := newCachedDB(t, CachePolicy{TTL: time.Minute})
+				selectCustomer := prepare(t, "SELECT * FROM customers WHERE customer_id = @customer_id")
+
+				for i := 0; i < 2; i++ {
+					rows, err := QueryRows(context.Background(), db, selectCustomer, BindParameterValue("customer_id", 1))
+					require.NoError(t, err, desc)
+					require.Equal(t, MappedRows{{"value": 1}}, rows, desc)
+					rows[0]["value"] = "changed by the caller"
+				}
+				require.Equal(t, 1, fake.QueryCount(), desc)
+
+				rows, err := QueryRows(context.Background(), db, selectCustomer, BindParameterValue("customer_id", 2))
+				require.NoError(t, err, desc)
+				require.Equal(t, MappedRows{{"value": 2}}, rows, desc)
+				require.Equal(t, 2, fake.QueryCount(), desc)
+				require.Equal(t, 2, db.Len(), desc)
+
+				*now = now.Add(time.Minute)
+				_, err = QueryRows(context.Background(), db, selectCustomer, BindParameterValue("customer_id", 1))
+				require.NoError(t, err, desc)
+				require.Equal(t, 3, fake.QueryCount(), desc)
+			},
+		},
+		{
+			desc: "Writes invalidate the queries on the tables they reference",
+			assertion: func(t *testing.T, desc string) {
+				db, fake, _ := newCachedDB(t, CachePolicy{TTL: time.Minute})
+				selectCustomers := prepare(t, "SELECT * FROM customers c JOIN addresses a USING (customer_id)")
+				selectProducts := prepare(t, "SELECT * FROM products")
+
+				for _, preparedStatement := range []PreparedStatement{selectCustomers, selectProducts} {
+					_, err := QueryRows(context.Background(), db, preparedStatement)
+					require.NoError(t, err, desc)
+				}
+				require.Equal(t, 2, db.Len(), desc)
+
+				_, err := ExecContext(context.Background(), db, prepare(t, "UPDATE public.addresses SET city = 'Berlin'"))
+				require.NoError(t, err, desc)
+				require.Equal(t, 1, db.Len(), desc)
+
+				_, err = db.ExecContext(context.Background(), "TRUNCATE products")
+				require.NoError(t, err, desc)
+				require.Equal(t, 0, db.Len(), desc)
+				require.Equal(t, 2, fake.ExecCount(), desc)
+
+				// Writes returning rows through the raw query methods invalidate as well.
+				for _, preparedStatement := range []PreparedStatement{selectCustomers, selectProducts} {
+					_, err := QueryRows(context.Background(), db, preparedStatement)
+					require.NoError(t, err, desc)
+				}
+				rows, err := db.QueryContext(context.Background(), "INSERT INTO customers DEFAULT VALUES RETURNING customer_id")
+				require.NoError(t, err, desc)
+				require.NoError(t, rows.Close(), desc)
+				require.Equal(t, 1, db.Len(), desc)
+
+				var value any
+				require.NoError(t, db.QueryRowContext(context.Background(), "DELETE FROM products RETURNING product_id").Scan(&value), desc)
+				require.Equal(t, 0, db.Len(), desc)
+			},
+		},
+		{
+			desc: "Writes inside a transaction invalidate when it ends and reads bypass the cache",
+			assertion: func(t *testing.T, desc string) {
+				db, fake, _ := newCachedDB(t, CachePolicy{TTL: time.Minute})
+				selectCustomers := prepare(t, "SELECT * FROM customers")
+
+				_, err := QueryRows(context.Background(), db, selectCustomers)
+				require.NoError(t, err, desc)
+
+				err = WithTransaction(context.Background(), db, nil, func(ctx context.Context, tx DBPreparerExecutor) error {
+					if _, err := ExecContext(ctx, tx, prepare(t, "DELETE FROM customers")); err != nil {
+						return err
+					}
+					require.Equal(t, 1, db.Len(), desc)
+
+					_, err := QueryRows(ctx, tx, selectCustomers)
+					return errors.Join(err, errors.New("rolled back"))
+				})
+				require.EqualError(t, err, "rolled back", desc)
+				require.Equal(t, 0, db.Len(), desc)
+				require.Equal(t, 2, fake.QueryCount(), desc)
+			},
+		},
+		{
+			desc: "Only statements marked Cacheable, and not Volatile, are cached",
+			assertion: func(t *testing.T, desc string) {
+				db, fake, _ := newCachedDB(t, CachePolicy{TTL: time.Minute})
+
+				selectCustomers, err := PrepareStatement("SELECT * FROM customers")
+				require.NoError(t, err, desc)
+				nextOrderNumber := prepare(t, "SELECT nextval('order_numbers')", Volatile())
+
+				for _, preparedStatement := range []PreparedStatement{selectCustomers, nextOrderNumber} {
+					for i := 0; i < 2; i++ {
+						_, err := QueryRows(context.Background(), db, preparedStatement)
+						require.NoError(t, err, desc)
+					}
+				}
+				require.Equal(t, 4, fake.QueryCount(), desc)
+				require.Equal(t, 0, db.Len(), desc)
+			},
+		},
+		{
+			desc: "CopyFrom invalidates the queries on the table it copies into",
+			assertion: func(t *testing.T, desc string) {
+				db, _, _ := newCachedDB(t, CachePolicy{TTL: time.Minute})
+
+				_, err := QueryRows(context.Background(), db, prepare(t, "SELECT * FROM customers"))
+				require.NoError(t, err, desc)
+				require.Equal(t, 1, db.Len(), desc)
+
+				_, err = CopyFrom(context.Background(), db, "public.customers", Columns{"first_name"}, MappedRows{{"first_name": "John"}})
+				require.NoError(t, err, desc)
+				require.Equal(t, 0, db.Len(), desc)
+			},
+		},
+		{
+			desc: "The least recently used queries are evicted and large results are not cached",
+			assertion: func(t *testing.T, desc string) {
+				db, fake, _ := newCachedDB(t, CachePolicy{TTL: time.Minute, MaxEntries: 2, MaxRows: 1})
+				selectCustomer := prepare(t, "SELECT * FROM customers WHERE customer_id = @customer_id")
+
+				for _, customerID := range []int{1, 2, 1, 3, 1, 2} {
+					_, err := QueryRows(context.Background(), db, selectCustomer, BindParameterValue("customer_id", customerID))
+					require.NoError(t, err, desc)
+				}
+				// 1, 2 and 3 are queried, then 2 again after it was evicted by 3.
+				require.Equal(t, 4, fake.QueryCount(), desc)
+
+				fake.QueryFunc = func(string, []any) (driver.Rows, error) {
+					return newFakeRows([]string{"value"}, []driver.Value{1}, []driver.Value{2}), nil
+				}
+				selectCustomers := prepare(t, "SELECT * FROM customers")
+				for i := 0; i < 2; i++ {
+					rows, err := QueryRows(context.Background(), db, selectCustomers)
+					require.NoError(t, err, desc)
+					require.Len(t, rows, 2, desc)
+				}
+				require.Equal(t, 6, fake.QueryCount(), desc)
+			},
+		},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			tc.assertion(t, tc.desc)
+		})
+	}
+}
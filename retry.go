@@ -0,0 +1,183 @@
+package dbsql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// SQLStateError is implemented by driver errors that carry a PostgreSQL SQLSTATE code, such as *pq.Error.
+type SQLStateError interface {
+	error
+	SQLState() string
+}
+
+// SQLState returns the SQLSTATE code of the first error in err's tree that carries one, or an empty string.
+func SQLState(err error) string {
+	var sqlStateErr SQLStateError
+	if errors.As(err, &sqlStateErr) {
+		return sqlStateErr.SQLState()
+	}
+	return ""
+}
+
+// transientSQLStates are the SQLSTATE codes, besides the connection exception class 08, that
+// IsTransientError considers worth retrying.
+var transientSQLStates = map[string]bool{
+	"57P01": true, // admin_shutdown
+	"57P02": true, // crash_shutdown
+	"57P03": true, // cannot_connect_now
+	"53300": true, // too_many_connections
+	"40001": true, // serialization_failure
+	"40P01": true, // deadlock_detected
+	"25006": true, // read_only_sql_transaction, raised by a primary that was demoted during a failover
+}
+
+// IsTransientError reports whether err is likely to succeed when retried: a broken or reset connection,
+// a server shutting down, refusing or failing over connections, too many connections, or a
+// serialization failure or deadlock.
+func IsTransientError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	if sqlState := SQLState(err); sqlState != "" {
+		return transientSQLStates[sqlState] || strings.HasPrefix(sqlState, "08")
+	}
+
+	if errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, sql.ErrConnDone) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// RetryPolicy configures RetryInterceptor.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the first one. Values below 2 disable retries.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between retries. Zero means no cap.
+	MaxBackoff time.Duration
+	// Multiplier is the factor the delay grows by after each retry. Values below 1 are treated as 1.
+	Multiplier float64
+	// Jitter is the fraction, between 0 and 1, of each delay that is randomized.
+	Jitter float64
+	// Classifier reports whether an error is worth retrying. It defaults to IsTransientError.
+	Classifier func(err error) bool
+	// Retryable reports whether a call may be executed more than once. It defaults to retrying
+	// statements marked with Idempotent and statements that only read data.
+	Retryable func(call *Call) bool
+}
+
+// DefaultRetryPolicy returns a RetryPolicy with 3 attempts, an exponential backoff starting at 50ms and
+// capped at 1s, and 20% jitter.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 50 * time.Millisecond,
+		MaxBackoff:     time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+	}
+}
+
+// Backoff returns the delay before the given retry, starting at 1.
+func (r RetryPolicy) Backoff(retry int) time.Duration {
+	multiplier := r.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	backoff := float64(r.InitialBackoff)
+	for i := 1; i < retry; i++ {
+		backoff *= multiplier
+		if r.MaxBackoff > 0 && backoff >= float64(r.MaxBackoff) {
+			break
+		}
+	}
+	if r.MaxBackoff > 0 && backoff > float64(r.MaxBackoff) {
+		backoff = float64(r.MaxBackoff)
+	}
+
+	jitter := r.Jitter
+	switch {
+	case jitter < 0:
+		jitter = 0
+	case jitter > 1:
+		jitter = 1
+	}
+
+	return time.Duration(backoff*(1-jitter) + rand.Float64()*backoff*jitter)
+}
+
+// RetryInterceptor returns an Interceptor that retries calls failing with a transient error according
+// to policy. Calls made inside a transaction are never retried, since the transaction is aborted by the
+// failure. Errors reported when QueryRow's Row is scanned happen after the call and are not retried.
+//
+// Example:
+//
+//	db := dbsql.WithInterceptors(sqlDB, dbsql.RetryInterceptor(dbsql.DefaultRetryPolicy()))
+//	upsert, err := dbsql.PrepareStatement(upsertCustomerQuery, dbsql.Idempotent())
+func RetryInterceptor(policy RetryPolicy) Interceptor {
+	classifier := policy.Classifier
+	if classifier == nil {
+		classifier = IsTransientError
+	}
+
+	retryable := policy.Retryable
+	if retryable == nil {
+		retryable = retryableCall
+	}
+
+	return func(ctx context.Context, call *Call, next CallHandler) (*CallResult, error) {
+		callResult, err := next(ctx, call)
+		if err == nil || policy.MaxAttempts < 2 || inTransaction(call.DB) || !retryable(call) {
+			return callResult, err
+		}
+
+		for attempt := 2; attempt <= policy.MaxAttempts && classifier(err); attempt++ {
+			timer := time.NewTimer(policy.Backoff(attempt - 1))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, errors.Join(err, ctx.Err())
+			case <-timer.C:
+			}
+
+			callResult, err = next(ctx, call)
+			if err == nil {
+				return callResult, nil
+			}
+		}
+
+		return callResult, err
+	}
+}
+
+// retryableCall reports whether the call's statement is marked Idempotent or only reads data.
+func retryableCall(call *Call) bool {
+	return statementIdempotent(call.PreparedStatement) || callKind(call) == StatementRead
+}
+
+// inTransaction reports whether dbPrepExec is, or wraps, a *sql.Tx.
+func inTransaction(dbPrepExec DBPreparerExecutor) bool {
+	_, ok := unwrapTo[*sql.Tx](dbPrepExec)
+	return ok
+}
@@ -0,0 +1,187 @@
+package dbsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsTransientError(t *testing.T) {
+	tests := []struct {
+		Name      string
+		Err       error
+		Transient bool
+	}{
+		{Name: "nil", Err: nil, Transient: false},
+		{Name: "admin shutdown", Err: &pq.Error{Code: "57P01"}, Transient: true},
+		{Name: "too many connections", Err: &pq.Error{Code: "53300"}, Transient: true},
+		{Name: "connection failure", Err: fmt.Errorf("wrapped: %w", &pq.Error{Code: "08006"}), Transient: true},
+		{Name: "unique violation", Err: &pq.Error{Code: "23505"}, Transient: false},
+		{Name: "truncated sqlstate", Err: &pq.Error{Code: "0"}, Transient: false},
+		{Name: "bad connection", Err: driver.ErrBadConn, Transient: true},
+		{Name: "network error", Err: &net.OpError{Op: "read", Err: errors.New("connection reset by peer")}, Transient: true},
+		{Name: "context canceled", Err: context.Canceled, Transient: false},
+		{Name: "other error", Err: errors.New("mock error"), Transient: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			require.Equal(t, test.Transient, IsTransientError(test.Err))
+		})
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := RetryPolicy{
+		InitialBackoff: 10 * time.Millisecond,
+		MaxBackoff:     35 * time.Millisecond,
+		Multiplier:     2,
+	}
+	require.Equal(t, 10*time.Millisecond, policy.Backoff(1))
+	require.Equal(t, 20*time.Millisecond, policy.Backoff(2))
+	require.Equal(t, 35*time.Millisecond, policy.Backoff(3))
+
+	policy.Jitter = 0.5
+	for i := 0; i < 10; i++ {
+		backoff := policy.Backoff(2)
+		require.GreaterOrEqual(t, backoff, 10*time.Millisecond)
+		require.LessOrEqual(t, backoff, 20*time.Millisecond)
+	}
+}
+
+func TestRetryInterceptor(t *testing.T) {
+	t.Parallel()
+
+	policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, Multiplier: 2}
+
+	failTimes := func(fd *fakeDriver, times int) {
+		failures := 0
+		fd.ExecFunc = func(string, []any) (driver.Result, error) {
+			if failures < times {
+				failures++
+				return nil, &pq.Error{Code: "57P01"}
+			}
+			return driver.RowsAffected(1), nil
+		}
+		fd.QueryFunc = func(string, []any) (driver.Rows, error) {
+			if failures < times {
+				failures++
+				return nil, &pq.Error{Code: "57P01"}
+			}
+			return newFakeRows([]string{"id"}), nil
+		}
+	}
+
+	tests := []struct {
+		desc      string
+		assertion func(*testing.T, string)
+	}{
+		{
+			desc: "Reads are retried until they succeed",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fd := NewFakeDB(t)
+				failTimes(fd, 2)
+
+				db := WithInterceptors(sqlDB, RetryInterceptor(policy))
+
+				preparedStatement, err := PrepareStatement("SELECT id FROM customers WHERE last_name = @last_name")
+				require.NoError(t, err, desc)
+
+				rows, err := QueryContext(context.Background(), db, preparedStatement, BindParameterValue("last_name", "Doe"))
+				require.NoError(t, err, desc)
+				require.NoError(t, rows.Close(), desc)
+				require.Equal(t, 3, fd.QueryCount(), desc)
+				require.Equal(t, []any{"Doe"}, fd.LastQuery().Args, desc)
+			},
+		},
+		{
+			desc: "Reads give up after the maximum attempts",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fd := NewFakeDB(t)
+				failTimes(fd, 5)
+
+				db := WithInterceptors(sqlDB, RetryInterceptor(policy))
+
+				preparedStatement, err := PrepareStatement("SELECT id FROM customers")
+				require.NoError(t, err, desc)
+
+				_, err = QueryContext(context.Background(), db, preparedStatement)
+				require.Error(t, err, desc)
+				require.Equal(t, 3, fd.QueryCount(), desc)
+			},
+		},
+		{
+			desc: "Writes are not retried unless marked idempotent",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fd := NewFakeDB(t)
+				failTimes(fd, 1)
+
+				db := WithInterceptors(sqlDB, RetryInterceptor(policy))
+
+				preparedStatement, err := PrepareStatement("DELETE FROM customers WHERE customer_id = @customer_id")
+				require.NoError(t, err, desc)
+
+				_, err = ExecContext(context.Background(), db, preparedStatement, BindParameterValue("customer_id", 1))
+				require.Error(t, err, desc)
+				require.Equal(t, 1, fd.ExecCount(), desc)
+
+				preparedStatement, err = PrepareStatement("DELETE FROM customers WHERE customer_id = @customer_id", Idempotent())
+				require.NoError(t, err, desc)
+
+				_, err = ExecContext(context.Background(), db, preparedStatement, BindParameterValue("customer_id", 1))
+				require.NoError(t, err, desc)
+				require.Equal(t, 2, fd.ExecCount(), desc)
+			},
+		},
+		{
+			desc: "Errors that are not transient are not retried",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fd := NewFakeDB(t)
+				fd.QueryFunc = func(string, []any) (driver.Rows, error) {
+					return nil, &pq.Error{Code: "42P01"}
+				}
+
+				db := WithInterceptors(sqlDB, RetryInterceptor(policy))
+
+				preparedStatement, err := PrepareStatement("SELECT id FROM missing_table")
+				require.NoError(t, err, desc)
+
+				_, err = QueryContext(context.Background(), db, preparedStatement)
+				require.Error(t, err, desc)
+				require.Equal(t, 1, fd.QueryCount(), desc)
+			},
+		},
+		{
+			desc: "Calls inside a transaction are not retried",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fd := NewFakeDB(t)
+				failTimes(fd, 1)
+
+				db := WithInterceptors(sqlDB, RetryInterceptor(policy))
+
+				preparedStatement, err := PrepareStatement("SELECT id FROM customers")
+				require.NoError(t, err, desc)
+
+				err = WithTransaction(context.Background(), db, nil, func(ctx context.Context, tx DBPreparerExecutor) error {
+					_, err := QueryContext(ctx, tx, preparedStatement)
+					return err
+				})
+				require.Error(t, err, desc)
+				require.Equal(t, 1, fd.QueryCount(), desc)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			test.assertion(t, test.desc)
+		})
+	}
+}
@@ -0,0 +1,280 @@
+package dbsql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/neumachen/dbsql/internal"
+)
+
+type forcePrimaryKey struct{}
+
+// ContextWithPrimary returns a copy of ctx that makes a Router send every statement to the primary, e.g.
+// to read a row right after writing it without waiting for the replicas to catch up.
+func ContextWithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, forcePrimaryKey{}, true)
+}
+
+// forcePrimary reports whether ctx was returned by ContextWithPrimary.
+func forcePrimary(ctx context.Context) bool {
+	force, _ := ctx.Value(forcePrimaryKey{}).(bool)
+	return force
+}
+
+// RouterOption configures a Router.
+type RouterOption func(router *Router)
+
+// RouterLeastLatency sends reads to the healthy replica with the lowest ping latency instead of
+// round-robin. The replicas are pinged every probeInterval until the Router is closed; replicas whose
+// ping fails or takes longer than probeInterval are skipped until they answer again, and replicas that
+// implement neither DBContextPinger nor DBPinger rank last.
+func RouterLeastLatency(probeInterval time.Duration) RouterOption {
+	return func(router *Router) {
+		router.probeInterval = probeInterval
+	}
+}
+
+// routerReplica is a replica and the result of its last probe.
+type routerReplica struct {
+	db      DBPreparerExecutor
+	latency atomic.Int64
+	down    atomic.Bool
+}
+
+// Router is a DB that sends statements that only read data, as detected from their SQL, to replicas
+// and everything else to the primary. Transactions always run on the primary, and so do the statements
+// made with a context returned by ContextWithPrimary. Without replicas, everything goes to the primary.
+//
+// Example:
+//
+//	router, err := dbsql.NewRouter(primaryDB, []dbsql.DBPreparerExecutor{replicaDB1, replicaDB2})
+//	mappedRows, err := dbsql.QueryContext(ctx, router, selectCustomers) // runs on a replica
+//	_, err = dbsql.ExecContext(ctx, router, updateCustomer)             // runs on the primary
+type Router struct {
+	primary       DBPreparerExecutor
+	replicas      []*routerReplica
+	next          atomic.Uint64
+	probeInterval time.Duration
+	// probeCtx is canceled by Close, which interrupts the probes in flight.
+	probeCtx    context.Context
+	cancelProbe context.CancelFunc
+	probes      sync.WaitGroup
+}
+
+// NewRouter returns a Router over the primary and its replicas. Reads are spread round-robin across the
+// replicas unless RouterLeastLatency is given.
+func NewRouter(primary DBPreparerExecutor, replicas []DBPreparerExecutor, opts ...RouterOption) (*Router, error) {
+	if internal.IsNil(primary) {
+		return nil, errors.New("primary is nil")
+	}
+
+	router := &Router{
+		primary:  primary,
+		replicas: make([]*routerReplica, 0, len(replicas)),
+	}
+	router.probeCtx, router.cancelProbe = context.WithCancel(context.Background())
+	for i := range replicas {
+		if internal.IsNil(replicas[i]) {
+			return nil, errors.New("replica is nil")
+		}
+		router.replicas = append(router.replicas, &routerReplica{db: replicas[i]})
+	}
+	for i := range opts {
+		opts[i](router)
+	}
+
+	if router.probeInterval > 0 && len(router.replicas) > 0 {
+		router.probes.Add(1)
+		go router.probeReplicas()
+	}
+
+	return router, nil
+}
+
+// Primary returns the primary.
+func (r *Router) Primary() DBPreparerExecutor {
+	return r.primary
+}
+
+// route returns the handle the query should run on.
+func (r *Router) route(ctx context.Context, query string) DBPreparerExecutor {
+	if len(r.replicas) < 1 || forcePrimary(ctx) || !isReadStatement(query) {
+		return r.primary
+	}
+	return r.replica()
+}
+
+// replica returns the replica the next read should run on.
+func (r *Router) replica() DBPreparerExecutor {
+	if r.probeInterval > 0 {
+		return r.leastLatencyReplica()
+	}
+
+	return r.replicas[(r.next.Add(1)-1)%uint64(len(r.replicas))].db
+}
+
+// leastLatencyReplica returns the healthy replica with the lowest latency, or the primary if every
+// replica is down.
+func (r *Router) leastLatencyReplica() DBPreparerExecutor {
+	var best DBPreparerExecutor
+	bestLatency := int64(math.MaxInt64)
+	for _, replica := range r.replicas {
+		if replica.down.Load() {
+			continue
+		}
+		if latency := replica.latency.Load(); best == nil || latency < bestLatency {
+			best, bestLatency = replica.db, latency
+		}
+	}
+
+	if best == nil {
+		return r.primary
+	}
+	return best
+}
+
+// probeReplicas pings the replicas every probe interval until the router is closed.
+func (r *Router) probeReplicas() {
+	defer r.probes.Done()
+
+	ticker := time.NewTicker(r.probeInterval)
+	defer ticker.Stop()
+
+	for {
+		r.ProbeReplicas()
+
+		select {
+		case <-r.probeCtx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// defaultProbeTimeout bounds the probes of a Router without a probe interval.
+const defaultProbeTimeout = 5 * time.Second
+
+// ProbeReplicas pings every replica and records its latency and health for RouterLeastLatency. It is
+// called periodically by the Router and only needs to be called directly to refresh the probes early.
+//
+// The replicas are pinged concurrently, each for at most the probe interval; a replica that does not
+// answer in time, or by the time the Router is closed, is marked down.
+func (r *Router) ProbeReplicas() {
+	timeout := r.probeInterval
+	if timeout < 1 {
+		timeout = defaultProbeTimeout
+	}
+
+	var wg sync.WaitGroup
+	for _, replica := range r.replicas {
+		wg.Add(1)
+		go func(replica *routerReplica) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(r.probeCtx, timeout)
+			defer cancel()
+
+			start := time.Now()
+			ok, err := pingContext(ctx, replica.db)
+			if !ok {
+				replica.latency.Store(math.MaxInt64)
+				return
+			}
+			replica.latency.Store(int64(time.Since(start)))
+			replica.down.Store(err != nil)
+		}(replica)
+	}
+	wg.Wait()
+}
+
+// InterceptCall routes the call by the classification of its statement and runs the interceptor chain
+// of the chosen handle, if any.
+func (r *Router) InterceptCall(ctx context.Context, call *Call, next CallHandler) (*CallResult, error) {
+	call.DB = r.primary
+	if len(r.replicas) > 0 && !forcePrimary(ctx) && callKind(call) == StatementRead {
+		call.DB = r.replica()
+	}
+	return interceptCall(ctx, call.DB, call, next)
+}
+
+// Prepare prepares the query on the handle it is routed to.
+func (r *Router) Prepare(query string) (*sql.Stmt, error) {
+	return r.PrepareContext(context.Background(), query)
+}
+
+// Exec executes the query on the handle it is routed to.
+func (r *Router) Exec(query string, args ...any) (sql.Result, error) {
+	return r.ExecContext(context.Background(), query, args...)
+}
+
+// Query executes the query on the handle it is routed to.
+func (r *Router) Query(query string, args ...any) (*sql.Rows, error) {
+	return r.QueryContext(context.Background(), query, args...)
+}
+
+// QueryRow executes the query on the handle it is routed to.
+func (r *Router) QueryRow(query string, args ...any) *sql.Row {
+	return r.QueryRowContext(context.Background(), query, args...)
+}
+
+// PrepareContext prepares the query on the handle it is routed to.
+func (r *Router) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return r.route(ctx, query).PrepareContext(ctx, query)
+}
+
+// ExecContext executes the query on the handle it is routed to.
+func (r *Router) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return r.route(ctx, query).ExecContext(ctx, query, args...)
+}
+
+// QueryContext executes the query on the handle it is routed to.
+func (r *Router) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return r.route(ctx, query).QueryContext(ctx, query, args...)
+}
+
+// QueryRowContext executes the query on the handle it is routed to.
+func (r *Router) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return r.route(ctx, query).QueryRowContext(ctx, query, args...)
+}
+
+// RunInTx runs txFunc inside a transaction on the primary.
+func (r *Router) RunInTx(ctx context.Context, opts *sql.TxOptions, txFunc TxFunc) error {
+	return WithTransaction(ctx, r.primary, opts, txFunc)
+}
+
+// Close stops probing the replicas and closes the primary and the replicas that implement DBCloser.
+func (r *Router) Close() error {
+	r.cancelProbe()
+	r.probes.Wait()
+
+	var errs []error
+	if closer, ok := r.primary.(DBCloser); ok {
+		errs = append(errs, closer.Close())
+	}
+	for _, replica := range r.replicas {
+		if closer, ok := replica.db.(DBCloser); ok {
+			errs = append(errs, closer.Close())
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Ping pings the primary if it implements DBPinger.
+func (r *Router) Ping() error {
+	if pinger, ok := r.primary.(DBPinger); ok {
+		return pinger.Ping()
+	}
+	return nil
+}
+
+var (
+	_ DB            = (*Router)(nil)
+	_ DBInterceptor = (*Router)(nil)
+	_ DBTransactor  = (*Router)(nil)
+)
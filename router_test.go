@@ -0,0 +1,229 @@
+package dbsql
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// pingStubDB is a handle whose Ping takes delay and returns err.
+type pingStubDB struct {
+	DBPreparerExecutor
+	delay time.Duration
+
+	mu  sync.Mutex
+	err error
+}
+
+func (p *pingStubDB) Ping() error {
+	time.Sleep(p.delay)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+func (p *pingStubDB) setErr(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.err = err
+}
+
+// hungPingDB is a handle whose PingContext blocks until its context is done.
+type hungPingDB struct {
+	DBPreparerExecutor
+}
+
+func (h *hungPingDB) PingContext(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestRouter(t *testing.T) {
+	t.Parallel()
+
+	selectCustomers, err := PrepareStatement("SELECT * FROM customers")
+	require.NoError(t, err)
+
+	tests := []struct {
+		desc      string
+		assertion func(*testing.T, string)
+	}{
+		{
+			desc: "Reads are spread round-robin across the replicas and writes go to the primary",
+			assertion: func(t *testing.T, desc string) {
+				primaryDB, primary := NewFakeDB(t)
+				replicaDB1, replica1 := NewFakeDB(t)
+				replicaDB2, replica2 := NewFakeDB(t)
+
+				router, err := NewRouter(primaryDB, []DBPreparerExecutor{replicaDB1, replicaDB2})
+				require.NoError(t, err, desc)
+
+				for i := 0; i < 4; i++ {
+					rows, err := QueryContext(context.Background(), router, selectCustomers)
+					require.NoError(t, err, desc)
+					require.NoError(t, rows.Close(), desc)
+				}
+
+				updateCustomer, err := PrepareStatement("UPDATE customers SET first_name = @first_name")
+				require.NoError(t, err, desc)
+				_, err = ExecContext(context.Background(), router, updateCustomer, BindParameterValue("first_name", "John"))
+				require.NoError(t, err, desc)
+
+				lockCustomers, err := PrepareStatement("SELECT * FROM customers FOR UPDATE")
+				require.NoError(t, err, desc)
+				rows, err := QueryContext(context.Background(), router, lockCustomers)
+				require.NoError(t, err, desc)
+				require.NoError(t, rows.Close(), desc)
+
+				require.Equal(t, 2, replica1.QueryCount(), desc)
+				require.Equal(t, 2, replica2.QueryCount(), desc)
+				require.Equal(t, 1, primary.ExecCount(), desc)
+				require.Equal(t, 1, primary.QueryCount(), desc)
+			},
+		},
+		{
+			desc: "Transactions and forced contexts run on the primary",
+			assertion: func(t *testing.T, desc string) {
+				primaryDB, primary := NewFakeDB(t)
+				replicaDB, replica := NewFakeDB(t)
+
+				router, err := NewRouter(primaryDB, []DBPreparerExecutor{replicaDB})
+				require.NoError(t, err, desc)
+
+				err = WithTransaction(context.Background(), router, nil, func(ctx context.Context, tx DBPreparerExecutor) error {
+					rows, err := QueryContext(ctx, tx, selectCustomers)
+					if err != nil {
+						return err
+					}
+					return rows.Close()
+				})
+				require.NoError(t, err, desc)
+
+				rows, err := QueryContext(ContextWithPrimary(context.Background()), router, selectCustomers)
+				require.NoError(t, err, desc)
+				require.NoError(t, rows.Close(), desc)
+
+				require.Equal(t, 1, primary.Begins, desc)
+				require.Equal(t, 2, primary.QueryCount(), desc)
+				require.Equal(t, 0, replica.QueryCount(), desc)
+			},
+		},
+		{
+			desc: "Interceptors of the chosen replica apply",
+			assertion: func(t *testing.T, desc string) {
+				primaryDB, _ := NewFakeDB(t)
+				replicaDB, _ := NewFakeDB(t)
+
+				intercepted := 0
+				replica := WithInterceptors(replicaDB, func(ctx context.Context, call *Call, next CallHandler) (*CallResult, error) {
+					intercepted++
+					return next(ctx, call)
+				})
+
+				router, err := NewRouter(primaryDB, []DBPreparerExecutor{replica})
+				require.NoError(t, err, desc)
+
+				rows, err := QueryContext(context.Background(), router, selectCustomers)
+				require.NoError(t, err, desc)
+				require.NoError(t, rows.Close(), desc)
+				require.Equal(t, 1, intercepted, desc)
+			},
+		},
+		{
+			desc: "Least latency picks the fastest healthy replica",
+			assertion: func(t *testing.T, desc string) {
+				primaryDB, _ := NewFakeDB(t)
+				slowDB, _ := NewFakeDB(t)
+				fastDB, _ := NewFakeDB(t)
+				downDB, _ := NewFakeDB(t)
+
+				slow := &pingStubDB{DBPreparerExecutor: slowDB, delay: 20 * time.Millisecond}
+				fast := &pingStubDB{DBPreparerExecutor: fastDB}
+				down := &pingStubDB{DBPreparerExecutor: downDB, err: errors.New("connection refused")}
+
+				router, err := NewRouter(primaryDB, []DBPreparerExecutor{down, slow, fast})
+				require.NoError(t, err, desc)
+				// Enable least latency without the background probes, so the test controls when they run.
+				RouterLeastLatency(time.Hour)(router)
+
+				router.ProbeReplicas()
+				require.Same(t, fast, router.route(context.Background(), "SELECT 1"), desc)
+
+				fast.setErr(errors.New("connection refused"))
+				router.ProbeReplicas()
+				require.Same(t, slow, router.route(context.Background(), "SELECT 1"), desc)
+
+				slow.setErr(errors.New("connection refused"))
+				router.ProbeReplicas()
+				require.Equal(t, primaryDB, router.route(context.Background(), "SELECT 1"), desc)
+			},
+		},
+		{
+			desc: "The replicas are probed in the background until the router is closed",
+			assertion: func(t *testing.T, desc string) {
+				primaryDB, _ := NewFakeDB(t)
+				replicaDB, _ := NewFakeDB(t)
+				replica := &pingStubDB{DBPreparerExecutor: replicaDB, err: errors.New("connection refused")}
+
+				router, err := NewRouter(primaryDB, []DBPreparerExecutor{replica}, RouterLeastLatency(10*time.Millisecond))
+				require.NoError(t, err, desc)
+
+				require.Eventually(t, func() bool {
+					return router.route(context.Background(), "SELECT 1") == DBPreparerExecutor(primaryDB)
+				}, time.Second, time.Millisecond, desc)
+
+				replica.setErr(nil)
+				require.Eventually(t, func() bool {
+					return router.route(context.Background(), "SELECT 1") == DBPreparerExecutor(replica)
+				}, time.Second, time.Millisecond, desc)
+
+				require.NoError(t, router.Close(), desc)
+			},
+		},
+		{
+			desc: "A hung replica is marked down after the probe timeout and does not block Close",
+			assertion: func(t *testing.T, desc string) {
+				primaryDB, _ := NewFakeDB(t)
+				replicaDB, _ := NewFakeDB(t)
+				replica := &hungPingDB{DBPreparerExecutor: replicaDB}
+
+				router, err := NewRouter(primaryDB, []DBPreparerExecutor{replica}, RouterLeastLatency(10*time.Millisecond))
+				require.NoError(t, err, desc)
+
+				require.Eventually(t, func() bool {
+					return router.route(context.Background(), "SELECT 1") == DBPreparerExecutor(primaryDB)
+				}, time.Second, time.Millisecond, desc)
+
+				closed := make(chan error, 1)
+				go func() {
+					closed <- router.Close()
+				}()
+				select {
+				case err := <-closed:
+					require.NoError(t, err, desc)
+				case <-time.After(time.Second):
+					t.Fatal(desc)
+				}
+			},
+		},
+		{
+			desc: "NewRouter fails if the primary is nil",
+			assertion: func(t *testing.T, desc string) {
+				_, err := NewRouter(nil, nil)
+				require.EqualError(t, err, "primary is nil", desc)
+			},
+		},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			tc.assertion(t, tc.desc)
+		})
+	}
+}
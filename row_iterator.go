@@ -0,0 +1,166 @@
+package dbsql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// RowIterator iterates over query results one row at a time without loading them all into memory.
+// The MappedRow returned by Row and its scan buffers are reused for every row; use MappedRow.Clone to
+// keep a row after the next call to Next.
+//
+// Example:
+//
+//	iterator, err := dbsql.QueryIterator(ctx, db, exportInvoices)
+//	if err != nil {
+//		return err
+//	}
+//	defer iterator.Close()
+//
+//	for iterator.Next() {
+//		if err := encoder.Encode(iterator.Row()); err != nil {
+//			return err
+//		}
+//	}
+//	return iterator.Err()
+type RowIterator struct {
+	rows      *sql.Rows
+	columns   Columns
+	values    []any
+	valuePtrs []any
+	row       MappedRow
+	err       error
+	closed    bool
+}
+
+// IterateRows returns a RowIterator over rows. Closing the iterator closes rows.
+func IterateRows(rows *sql.Rows) (*RowIterator, error) {
+	if rows == nil {
+		return nil, errors.New("rows is nil")
+	}
+
+	columnNames, err := rows.Columns()
+	if err != nil {
+		rows.Close()
+		return nil, ClassifyError(err)
+	}
+
+	iterator := &RowIterator{
+		rows:      rows,
+		columns:   make(Columns, len(columnNames)),
+		values:    make([]any, len(columnNames)),
+		valuePtrs: make([]any, len(columnNames)),
+		row:       make(MappedRow, len(columnNames)),
+	}
+	for i := range columnNames {
+		iterator.columns[i] = Column(columnNames[i])
+		iterator.valuePtrs[i] = &iterator.values[i]
+	}
+
+	return iterator, nil
+}
+
+// QueryIterator executes the prepared statement as a query and returns a RowIterator over its rows.
+func QueryIterator(
+	ctx context.Context,
+	dbPrepExec DBPreparerExecutor,
+	preparedStatement PreparedStatement,
+	binderFuncs ...BindParameterValueFunc,
+) (
+	*RowIterator,
+	error,
+) {
+	rows, err := QueryContext(ctx, dbPrepExec, preparedStatement, binderFuncs...)
+	if err != nil {
+		return nil, err
+	}
+
+	return IterateRows(rows)
+}
+
+// Next advances the iterator to the next row. It returns false when there are no more rows or an error
+// occurred, in which case the rows are closed and Err reports the error.
+func (r *RowIterator) Next() bool {
+	if r.closed || r.err != nil {
+		return false
+	}
+
+	if !r.rows.Next() {
+		r.err = ClassifyError(r.rows.Err())
+		r.Close()
+		return false
+	}
+
+	if err := r.rows.Scan(r.valuePtrs...); err != nil {
+		r.err = ClassifyError(err)
+		r.Close()
+		return false
+	}
+
+	// Scanning into *any copies []byte values, so they can be stored without copying them again.
+	for i, column := range r.columns {
+		r.row[column] = r.values[i]
+	}
+
+	return true
+}
+
+// Row returns the current row. It is only valid until the next call to Next.
+func (r *RowIterator) Row() MappedRow {
+	return r.row
+}
+
+// Columns returns the columns of the rows.
+func (r *RowIterator) Columns() Columns {
+	return r.columns
+}
+
+// Err returns the error, if any, that stopped the iteration.
+func (r *RowIterator) Err() error {
+	return r.err
+}
+
+// Close closes the rows. It is safe to call Close more than once.
+func (r *RowIterator) Close() error {
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	return r.rows.Close()
+}
+
+// QueryEach executes the prepared statement as a query and calls rowFunc for every row, without loading
+// the rows into memory. The MappedRow passed to rowFunc is reused for every row; use MappedRow.Clone to
+// keep it. The iteration stops at the first error returned by rowFunc, which is returned as is.
+//
+// Example:
+//
+//	err := dbsql.QueryEach(ctx, db, exportInvoices, func(mappedRow dbsql.MappedRow) error {
+//		return encoder.Encode(mappedRow)
+//	})
+func QueryEach(
+	ctx context.Context,
+	dbPrepExec DBPreparerExecutor,
+	preparedStatement PreparedStatement,
+	rowFunc func(mappedRow MappedRow) error,
+	binderFuncs ...BindParameterValueFunc,
+) error {
+	if rowFunc == nil {
+		return errors.New("row func is nil")
+	}
+
+	iterator, err := QueryIterator(ctx, dbPrepExec, preparedStatement, binderFuncs...)
+	if err != nil {
+		return err
+	}
+	defer iterator.Close()
+
+	for iterator.Next() {
+		if err := rowFunc(iterator.Row()); err != nil {
+			return err
+		}
+	}
+
+	return iterator.Err()
+}
@@ -0,0 +1,167 @@
+package dbsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryEach(t *testing.T) {
+	t.Parallel()
+
+	const query = "SELECT customer_id, first_name FROM customers"
+
+	customerRows := func() *fakeRows {
+		return newFakeRows(
+			[]string{"customer_id", "first_name"},
+			[]driver.Value{int64(1), "John"},
+			[]driver.Value{int64(2), "Jane"},
+			[]driver.Value{int64(3), "Jim"},
+		)
+	}
+
+	tests := []struct {
+		desc      string
+		assertion func(*testing.T, string)
+	}{
+		{
+			desc: "Every row is passed to the func",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fd := NewFakeDB(t)
+				rows := customerRows()
+				fd.QueryFunc = func(string, []any) (driver.Rows, error) {
+					return rows, nil
+				}
+
+				preparedStatement, err := PrepareStatement(query)
+				require.NoError(t, err, desc)
+
+				var mappedRows MappedRows
+				err = QueryEach(context.Background(), sqlDB, preparedStatement, func(mappedRow MappedRow) error {
+					mappedRows = append(mappedRows, mappedRow.Clone())
+					return nil
+				})
+				require.NoError(t, err, desc)
+				require.Equal(
+					t,
+					MappedRows{
+						{"customer_id": int64(1), "first_name": "John"},
+						{"customer_id": int64(2), "first_name": "Jane"},
+						{"customer_id": int64(3), "first_name": "Jim"},
+					},
+					mappedRows,
+					desc,
+				)
+				require.True(t, rows.closed, desc)
+			},
+		},
+		{
+			desc: "The iteration stops at the first error returned by the func",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fd := NewFakeDB(t)
+				rows := customerRows()
+				fd.QueryFunc = func(string, []any) (driver.Rows, error) {
+					return rows, nil
+				}
+
+				preparedStatement, err := PrepareStatement(query)
+				require.NoError(t, err, desc)
+
+				expectedErr := errors.New("mock error")
+				calls := 0
+				err = QueryEach(context.Background(), sqlDB, preparedStatement, func(MappedRow) error {
+					calls++
+					return expectedErr
+				})
+				require.Equal(t, expectedErr, err, desc)
+				require.Equal(t, 1, calls, desc)
+				require.True(t, rows.closed, desc)
+			},
+		},
+		{
+			desc: "An error reported while iterating is returned",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fd := NewFakeDB(t)
+				rows := customerRows()
+				rows.err = errors.New("connection reset")
+				fd.QueryFunc = func(string, []any) (driver.Rows, error) {
+					return rows, nil
+				}
+
+				preparedStatement, err := PrepareStatement(query)
+				require.NoError(t, err, desc)
+
+				calls := 0
+				err = QueryEach(context.Background(), sqlDB, preparedStatement, func(MappedRow) error {
+					calls++
+					return nil
+				})
+				require.EqualError(t, err, "connection reset", desc)
+				require.Equal(t, 3, calls, desc)
+			},
+		},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			tc.assertion(t, tc.desc)
+		})
+	}
+}
+
+func TestRowIterator(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		desc      string
+		assertion func(*testing.T, string)
+	}{
+		{
+			desc: "The row is reused between calls to Next",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fd := NewFakeDB(t)
+				fd.QueryFunc = func(string, []any) (driver.Rows, error) {
+					return newFakeRows([]string{"customer_id"}, []driver.Value{int64(1)}, []driver.Value{int64(2)}), nil
+				}
+
+				preparedStatement, err := PrepareStatement("SELECT customer_id FROM customers")
+				require.NoError(t, err, desc)
+
+				iterator, err := QueryIterator(context.Background(), sqlDB, preparedStatement)
+				require.NoError(t, err, desc)
+				defer iterator.Close()
+
+				require.Equal(t, Columns{"customer_id"}, iterator.Columns(), desc)
+				require.True(t, iterator.Next(), desc)
+				first := iterator.Row()
+				clone := first.Clone()
+				require.True(t, iterator.Next(), desc)
+				require.Equal(t, int64(2), first["customer_id"], desc)
+				require.Equal(t, int64(1), clone["customer_id"], desc)
+				require.False(t, iterator.Next(), desc)
+				require.NoError(t, iterator.Err(), desc)
+				require.NoError(t, iterator.Close(), desc)
+			},
+		},
+		{
+			desc: "IterateRows fails if the rows are nil",
+			assertion: func(t *testing.T, desc string) {
+				_, err := IterateRows(nil)
+				require.EqualError(t, err, "rows is nil", desc)
+			},
+		},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			tc.assertion(t, tc.desc)
+		})
+	}
+}
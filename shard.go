@@ -0,0 +1,451 @@
+package dbsql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"sync"
+
+	"github.com/neumachen/dbsql/internal"
+)
+
+// ErrNoShardKey is returned by ShardedDB for a statement that has no shard key bound and so cannot be
+// routed to a single shard. Use ShardedDB.QueryRows to query every shard, or ShardBroadcast to run a
+// write on every shard.
+var ErrNoShardKey = errors.New("no shard key bound")
+
+// ShardFunc returns the index, between 0 and shards-1, of the shard holding the given shard key value.
+type ShardFunc func(key any, shards int) (int, error)
+
+// HashShard is the default ShardFunc. It spreads the keys across the shards by the FNV-1a hash of their
+// decimal or string form, so the integer 42 and the string "42" map to the same shard. Keys must be
+// integers, strings, byte slices or implement fmt.Stringer.
+func HashShard(key any, shards int) (int, error) {
+	text, err := keyString(key)
+	if err != nil {
+		return 0, err
+	}
+
+	hash := fnv.New32a()
+	hash.Write([]byte(text))
+
+	return int(hash.Sum32() % uint32(shards)), nil
+}
+
+// RangeShard returns a ShardFunc that maps integer keys to shards by range: shard i holds the keys below
+// upperBounds[i] and at least upperBounds[i-1], and the last shard holds the keys from the last bound up.
+// There must be one bound fewer than there are shards, in ascending order. Strings holding an integer are
+// accepted as keys.
+//
+// Example:
+//
+//	// customer_id < 1000000 on shard 0, < 2000000 on shard 1, the rest on shard 2
+//	dbsql.RangeShard(1000000, 2000000)
+func RangeShard(upperBounds ...int64) ShardFunc {
+	bounds := append([]int64(nil), upperBounds...)
+
+	return func(key any, shards int) (int, error) {
+		if len(bounds) != shards-1 {
+			return 0, fmt.Errorf("%d range bounds given for %d shards", len(bounds), shards)
+		}
+
+		value, err := shardKeyInt(key)
+		if err != nil {
+			return 0, err
+		}
+
+		for i := range bounds {
+			if value < bounds[i] {
+				return i, nil
+			}
+		}
+		return len(bounds), nil
+	}
+}
+
+// keyString returns the canonical text of a key value, so keys of different integer types, strings and
+// byte slices holding the same value compare equal.
+func keyString(key any) (string, error) {
+	switch key := key.(type) {
+	case string:
+		return key, nil
+	case []byte:
+		return string(key), nil
+	case int, int8, int16, int32, int64:
+		value, _ := shardKeyInt(key)
+		return strconv.FormatInt(value, 10), nil
+	case uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprint(key), nil
+	case fmt.Stringer:
+		return key.String(), nil
+	default:
+		return "", fmt.Errorf("unsupported shard key type %T", key)
+	}
+}
+
+// shardKeyInt returns the key as an int64 for RangeShard.
+func shardKeyInt(key any) (int64, error) {
+	switch key := key.(type) {
+	case int:
+		return int64(key), nil
+	case int8:
+		return int64(key), nil
+	case int16:
+		return int64(key), nil
+	case int32:
+		return int64(key), nil
+	case int64:
+		return key, nil
+	case uint8:
+		return int64(key), nil
+	case uint16:
+		return int64(key), nil
+	case uint32:
+		return int64(key), nil
+	case string:
+		value, err := strconv.ParseInt(key, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("shard key %q is not an integer", key)
+		}
+		return value, nil
+	default:
+		return 0, fmt.Errorf("unsupported shard key type %T", key)
+	}
+}
+
+// ShardedDBOption configures a ShardedDB.
+type ShardedDBOption func(sharded *ShardedDB)
+
+// ShardBy picks the shards with shardFunc instead of HashShard.
+func ShardBy(shardFunc ShardFunc) ShardedDBOption {
+	return func(sharded *ShardedDB) {
+		sharded.shardFunc = shardFunc
+	}
+}
+
+// ShardedDB is a DB whose data is split across several databases. A statement prepared with ShardKey
+// runs on the shard picked by the value bound to its shard key parameter, and fails with ErrNoShardKey if
+// no value, or a nil one, is bound to it. Statements prepared without a shard key are refused with
+// ErrNoShardKey unless they can safely run on every shard: reads are scattered to every shard with
+// QueryRows, which gathers their rows, and statements marked with ShardBroadcast are run by Exec on every
+// shard in turn, summing the rows affected. The package-level Query and QueryRow functions and the raw
+// query string methods, which cannot pick a shard, fail with ErrNoShardKey. Transactions cannot span
+// shards: use Shard to get the handle of a shard and start the transaction on it.
+//
+// Example:
+//
+//	sharded, err := dbsql.NewShardedDB([]dbsql.DBPreparerExecutor{shardDB0, shardDB1, shardDB2})
+//	selectOrders, err := dbsql.PrepareStatement(selectOrdersQuery, dbsql.ShardKey("customer_id"))
+//	mappedRows, err := sharded.QueryRows(ctx, selectOrders, dbsql.BindParameterValue("customer_id", 42)) // one shard
+//	mappedRows, err = sharded.QueryRows(ctx, selectAllOrders)                                             // every shard
+type ShardedDB struct {
+	shards    []DBPreparerExecutor
+	shardFunc ShardFunc
+}
+
+// NewShardedDB returns a ShardedDB over the shards. The order of the shards must not change between
+// deployments, since it decides which shard holds which keys.
+func NewShardedDB(shards []DBPreparerExecutor, opts ...ShardedDBOption) (*ShardedDB, error) {
+	if len(shards) < 1 {
+		return nil, errors.New("shards are empty")
+	}
+
+	for i := range shards {
+		if internal.IsNil(shards[i]) {
+			return nil, errors.New("shard is nil")
+		}
+	}
+
+	sharded := &ShardedDB{
+		shards:    append([]DBPreparerExecutor(nil), shards...),
+		shardFunc: HashShard,
+	}
+	for i := range opts {
+		opts[i](sharded)
+	}
+
+	if sharded.shardFunc == nil {
+		return nil, errors.New("shard func is nil")
+	}
+
+	return sharded, nil
+}
+
+// Shards returns the shards.
+func (s *ShardedDB) Shards() []DBPreparerExecutor {
+	return append([]DBPreparerExecutor(nil), s.shards...)
+}
+
+// Shard returns the shard holding the given shard key value.
+func (s *ShardedDB) Shard(key any) (DBPreparerExecutor, error) {
+	index, err := s.shardIndex(key)
+	if err != nil {
+		return nil, err
+	}
+	return s.shards[index], nil
+}
+
+// shardIndex returns the index of the shard holding the given shard key value.
+func (s *ShardedDB) shardIndex(key any) (int, error) {
+	index, err := s.shardFunc(key, len(s.shards))
+	if err != nil {
+		return 0, err
+	}
+
+	if index < 0 || index >= len(s.shards) {
+		return 0, fmt.Errorf("shard %d is out of range", index)
+	}
+
+	return index, nil
+}
+
+// statementShard returns the index of the shard the statement is routed to by the value bound to its
+// shard key, or false if it names no shard key. A statement naming a shard key without a value bound to
+// it fails with ErrNoShardKey instead of being scattered.
+func (s *ShardedDB) statementShard(preparedStatement PreparedStatement) (int, bool, error) {
+	shardKey := statementShardKey(preparedStatement)
+	if shardKey == "" {
+		return 0, false, nil
+	}
+
+	key := BoundNamedParameterValues(preparedStatement)[shardKey]
+	if internal.IsNil(key) {
+		return 0, false, ErrNoShardKey
+	}
+
+	index, err := s.shardIndex(key)
+	if err != nil {
+		return 0, false, err
+	}
+
+	return index, true, nil
+}
+
+// InterceptCall runs the call on the shard picked by its shard key and the interceptor chain of that
+// shard, if any. Without a shard key, QueryRows calls of reads, or of statements marked with
+// ShardBroadcast, are scattered to every shard and Exec calls of statements marked with ShardBroadcast
+// run on every shard; other calls fail with ErrNoShardKey.
+func (s *ShardedDB) InterceptCall(ctx context.Context, call *Call, next CallHandler) (*CallResult, error) {
+	index, ok, err := s.statementShard(call.PreparedStatement)
+	if err != nil {
+		return nil, err
+	}
+
+	if ok {
+		call.DB = s.shards[index]
+		return interceptCall(ctx, call.DB, call, next)
+	}
+
+	broadcast := statementBroadcast(call.PreparedStatement)
+	switch {
+	case call.Operation == OperationQueryRows && (broadcast || callKind(call) == StatementRead):
+		return s.gatherRows(ctx, call, next)
+	case call.Operation == OperationExec && broadcast:
+		return s.broadcastExec(ctx, call, next)
+	default:
+		return nil, ErrNoShardKey
+	}
+}
+
+// broadcastExec runs the Exec call on every shard in turn and sums the rows affected.
+func (s *ShardedDB) broadcastExec(ctx context.Context, call *Call, next CallHandler) (*CallResult, error) {
+	results := make(scatterResult, 0, len(s.shards))
+	for i, shard := range s.shards {
+		shardCall := *call
+		shardCall.DB = shard
+
+		callResult, err := interceptCall(ctx, shard, &shardCall, next)
+		if err != nil {
+			return nil, fmt.Errorf("shard %d: %w", i, err)
+		}
+		if callResult != nil && callResult.Result != nil {
+			results = append(results, callResult.Result)
+		}
+	}
+
+	return &CallResult{Result: results}, nil
+}
+
+// gatherRows runs the QueryRows call concurrently on every shard and concatenates their rows in shard
+// order. The first shard to fail cancels the others, and its error is returned.
+func (s *ShardedDB) gatherRows(ctx context.Context, call *Call, next CallHandler) (*CallResult, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	shardRows := make([]MappedRows, len(s.shards))
+	for i := range s.shards {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			shardCall := *call
+			shardCall.DB = s.shards[i]
+
+			callResult, err := interceptCall(ctx, shardCall.DB, &shardCall, next)
+			if err != nil {
+				errOnce.Do(func() {
+					firstErr = fmt.Errorf("shard %d: %w", i, err)
+					cancel()
+				})
+				return
+			}
+			if callResult != nil {
+				shardRows[i] = callResult.MappedRows
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	gathered := MappedRows{}
+	for i := range shardRows {
+		gathered = append(gathered, shardRows[i]...)
+	}
+
+	return &CallResult{MappedRows: gathered}, nil
+}
+
+// QueryRows runs the query on the shard picked by its shard key, or concurrently on every shard if the
+// statement has no shard key and only reads data or is marked with ShardBroadcast, and returns the
+// mapped rows. Rows gathered from several shards are concatenated in shard order; sort them in the
+// application if the order matters. The first shard to fail cancels the others, and its error is
+// returned. It is a shorthand for the package-level QueryRows.
+func (s *ShardedDB) QueryRows(
+	ctx context.Context,
+	preparedStatement PreparedStatement,
+	binderFuncs ...BindParameterValueFunc,
+) (
+	MappedRows,
+	error,
+) {
+	return QueryRows(ctx, s, preparedStatement, binderFuncs...)
+}
+
+// scatterResult is the sql.Result of an Exec run on every shard.
+type scatterResult []sql.Result
+
+// LastInsertId is not supported across shards and always returns an error.
+func (s scatterResult) LastInsertId() (int64, error) {
+	return 0, errors.New("LastInsertId is not supported across shards")
+}
+
+// RowsAffected returns the sum of the rows affected on every shard.
+func (s scatterResult) RowsAffected() (int64, error) {
+	var total int64
+	for i := range s {
+		rowsAffected, err := s[i].RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		total += rowsAffected
+	}
+	return total, nil
+}
+
+// Prepare always fails with ErrNoShardKey, since a query string alone does not pick a shard.
+func (s *ShardedDB) Prepare(query string) (*sql.Stmt, error) {
+	return s.PrepareContext(context.Background(), query)
+}
+
+// Exec always fails with ErrNoShardKey, since a query string alone does not pick a shard.
+func (s *ShardedDB) Exec(query string, args ...any) (sql.Result, error) {
+	return s.ExecContext(context.Background(), query, args...)
+}
+
+// Query always fails with ErrNoShardKey, since a query string alone does not pick a shard.
+func (s *ShardedDB) Query(query string, args ...any) (*sql.Rows, error) {
+	return s.QueryContext(context.Background(), query, args...)
+}
+
+// QueryRow returns a *sql.Row whose Scan fails with ErrNoShardKey, since a query string alone does not
+// pick a shard.
+func (s *ShardedDB) QueryRow(query string, args ...any) *sql.Row {
+	return s.QueryRowContext(context.Background(), query, args...)
+}
+
+// PrepareContext always fails with ErrNoShardKey, since a query string alone does not pick a shard.
+func (s *ShardedDB) PrepareContext(context.Context, string) (*sql.Stmt, error) {
+	return nil, ErrNoShardKey
+}
+
+// ExecContext always fails with ErrNoShardKey, since a query string alone does not pick a shard.
+func (s *ShardedDB) ExecContext(context.Context, string, ...any) (sql.Result, error) {
+	return nil, ErrNoShardKey
+}
+
+// QueryContext always fails with ErrNoShardKey, since a query string alone does not pick a shard.
+func (s *ShardedDB) QueryContext(context.Context, string, ...any) (*sql.Rows, error) {
+	return nil, ErrNoShardKey
+}
+
+// QueryRowContext returns a *sql.Row whose Scan fails with ErrNoShardKey, since a query string alone
+// does not pick a shard.
+func (s *ShardedDB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return noShardKeyDB().QueryRowContext(ctx, query, args...)
+}
+
+// noShardKeyDB returns a handle whose connections fail with ErrNoShardKey. A *sql.Row cannot be built
+// outside database/sql, so QueryRowContext returns one from this handle to report the error. The handle
+// is opened on first use, since every *sql.DB starts a goroutine.
+var noShardKeyDB = sync.OnceValue(func() *sql.DB {
+	return sql.OpenDB(noShardKeyConnector{})
+})
+
+// noShardKeyConnector is the driver.Connector of noShardKeyDB.
+type noShardKeyConnector struct{}
+
+// Connect always fails with ErrNoShardKey.
+func (noShardKeyConnector) Connect(context.Context) (driver.Conn, error) {
+	return nil, ErrNoShardKey
+}
+
+// Driver returns the connector itself.
+func (c noShardKeyConnector) Driver() driver.Driver {
+	return c
+}
+
+// Open always fails with ErrNoShardKey.
+func (noShardKeyConnector) Open(string) (driver.Conn, error) {
+	return nil, ErrNoShardKey
+}
+
+// Close closes the shards that implement DBCloser.
+func (s *ShardedDB) Close() error {
+	var errs []error
+	for _, shard := range s.shards {
+		if closer, ok := shard.(DBCloser); ok {
+			errs = append(errs, closer.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Ping pings the shards that implement DBPinger.
+func (s *ShardedDB) Ping() error {
+	var errs []error
+	for i, shard := range s.shards {
+		if pinger, ok := shard.(DBPinger); ok {
+			if err := pinger.Ping(); err != nil {
+				errs = append(errs, fmt.Errorf("shard %d: %w", i, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+var (
+	_ DB            = (*ShardedDB)(nil)
+	_ DBInterceptor = (*ShardedDB)(nil)
+)
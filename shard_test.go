@@ -0,0 +1,236 @@
+package dbsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestShardedDB(t *testing.T) {
+	t.Parallel()
+
+	newShards := func(t *testing.T) ([]DBPreparerExecutor, []*fakeDriver) {
+		shards := make([]DBPreparerExecutor, 3)
+		fakes := make([]*fakeDriver, 3)
+		for i := range shards {
+			shardDB, fake := NewFakeDB(t)
+			shards[i], fakes[i] = shardDB, fake
+		}
+		return shards, fakes
+	}
+
+	tests := []struct {
+		desc      string
+		assertion func(*testing.T, string)
+	}{
+		{
+			desc: "Statements with a shard key bound run on the hashed shard only",
+			assertion: func(t *testing.T, desc string) {
+				shards, fakes := newShards(t)
+				sharded, err := NewShardedDB(shards)
+				require.NoError(t, err, desc)
+
+				updateCustomer, err := PrepareStatement(
+					"UPDATE customers SET first_name = @first_name WHERE customer_id = @customer_id",
+					ShardKey("customer_id"),
+				)
+				require.NoError(t, err, desc)
+				require.Equal(t, "customer_id", statementShardKey(updateCustomer), desc)
+
+				result, err := ExecContext(context.Background(), sharded, updateCustomer,
+					BindParameterValue("first_name", "John"),
+					BindParameterValue("customer_id", 42),
+				)
+				require.NoError(t, err, desc)
+				rowsAffected, err := result.RowsAffected()
+				require.NoError(t, err, desc)
+				require.Equal(t, int64(1), rowsAffected, desc)
+
+				expected, err := HashShard(42, 3)
+				require.NoError(t, err, desc)
+				stringShard, err := HashShard("42", 3)
+				require.NoError(t, err, desc)
+				require.Equal(t, expected, stringShard, desc)
+
+				shard, err := sharded.Shard(42)
+				require.NoError(t, err, desc)
+				require.Equal(t, shards[expected], shard, desc)
+
+				for i, fake := range fakes {
+					if i == expected {
+						require.Equal(t, 1, fake.ExecCount(), desc)
+						continue
+					}
+					require.Equal(t, 0, fake.ExecCount(), desc)
+				}
+			},
+		},
+		{
+			desc: "Queries without a shard key are gathered from every shard",
+			assertion: func(t *testing.T, desc string) {
+				shards, fakes := newShards(t)
+				for i := range fakes {
+					i := i
+					fakes[i].QueryFunc = func(string, []any) (driver.Rows, error) {
+						return newFakeRows([]string{"shard"}, []driver.Value{int64(i)}), nil
+					}
+				}
+
+				sharded, err := NewShardedDB(shards)
+				require.NoError(t, err, desc)
+
+				selectCustomers, err := PrepareStatement("SELECT * FROM customers WHERE last_name = @last_name")
+				require.NoError(t, err, desc)
+
+				mappedRows, err := sharded.QueryRows(context.Background(), selectCustomers, BindParameterValue("last_name", "Doe"))
+				require.NoError(t, err, desc)
+				require.Equal(t, MappedRows{{"shard": int64(0)}, {"shard": int64(1)}, {"shard": int64(2)}}, mappedRows, desc)
+				for _, fake := range fakes {
+					require.Equal(t, []any{"Doe"}, fake.LastQuery().Args, desc)
+				}
+
+				_, err = QueryContext(context.Background(), sharded, selectCustomers)
+				require.ErrorIs(t, err, ErrNoShardKey, desc)
+			},
+		},
+		{
+			desc: "A failing shard fails the scatter-gather query",
+			assertion: func(t *testing.T, desc string) {
+				shards, fakes := newShards(t)
+				fakes[1].QueryFunc = func(string, []any) (driver.Rows, error) {
+					return nil, errors.New("connection refused")
+				}
+
+				sharded, err := NewShardedDB(shards)
+				require.NoError(t, err, desc)
+
+				selectCustomers, err := PrepareStatement("SELECT * FROM customers")
+				require.NoError(t, err, desc)
+
+				_, err = sharded.QueryRows(context.Background(), selectCustomers)
+				require.ErrorContains(t, err, "shard 1: connection refused", desc)
+			},
+		},
+		{
+			desc: "Statements marked with ShardBroadcast run on every shard and sum the rows affected",
+			assertion: func(t *testing.T, desc string) {
+				shards, fakes := newShards(t)
+				sharded, err := NewShardedDB(shards)
+				require.NoError(t, err, desc)
+
+				deleteCarts, err := PrepareStatement("DELETE FROM carts WHERE expires_at < now()", ShardBroadcast())
+				require.NoError(t, err, desc)
+
+				result, err := ExecContext(context.Background(), sharded, deleteCarts)
+				require.NoError(t, err, desc)
+				rowsAffected, err := result.RowsAffected()
+				require.NoError(t, err, desc)
+				require.Equal(t, int64(3), rowsAffected, desc)
+				_, err = result.LastInsertId()
+				require.Error(t, err, desc)
+
+				for _, fake := range fakes {
+					require.Equal(t, 1, fake.ExecCount(), desc)
+				}
+			},
+		},
+		{
+			desc: "Statements without a usable shard key are refused with ErrNoShardKey",
+			assertion: func(t *testing.T, desc string) {
+				shards, fakes := newShards(t)
+				sharded, err := NewShardedDB(shards)
+				require.NoError(t, err, desc)
+
+				deleteCustomer, err := PrepareStatement(
+					"DELETE FROM customers WHERE customer_id = @customer_id",
+					ShardKey("customer_id"),
+				)
+				require.NoError(t, err, desc)
+				_, err = ExecContext(context.Background(), sharded, deleteCustomer)
+				require.ErrorIs(t, err, ErrNoShardKey, desc)
+				_, err = ExecContext(context.Background(), sharded, deleteCustomer, BindParameterValue("customer_id", nil))
+				require.ErrorIs(t, err, ErrNoShardKey, desc)
+
+				selectCustomer, err := PrepareStatement(
+					"SELECT * FROM customers WHERE customer_id = @customer_id",
+					ShardKey("customer_id"),
+				)
+				require.NoError(t, err, desc)
+				_, err = sharded.QueryRows(context.Background(), selectCustomer)
+				require.ErrorIs(t, err, ErrNoShardKey, desc)
+
+				deleteCarts, err := PrepareStatement("DELETE FROM carts WHERE expires_at < now()")
+				require.NoError(t, err, desc)
+				_, err = ExecContext(context.Background(), sharded, deleteCarts)
+				require.ErrorIs(t, err, ErrNoShardKey, desc)
+
+				insertCart, err := PrepareStatement("INSERT INTO carts DEFAULT VALUES RETURNING cart_id")
+				require.NoError(t, err, desc)
+				_, err = sharded.QueryRows(context.Background(), insertCart)
+				require.ErrorIs(t, err, ErrNoShardKey, desc)
+
+				_, err = sharded.ExecContext(context.Background(), "DELETE FROM carts")
+				require.ErrorIs(t, err, ErrNoShardKey, desc)
+				var cartID int64
+				err = sharded.QueryRowContext(context.Background(), "SELECT cart_id FROM carts LIMIT 1").Scan(&cartID)
+				require.ErrorIs(t, err, ErrNoShardKey, desc)
+				err = sharded.QueryRow("SELECT cart_id FROM carts LIMIT 1").Scan(&cartID)
+				require.ErrorIs(t, err, ErrNoShardKey, desc)
+
+				for _, fake := range fakes {
+					require.Equal(t, 0, fake.ExecCount(), desc)
+					require.Equal(t, 0, fake.QueryCount(), desc)
+				}
+			},
+		},
+		{
+			desc: "RangeShard maps integer keys by range",
+			assertion: func(t *testing.T, desc string) {
+				shards, fakes := newShards(t)
+				sharded, err := NewShardedDB(shards, ShardBy(RangeShard(1000, 2000)))
+				require.NoError(t, err, desc)
+
+				selectCustomer, err := PrepareStatement(
+					"SELECT * FROM customers WHERE customer_id = @customer_id",
+					ShardKey("customer_id"),
+				)
+				require.NoError(t, err, desc)
+
+				for _, customerID := range []any{999, int64(1000), "2500"} {
+					_, err := sharded.QueryRows(context.Background(), selectCustomer, BindParameterValue("customer_id", customerID))
+					require.NoError(t, err, desc)
+				}
+				for _, fake := range fakes {
+					require.Equal(t, 1, fake.QueryCount(), desc)
+				}
+
+				_, err = sharded.QueryRows(context.Background(), selectCustomer, BindParameterValue("customer_id", "abc"))
+				require.EqualError(t, err, `shard key "abc" is not an integer`, desc)
+
+				_, err = RangeShard(1000)(1, 3)
+				require.EqualError(t, err, "1 range bounds given for 3 shards", desc)
+			},
+		},
+		{
+			desc: "NewShardedDB fails without shards",
+			assertion: func(t *testing.T, desc string) {
+				_, err := NewShardedDB(nil)
+				require.EqualError(t, err, "shards are empty", desc)
+
+				_, err = NewShardedDB([]DBPreparerExecutor{nil})
+				require.EqualError(t, err, "shard is nil", desc)
+			},
+		},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			tc.assertion(t, tc.desc)
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package dbsql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// singleflightCall is a query shared by the callers that made it concurrently.
+type singleflightCall struct {
+	done    chan struct{}
+	rows    MappedRows
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// SingleflightDB is a database handle that de-duplicates identical concurrent reads: QueryRows calls
+// made while a query with the same revised SQL and bound values is in flight wait for it instead of
+// sending their own, and each caller receives its own copy of the MappedRows. It is returned by
+// WithSingleflight.
+//
+// Only statements classified as StatementRead and not marked with Volatile are shared, and only when they
+// are queried through QueryRows, or the functions built on it, whether the SingleflightDB is used directly
+// or wrapped by other handles. Query and QueryRow calls return rows that are read by a single caller and
+// are never collapsed, and neither are the calls made inside a transaction. Bound values are compared as
+// the driver receives them, so pointers are compared by the values they point to; queries with a value
+// the driver cannot convert are not shared. A shared query keeps running as long as one of its callers
+// waits for it, even if the caller that started it gave up.
+type SingleflightDB struct {
+	wrappedDB
+
+	mu    sync.Mutex
+	calls map[string]*singleflightCall
+}
+
+// WithSingleflight wraps dbPrepExec so that identical concurrent reads made with QueryRows share one
+// round trip to the database.
+//
+// Example:
+//
+//	db := dbsql.WithSingleflight(sqlDB)
+//	// concurrent requests for the same product share one query
+//	mappedRows, err := dbsql.QueryRows(ctx, db, selectProduct, dbsql.BindParameterValue("product_id", productID))
+func WithSingleflight(dbPrepExec DBPreparerExecutor) *SingleflightDB {
+	return &SingleflightDB{
+		wrappedDB: wrappedDB{dbPrepExec},
+		calls:     make(map[string]*singleflightCall),
+	}
+}
+
+// InterceptCall runs the interceptor chain of the wrapped handle, if any. QueryRows calls of reads share
+// the round trip with the identical calls in flight, and receive a copy of its mapped rows.
+func (s *SingleflightDB) InterceptCall(ctx context.Context, call *Call, next CallHandler) (*CallResult, error) {
+	if call.Operation != OperationQueryRows || callKind(call) != StatementRead ||
+		statementVolatile(call.PreparedStatement) || inTransaction(s.DBPreparerExecutor) {
+		return interceptCall(ctx, s.DBPreparerExecutor, call, next)
+	}
+
+	key, ok := boundQueryKey(call.PreparedStatement)
+	if !ok {
+		return interceptCall(ctx, s.DBPreparerExecutor, call, next)
+	}
+
+	s.mu.Lock()
+	flight, ok := s.calls[key]
+	if ok {
+		flight.waiters++
+		s.mu.Unlock()
+	} else {
+		// The query runs detached from the caller's cancellation, so it survives the caller that started
+		// it as long as others wait for it.
+		queryCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		flight = &singleflightCall{
+			done:    make(chan struct{}),
+			waiters: 1,
+			cancel:  cancel,
+		}
+		s.calls[key] = flight
+		s.mu.Unlock()
+
+		// The statement is copied, so the caller may reuse it while the query runs.
+		shared, err := copyPreparedStatement(call.PreparedStatement)
+
+		go func() {
+			if err == nil {
+				sharedCall := *call
+				sharedCall.PreparedStatement = shared
+
+				var callResult *CallResult
+				callResult, flight.err = interceptCall(queryCtx, s.DBPreparerExecutor, &sharedCall, next)
+				if callResult != nil {
+					flight.rows = callResult.MappedRows
+				}
+			} else {
+				flight.err = err
+			}
+
+			s.mu.Lock()
+			if s.calls[key] == flight {
+				delete(s.calls, key)
+			}
+			s.mu.Unlock()
+
+			cancel()
+			close(flight.done)
+		}()
+	}
+
+	select {
+	case <-flight.done:
+		if flight.err != nil {
+			return nil, flight.err
+		}
+		return &CallResult{MappedRows: flight.rows.Clone()}, nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		if flight.waiters--; flight.waiters < 1 {
+			// Nobody waits for the query anymore; later callers start a new one.
+			flight.cancel()
+			if s.calls[key] == flight {
+				delete(s.calls, key)
+			}
+		}
+		s.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// RunInTx runs txFunc inside a transaction started on the wrapped handle. The reads made inside the
+// transaction are not shared, since they may see the transaction's own writes.
+func (s *SingleflightDB) RunInTx(ctx context.Context, opts *sql.TxOptions, txFunc TxFunc) error {
+	return WithTransaction(ctx, s.DBPreparerExecutor, opts, txFunc)
+}
+
+// boundQueryKey returns the key identifying identical queries: the revised SQL and the bound values as
+// the driver receives them, so pointers are dereferenced and driver.Valuer values resolved. It returns
+// false if a value cannot be converted, in which case the query must not be shared.
+func boundQueryKey(preparedStatement PreparedStatement) (string, bool) {
+	var key strings.Builder
+	key.WriteString(preparedStatement.Revised())
+	for _, value := range preparedStatement.BoundParameterValues() {
+		converted, err := driver.DefaultParameterConverter.ConvertValue(value)
+		if err != nil {
+			return "", false
+		}
+
+		switch converted := converted.(type) {
+		case time.Time:
+			fmt.Fprintf(&key, "\x00%T:%s", converted, converted.Format(time.RFC3339Nano))
+		default:
+			fmt.Fprintf(&key, "\x00%T:%v", converted, converted)
+		}
+	}
+	return key.String(), true
+}
+
+// wrapSession returns conn as is: the reads made on a reserved connection are not shared, since they may
+// depend on the state of the session.
+func (s *SingleflightDB) wrapSession(conn DBPreparerExecutor) DBPreparerExecutor {
+	return conn
+}
+
+var (
+	_ DB             = (*SingleflightDB)(nil)
+	_ DBInterceptor  = (*SingleflightDB)(nil)
+	_ DBTransactor   = (*SingleflightDB)(nil)
+	_ sessionWrapper = (*SingleflightDB)(nil)
+)
@@ -0,0 +1,230 @@
+package dbsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSingleflightDB(t *testing.T) {
+	t.Parallel()
+
+	selectProductQuery := "SELECT * FROM products WHERE product_id = @product_id"
+
+	// waiters returns the number of callers waiting for the shared query of the product.
+	waiters := func(db *SingleflightDB, productID int) int {
+		preparedStatement, err := PrepareStatement(selectProductQuery)
+		if err != nil {
+			return 0
+		}
+		if err := preparedStatement.BindParameterValue("product_id", productID); err != nil {
+			return 0
+		}
+
+		db.mu.Lock()
+		defer db.mu.Unlock()
+		key, _ := boundQueryKey(preparedStatement)
+		if call, ok := db.calls[key]; ok {
+			return call.waiters
+		}
+		return 0
+	}
+
+	type result struct {
+		rows MappedRows
+		err  error
+	}
+
+	query := func(ctx context.Context, db DBPreparerExecutor, productID int, results chan<- result) {
+		go func() {
+			selectProduct, err := PrepareStatement(selectProductQuery)
+			if err != nil {
+				results <- result{err: err}
+				return
+			}
+			rows, err := QueryRows(ctx, db, selectProduct, BindParameterValue("product_id", productID))
+			results <- result{rows: rows, err: err}
+		}()
+	}
+
+	tests := []struct {
+		desc      string
+		assertion func(*testing.T, string)
+	}{
+		{
+			desc: "Identical concurrent reads share one query and receive their own copy",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fake := NewFakeDB(t)
+				gate := make(chan struct{})
+				fake.QueryFunc = func(_ string, args []any) (driver.Rows, error) {
+					<-gate
+					return newFakeRows([]string{"product_id", "name"}, []driver.Value{args[0], []byte("lamp")}), nil
+				}
+
+				db := WithSingleflight(sqlDB)
+				results := make(chan result, 4)
+				for i := 0; i < 3; i++ {
+					query(context.Background(), db, 1, results)
+				}
+				require.Eventually(t, func() bool { return waiters(db, 1) == 3 }, time.Second, time.Millisecond, desc)
+				query(context.Background(), db, 2, results)
+				require.Eventually(t, func() bool { return waiters(db, 2) == 1 }, time.Second, time.Millisecond, desc)
+
+				close(gate)
+				var rows []MappedRows
+				for i := 0; i < 4; i++ {
+					r := <-results
+					require.NoError(t, r.err, desc)
+					require.Len(t, r.rows, 1, desc)
+					rows = append(rows, r.rows)
+				}
+				require.Equal(t, 2, fake.QueryCount(), desc)
+
+				rows[0][0]["name"].([]byte)[0] = 'L'
+				for _, r := range rows[1:] {
+					require.Equal(t, []byte("lamp"), r[0]["name"], desc)
+				}
+			},
+		},
+		{
+			desc: "The shared query survives the caller that started it",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fake := NewFakeDB(t)
+				gate := make(chan struct{})
+				fake.QueryFunc = func(_ string, args []any) (driver.Rows, error) {
+					<-gate
+					return newFakeRows([]string{"product_id"}, []driver.Value{args[0]}), nil
+				}
+
+				db := WithSingleflight(sqlDB)
+				ctx, cancel := context.WithCancel(context.Background())
+				leader := make(chan result, 1)
+				query(ctx, db, 1, leader)
+				require.Eventually(t, func() bool { return waiters(db, 1) == 1 }, time.Second, time.Millisecond, desc)
+				follower := make(chan result, 1)
+				query(context.Background(), db, 1, follower)
+				require.Eventually(t, func() bool { return waiters(db, 1) == 2 }, time.Second, time.Millisecond, desc)
+
+				cancel()
+				require.ErrorIs(t, (<-leader).err, context.Canceled, desc)
+
+				close(gate)
+				r := <-follower
+				require.NoError(t, r.err, desc)
+				require.Equal(t, MappedRows{{"product_id": 1}}, r.rows, desc)
+				require.Equal(t, 1, fake.QueryCount(), desc)
+			},
+		},
+		{
+			desc: "Reads are shared when the SingleflightDB is wrapped by other handles",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fake := NewFakeDB(t)
+				gate := make(chan struct{})
+				fake.QueryFunc = func(_ string, args []any) (driver.Rows, error) {
+					<-gate
+					return newFakeRows([]string{"product_id"}, []driver.Value{args[0]}), nil
+				}
+
+				db := WithSingleflight(sqlDB)
+				wrapped := WithReadOnly(WithInterceptors(db))
+				results := make(chan result, 2)
+				for i := 0; i < 2; i++ {
+					query(context.Background(), wrapped, 1, results)
+				}
+				require.Eventually(t, func() bool { return waiters(db, 1) == 2 }, time.Second, time.Millisecond, desc)
+
+				close(gate)
+				for i := 0; i < 2; i++ {
+					r := <-results
+					require.NoError(t, r.err, desc)
+					require.Equal(t, MappedRows{{"product_id": 1}}, r.rows, desc)
+				}
+				require.Equal(t, 1, fake.QueryCount(), desc)
+			},
+		},
+		{
+			desc: "Volatile reads are not shared",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fake := NewFakeDB(t)
+				gate := make(chan struct{})
+				fake.QueryFunc = func(string, []any) (driver.Rows, error) {
+					<-gate
+					return newFakeRows([]string{"nextval"}, []driver.Value{int64(1)}), nil
+				}
+
+				db := WithSingleflight(sqlDB)
+				errs := make(chan error, 2)
+				for i := 0; i < 2; i++ {
+					go func() {
+						nextOrderNumber, err := PrepareStatement("SELECT nextval('order_numbers')", Volatile())
+						if err == nil {
+							_, err = QueryRows(context.Background(), db, nextOrderNumber)
+						}
+						errs <- err
+					}()
+				}
+				require.Eventually(t, func() bool { return fake.QueryCount() == 2 }, time.Second, time.Millisecond, desc)
+
+				close(gate)
+				for i := 0; i < 2; i++ {
+					require.NoError(t, <-errs, desc)
+				}
+			},
+		},
+		{
+			desc: "Bound values are keyed by value, pointers included, and unsupported values are not shared",
+			assertion: func(t *testing.T, desc string) {
+				bind := func(value any) PreparedStatement {
+					preparedStatement, err := PrepareStatement(selectProductQuery)
+					require.NoError(t, err, desc)
+					require.NoError(t, preparedStatement.BindParameterValue("product_id", value), desc)
+					return preparedStatement
+				}
+
+				first, second, other := 1, 1, 2
+				firstKey, ok := boundQueryKey(bind(&first))
+				require.True(t, ok, desc)
+				secondKey, ok := boundQueryKey(bind(&second))
+				require.True(t, ok, desc)
+				require.Equal(t, firstKey, secondKey, desc)
+
+				otherKey, ok := boundQueryKey(bind(&other))
+				require.True(t, ok, desc)
+				require.NotEqual(t, firstKey, otherKey, desc)
+
+				stringKey, ok := boundQueryKey(bind("1"))
+				require.True(t, ok, desc)
+				require.NotEqual(t, firstKey, stringKey, desc)
+
+				_, ok = boundQueryKey(bind(struct{ ID int }{ID: 1}))
+				require.False(t, ok, desc)
+			},
+		},
+		{
+			desc: "Writes are not shared",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fake := NewFakeDB(t)
+				db := WithSingleflight(sqlDB)
+
+				deleteCarts, err := PrepareStatement("DELETE FROM carts RETURNING cart_id")
+				require.NoError(t, err, desc)
+				for i := 0; i < 2; i++ {
+					_, err := QueryRows(context.Background(), db, deleteCarts)
+					require.NoError(t, err, desc)
+				}
+				require.Equal(t, 2, fake.QueryCount(), desc)
+			},
+		},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			tc.assertion(t, tc.desc)
+		})
+	}
+}
@@ -0,0 +1,264 @@
+package dbsql
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// sqlTokenKind identifies the kind of a sqlToken.
+type sqlTokenKind int
+
+const (
+	// sqlTokenWord is a keyword or an unquoted identifier.
+	sqlTokenWord sqlTokenKind = iota
+	// sqlTokenQuotedIdentifier is a double-quoted identifier.
+	sqlTokenQuotedIdentifier
+	// sqlTokenString is a string constant, including escape, bit and dollar-quoted strings.
+	sqlTokenString
+	// sqlTokenNumber is a numeric constant.
+	sqlTokenNumber
+	// sqlTokenPlaceholder is a positional ($1) or named (@name) parameter.
+	sqlTokenPlaceholder
+	// sqlTokenOperator is an operator or a punctuation character.
+	sqlTokenOperator
+	// sqlTokenComment is a line or block comment.
+	sqlTokenComment
+)
+
+// sqlToken is a single lexical token of an SQL statement.
+type sqlToken struct {
+	kind sqlTokenKind
+	text string
+}
+
+// is reports whether the token is the given keyword, compared case-insensitively.
+func (t sqlToken) is(keyword string) bool {
+	return t.kind == sqlTokenWord && strings.EqualFold(t.text, keyword)
+}
+
+// identifier returns the token as an identifier: unquoted words are folded to lower case, as
+// PostgreSQL does, and quoted identifiers are unquoted.
+func (t sqlToken) identifier() string {
+	if t.kind == sqlTokenQuotedIdentifier {
+		return strings.ReplaceAll(strings.Trim(t.text, `"`), `""`, `"`)
+	}
+	return strings.ToLower(t.text)
+}
+
+// sqlOperatorChars are the characters PostgreSQL allows in multi-character operators.
+const sqlOperatorChars = "+-*/<>=~!@#%^&|`?"
+
+// lexSQL splits an SQL statement into tokens. It understands PostgreSQL comments, string constants,
+// quoted identifiers and dollar quoting well enough to never mistake their content for SQL. Whitespace
+// is dropped.
+func lexSQL(statement string) []sqlToken {
+	var tokens []sqlToken
+
+	for i := 0; i < len(statement); {
+		r, size := utf8.DecodeRuneInString(statement[i:])
+		start := i
+
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+			continue
+		case strings.HasPrefix(statement[i:], "--"):
+			i = indexFrom(statement, i, "\n", len(statement))
+			tokens = append(tokens, sqlToken{kind: sqlTokenComment, text: statement[start:i]})
+		case strings.HasPrefix(statement[i:], "/*"):
+			i = endOfBlockComment(statement, i)
+			tokens = append(tokens, sqlToken{kind: sqlTokenComment, text: statement[start:i]})
+		case r == '\'':
+			i = endOfQuoted(statement, i+1, '\'', false)
+			tokens = append(tokens, sqlToken{kind: sqlTokenString, text: statement[start:i]})
+		case strings.ContainsRune("EeBbXxNnUu", r) && i+1 < len(statement) && statement[i+1] == '\'':
+			i = endOfQuoted(statement, i+2, '\'', r == 'E' || r == 'e')
+			tokens = append(tokens, sqlToken{kind: sqlTokenString, text: statement[start:i]})
+		case r == '"':
+			i = endOfQuoted(statement, i+1, '"', false)
+			tokens = append(tokens, sqlToken{kind: sqlTokenQuotedIdentifier, text: statement[start:i]})
+		case r == '$':
+			if end, ok := endOfPositionalParameter(statement, i); ok {
+				i = end
+				tokens = append(tokens, sqlToken{kind: sqlTokenPlaceholder, text: statement[start:i]})
+				continue
+			}
+			if end, ok := endOfDollarQuoted(statement, i); ok {
+				i = end
+				tokens = append(tokens, sqlToken{kind: sqlTokenString, text: statement[start:i]})
+				continue
+			}
+			i += size
+			tokens = append(tokens, sqlToken{kind: sqlTokenOperator, text: statement[start:i]})
+		case r == parameterPrefix && isStartOfNamedParameter(r, []byte(statement[i+size:])):
+			i = endOfWord(statement, i+size)
+			tokens = append(tokens, sqlToken{kind: sqlTokenPlaceholder, text: statement[start:i]})
+		case r >= '0' && r <= '9' || r == '.' && i+1 < len(statement) && isDigit(statement[i+1]):
+			i = endOfNumber(statement, i)
+			tokens = append(tokens, sqlToken{kind: sqlTokenNumber, text: statement[start:i]})
+		case r == runeUnderscore || unicode.IsLetter(r):
+			i = endOfWord(statement, i)
+			tokens = append(tokens, sqlToken{kind: sqlTokenWord, text: statement[start:i]})
+		case strings.ContainsRune(sqlOperatorChars, r):
+			for i < len(statement) && strings.IndexByte(sqlOperatorChars, statement[i]) >= 0 &&
+				!strings.HasPrefix(statement[i:], "--") && !strings.HasPrefix(statement[i:], "/*") {
+				i++
+			}
+			tokens = append(tokens, sqlToken{kind: sqlTokenOperator, text: statement[start:i]})
+		case r == ':' && strings.HasPrefix(statement[i:], "::"):
+			i += 2
+			tokens = append(tokens, sqlToken{kind: sqlTokenOperator, text: statement[start:i]})
+		default:
+			i += size
+			tokens = append(tokens, sqlToken{kind: sqlTokenOperator, text: statement[start:i]})
+		}
+	}
+
+	return tokens
+}
+
+// indexFrom returns the index of substr in s at or after from, or notFound.
+func indexFrom(s string, from int, substr string, notFound int) int {
+	if idx := strings.Index(s[from:], substr); idx >= 0 {
+		return from + idx
+	}
+	return notFound
+}
+
+// endOfBlockComment returns the index following the block comment starting at start. Block comments nest.
+func endOfBlockComment(s string, start int) int {
+	depth := 0
+	for i := start; i < len(s)-1; i++ {
+		switch {
+		case s[i] == '/' && s[i+1] == '*':
+			depth++
+			i++
+		case s[i] == '*' && s[i+1] == '/':
+			depth--
+			i++
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return len(s)
+}
+
+// endOfQuoted returns the index following the closing quote of a quoted string or identifier whose
+// content starts at start. A doubled quote is an escaped quote, and with backslashEscapes a backslash
+// escapes the following character.
+func endOfQuoted(s string, start int, quote byte, backslashEscapes bool) int {
+	for i := start; i < len(s); i++ {
+		switch {
+		case backslashEscapes && s[i] == '\\':
+			i++
+		case s[i] == quote:
+			if i+1 < len(s) && s[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(s)
+}
+
+// endOfPositionalParameter returns the index following a $n parameter starting at start.
+func endOfPositionalParameter(s string, start int) (int, bool) {
+	i := start + 1
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	return i, i > start+1
+}
+
+// endOfDollarQuoted returns the index following a $tag$...$tag$ string starting at start.
+func endOfDollarQuoted(s string, start int) (int, bool) {
+	tagEnd := strings.IndexByte(s[start+1:], '$')
+	if tagEnd < 0 {
+		return 0, false
+	}
+	tag := s[start : start+tagEnd+2]
+	for _, r := range tag[1 : len(tag)-1] {
+		if r != runeUnderscore && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			return 0, false
+		}
+	}
+
+	contentStart := start + len(tag)
+	return indexFrom(s, contentStart, tag, len(s)-len(tag)) + len(tag), true
+}
+
+// endOfWord returns the index following the identifier characters starting at start.
+func endOfWord(s string, start int) int {
+	i := start
+	for i < len(s) {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r != runeUnderscore && r != '$' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			break
+		}
+		i += size
+	}
+	return i
+}
+
+// endOfNumber returns the index following the numeric constant starting at start.
+func endOfNumber(s string, start int) int {
+	i := start
+	for i < len(s) && (isDigit(s[i]) || s[i] == '.' || s[i] == '_') {
+		i++
+	}
+	if i < len(s) && (s[i] == 'e' || s[i] == 'E') {
+		j := i + 1
+		if j < len(s) && (s[j] == '+' || s[j] == '-') {
+			j++
+		}
+		if j < len(s) && isDigit(s[j]) {
+			i = j
+			for i < len(s) && isDigit(s[i]) {
+				i++
+			}
+		}
+	}
+	return i
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+// Fingerprint returns a normalized form of an SQL statement that is identical for statements that only
+// differ in whitespace, comments, keyword case, constants or parameter numbering. It is used to group
+// statements that have no name.
+//
+// Example:
+//
+//	dbsql.Fingerprint("SELECT *\n FROM customers WHERE customer_id = 42 -- by id")
+//	// Output: select * from customers where customer_id = ?
+func Fingerprint(statement string) string {
+	tokens := lexSQL(statement)
+
+	var builder strings.Builder
+	builder.Grow(len(statement))
+	for _, token := range tokens {
+		var text string
+		switch token.kind {
+		case sqlTokenComment:
+			continue
+		case sqlTokenString, sqlTokenNumber, sqlTokenPlaceholder:
+			text = "?"
+		case sqlTokenWord:
+			text = strings.ToLower(token.text)
+		default:
+			text = token.text
+		}
+
+		if builder.Len() > 0 {
+			builder.WriteByte(' ')
+		}
+		builder.WriteString(text)
+	}
+
+	return builder.String()
+}
@@ -0,0 +1,73 @@
+package dbsql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFingerprint(t *testing.T) {
+	tests := []struct {
+		Name        string
+		Statement   string
+		Fingerprint string
+	}{
+		{
+			Name:        "Whitespace and keyword case",
+			Statement:   "SELECT *\n\tFROM   customers",
+			Fingerprint: "select * from customers",
+		},
+		{
+			Name:        "Constants and parameters",
+			Statement:   "select * from customers where customer_id = 42 and last_name = 'O''Brien' and first_name = $1",
+			Fingerprint: "select * from customers where customer_id = ? and last_name = ? and first_name = ?",
+		},
+		{
+			Name:        "Comments",
+			Statement:   "/* app='x' /* nested */ */ SELECT 1 -- trailing",
+			Fingerprint: "select ?",
+		},
+		{
+			Name:        "Dollar quoted strings",
+			Statement:   "SELECT $body$ it's -- not a comment $body$, $$x$$",
+			Fingerprint: "select ? , ?",
+		},
+		{
+			Name:        "Quoted identifiers and operators",
+			Statement:   `SELECT "Last Name"::text FROM t WHERE metadata @> @filter AND a <> b`,
+			Fingerprint: `select "Last Name" :: text from t where metadata @> ? and a <> b`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			require.Equal(t, test.Fingerprint, Fingerprint(test.Statement))
+		})
+	}
+}
+
+func TestIsReadStatement(t *testing.T) {
+	tests := []struct {
+		Statement string
+		Read      bool
+	}{
+		{Statement: "SELECT * FROM customers", Read: true},
+		{Statement: "  -- leading comment\n select 1", Read: true},
+		{Statement: "WITH c AS (SELECT 1) SELECT * FROM c", Read: true},
+		{Statement: "SELECT 'INSERT INTO' AS text", Read: true},
+		{Statement: "EXPLAIN SELECT 1", Read: true},
+		{Statement: "EXPLAIN ANALYZE DELETE FROM customers", Read: false},
+		{Statement: "SELECT * FROM customers FOR UPDATE", Read: false},
+		{Statement: "SELECT * FROM customers FOR NO KEY UPDATE", Read: false},
+		{Statement: "SELECT * INTO customers_copy FROM customers", Read: false},
+		{Statement: "WITH d AS (DELETE FROM customers RETURNING *) SELECT * FROM d", Read: false},
+		{Statement: "INSERT INTO customers (last_name) VALUES ($1)", Read: false},
+		{Statement: "UPDATE customers SET last_name = $1", Read: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Statement, func(t *testing.T) {
+			require.Equal(t, test.Read, isReadStatement(test.Statement))
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package dbsql
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// SQLCommentTagFunc returns the value of an SQL comment tag for a call made with ctx. An empty value
+// omits the tag.
+type SQLCommentTagFunc func(ctx context.Context) string
+
+// SQLCommenterOption configures the interceptor returned by SQLCommenterInterceptor.
+type SQLCommenterOption func(config *sqlCommenterConfig)
+
+// sqlCommenterConfig holds the configuration of an SQL commenter interceptor.
+type sqlCommenterConfig struct {
+	keys     []string
+	tagFuncs map[string]SQLCommentTagFunc
+}
+
+// WithSQLCommentTag adds a tag with a fixed value, e.g. the application name, to every comment.
+func WithSQLCommentTag(key, value string) SQLCommenterOption {
+	return WithSQLCommentTagFunc(key, func(context.Context) string {
+		return value
+	})
+}
+
+// WithSQLCommentTagFunc adds a tag whose value is computed from the call's context, e.g. the
+// traceparent of the current span.
+func WithSQLCommentTagFunc(key string, tagFunc SQLCommentTagFunc) SQLCommenterOption {
+	return func(config *sqlCommenterConfig) {
+		if _, ok := config.tagFuncs[key]; !ok {
+			config.keys = append(config.keys, key)
+		}
+		config.tagFuncs[key] = tagFunc
+	}
+}
+
+type sqlCommentTagsKey struct{}
+
+// ContextWithSQLCommentTag returns a copy of ctx carrying an SQL comment tag, e.g. the route of the
+// request being served. Tags in the context take precedence over the tags configured on the interceptor.
+func ContextWithSQLCommentTag(ctx context.Context, key, value string) context.Context {
+	parent, _ := ctx.Value(sqlCommentTagsKey{}).(map[string]string)
+
+	tags := make(map[string]string, len(parent)+1)
+	for k, v := range parent {
+		tags[k] = v
+	}
+	tags[key] = value
+
+	return context.WithValue(ctx, sqlCommentTagsKey{}, tags)
+}
+
+// SQLCommenterInterceptor returns an Interceptor that tags calls with a comment in the sqlcommenter
+// format, e.g. /*app='billing',route='%2Finvoices'*/, built from the configured tags and the tags in the
+// call's context. Statements that already contain a comment are left untouched.
+//
+// The comment is set on Call.Comment rather than on the query, so tagged calls are sent as unnamed
+// statements and never create a server-side prepared statement per tagged variant.
+//
+// Example:
+//
+//	db := dbsql.WithInterceptors(
+//		sqlDB,
+//		dbsql.SQLCommenterInterceptor(
+//			dbsql.WithSQLCommentTag("app", "billing"),
+//			oteltracer.TraceparentSQLCommentTag(),
+//		),
+//	)
+//	ctx = dbsql.ContextWithSQLCommentTag(ctx, "route", "/invoices")
+func SQLCommenterInterceptor(opts ...SQLCommenterOption) Interceptor {
+	config := &sqlCommenterConfig{
+		tagFuncs: make(map[string]SQLCommentTagFunc),
+	}
+	for i := range opts {
+		opts[i](config)
+	}
+
+	return func(ctx context.Context, call *Call, next CallHandler) (*CallResult, error) {
+		if call.Comment != "" || hasSQLComment(call.Query) {
+			return next(ctx, call)
+		}
+
+		tags := make(map[string]string, len(config.keys))
+		for _, key := range config.keys {
+			if tagFunc := config.tagFuncs[key]; tagFunc != nil {
+				tags[key] = tagFunc(ctx)
+			}
+		}
+		if contextTags, ok := ctx.Value(sqlCommentTagsKey{}).(map[string]string); ok {
+			for key, value := range contextTags {
+				tags[key] = value
+			}
+		}
+
+		call.Comment = FormatSQLComment(tags)
+
+		return next(ctx, call)
+	}
+}
+
+// FormatSQLComment formats tags as an sqlcommenter comment. Keys and values are percent-encoded, values
+// are single-quoted and the tags are sorted by key. Tags with an empty value are omitted, and an empty
+// string is returned if no tag remains.
+func FormatSQLComment(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for key, value := range tags {
+		if key != "" && value != "" {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) < 1 {
+		return ""
+	}
+	sort.Strings(keys)
+
+	var builder strings.Builder
+	builder.WriteString("/*")
+	for i, key := range keys {
+		if i > 0 {
+			builder.WriteByte(',')
+		}
+		builder.WriteString(url.PathEscape(key))
+		builder.WriteString("='")
+		builder.WriteString(strings.ReplaceAll(url.PathEscape(tags[key]), "'", `\'`))
+		builder.WriteByte('\'')
+	}
+	builder.WriteString("*/")
+
+	return builder.String()
+}
+
+// appendSQLComment appends comment to query, keeping a trailing semicolon at the end.
+func appendSQLComment(query, comment string) string {
+	if comment == "" {
+		return query
+	}
+
+	trimmed := strings.TrimRightFunc(query, func(r rune) bool {
+		return r == ';' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	})
+	if strings.Contains(query[len(trimmed):], ";") {
+		return trimmed + " " + comment + ";"
+	}
+	return trimmed + " " + comment
+}
+
+// hasSQLComment reports whether the statement contains a comment.
+func hasSQLComment(statement string) bool {
+	if !strings.Contains(statement, "--") && !strings.Contains(statement, "/*") {
+		return false
+	}
+	for _, token := range lexSQL(statement) {
+		if token.kind == sqlTokenComment {
+			return true
+		}
+	}
+	return false
+}
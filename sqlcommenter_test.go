@@ -0,0 +1,104 @@
+package dbsql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatSQLComment(t *testing.T) {
+	require.Empty(t, FormatSQLComment(nil))
+	require.Equal(
+		t,
+		`/*app='billing',route='%2Finvoices%2F%7Bid%7D',user='o%27brien'*/`,
+		FormatSQLComment(map[string]string{
+			"route": "/invoices/{id}",
+			"app":   "billing",
+			"user":  "o'brien",
+			"empty": "",
+		}),
+	)
+}
+
+func TestSQLCommenterInterceptor(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		desc      string
+		assertion func(*testing.T, string)
+	}{
+		{
+			desc: "Tagged calls are sent unprepared with the comment appended",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fd := NewFakeDB(t)
+
+				db := WithInterceptors(
+					sqlDB,
+					SQLCommenterInterceptor(
+						WithSQLCommentTag("app", "billing"),
+						WithSQLCommentTagFunc("traceparent", func(context.Context) string {
+							return "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+						}),
+					),
+				)
+
+				preparedStatement, err := PrepareStatement("DELETE FROM customers WHERE customer_id = @customer_id;")
+				require.NoError(t, err, desc)
+
+				ctx := ContextWithSQLCommentTag(context.Background(), "route", "/customers")
+				for _, route := range []string{"/customers", "/admin"} {
+					ctx = ContextWithSQLCommentTag(ctx, "route", route)
+					_, err = ExecContext(ctx, db, preparedStatement, BindParameterValue("customer_id", 1))
+					require.NoError(t, err, desc)
+				}
+
+				require.Empty(t, fd.Prepared, desc)
+				require.Equal(
+					t,
+					"DELETE FROM customers WHERE customer_id = $1 "+
+						"/*app='billing',route='%2Fadmin',traceparent='00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01'*/;",
+					fd.LastExec().Query,
+					desc,
+				)
+				require.Equal(t, []any{1}, fd.LastExec().Args, desc)
+			},
+		},
+		{
+			desc: "Calls without tags are prepared as usual",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fd := NewFakeDB(t)
+
+				db := WithInterceptors(sqlDB, SQLCommenterInterceptor())
+
+				preparedStatement, err := PrepareStatement("DELETE FROM customers")
+				require.NoError(t, err, desc)
+
+				_, err = ExecContext(context.Background(), db, preparedStatement)
+				require.NoError(t, err, desc)
+				require.Equal(t, []string{"DELETE FROM customers"}, fd.Prepared, desc)
+			},
+		},
+		{
+			desc: "Statements with a comment are left untouched",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fd := NewFakeDB(t)
+
+				db := WithInterceptors(sqlDB, SQLCommenterInterceptor(WithSQLCommentTag("app", "billing")))
+
+				preparedStatement, err := PrepareStatement("/* existing */ DELETE FROM customers")
+				require.NoError(t, err, desc)
+
+				_, err = ExecContext(context.Background(), db, preparedStatement)
+				require.NoError(t, err, desc)
+				require.Equal(t, "/* existing */ DELETE FROM customers", fd.LastExec().Query, desc)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			test.assertion(t, test.desc)
+		})
+	}
+}
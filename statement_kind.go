@@ -0,0 +1,375 @@
+package dbsql
+
+import (
+	"strings"
+)
+
+// StatementKind classifies an SQL statement by its effect on the database.
+type StatementKind int
+
+const (
+	// StatementUnknown is a statement that could not be classified, such as EXECUTE, whose effect depends
+	// on the statement prepared earlier.
+	StatementUnknown StatementKind = iota
+	// StatementRead is a query that only reads data: SELECT, VALUES, TABLE, SHOW, a WITH query without
+	// data-modifying clauses, or an EXPLAIN without ANALYZE.
+	StatementRead
+	// StatementWrite modifies data, locks rows or has other side effects: INSERT, UPDATE, DELETE, MERGE,
+	// TRUNCATE, COPY FROM, CALL, DO, LOCK, NOTIFY, VACUUM, ANALYZE, CLUSTER, REINDEX, SELECT ... FOR
+	// UPDATE/SHARE and WITH queries with data-modifying clauses.
+	StatementWrite
+	// StatementDDL changes the schema or privileges: CREATE, ALTER, DROP, GRANT, REVOKE, COMMENT, REFRESH
+	// and SELECT ... INTO.
+	StatementDDL
+	// StatementTransactionControl starts, ends or configures a transaction: BEGIN, COMMIT, ROLLBACK,
+	// SAVEPOINT, RELEASE, SET TRANSACTION and the two-phase commit statements.
+	StatementTransactionControl
+	// StatementUtility is any other recognized statement, such as SET, LISTEN, CHECKPOINT or the cursor
+	// commands. PREPARE is classified as the statement it prepares.
+	StatementUtility
+)
+
+var statementKindNames = [...]string{
+	StatementUnknown:            "unknown",
+	StatementRead:               "read",
+	StatementWrite:              "write",
+	StatementDDL:                "ddl",
+	StatementTransactionControl: "transaction_control",
+	StatementUtility:            "utility",
+}
+
+// String returns the name of the kind, e.g. "read" or "transaction_control".
+func (k StatementKind) String() string {
+	if k < 0 || int(k) >= len(statementKindNames) {
+		return statementKindNames[StatementUnknown]
+	}
+	return statementKindNames[k]
+}
+
+// StatementClassification is the result of ClassifyStatement.
+type StatementClassification struct {
+	// Kind is the kind of the statement.
+	Kind StatementKind
+	// Tables are the tables the statement references, in order of first appearance, schema-qualified
+	// as written. Unquoted names are folded to lower case. Common table expressions are not included.
+	Tables []string
+}
+
+// ClassifyStatement classifies the SQL statement and lists the tables it references. The classification
+// is derived from the statement's tokens, so functions with side effects called from a SELECT, or
+// tables referenced through views and functions, cannot be detected.
+//
+// Example:
+//
+//	dbsql.ClassifyStatement("WITH d AS (DELETE FROM carts RETURNING *) SELECT * FROM d JOIN customers USING (customer_id)")
+//	// Output: {Kind: StatementWrite, Tables: [carts customers]}
+func ClassifyStatement(statement string) StatementClassification {
+	lexed := lexSQL(statement)
+	tokens := lexed[:0]
+	for _, token := range lexed {
+		if token.kind != sqlTokenComment {
+			tokens = append(tokens, token)
+		}
+	}
+
+	return StatementClassification{
+		Kind:   classifyTokens(tokens),
+		Tables: referencedTables(tokens),
+	}
+}
+
+// isReadStatement reports whether the SQL statement is classified as StatementRead.
+func isReadStatement(statement string) bool {
+	return ClassifyStatement(statement).Kind == StatementRead
+}
+
+// callKind returns the kind of the call's query, using the classification of its prepared statement
+// when the query was not rewritten.
+func callKind(call *Call) StatementKind {
+	if call.PreparedStatement != nil && call.Query == call.PreparedStatement.Revised() {
+		return statementKind(call.PreparedStatement)
+	}
+	return ClassifyStatement(call.Query).Kind
+}
+
+// callTables returns the tables referenced by the call's query, using the classification of its prepared
+// statement when the query was not rewritten.
+func callTables(call *Call) []string {
+	if call.PreparedStatement != nil && call.Query == call.PreparedStatement.Revised() {
+		return statementTables(call.PreparedStatement)
+	}
+	return ClassifyStatement(call.Query).Tables
+}
+
+// explainableStatements are the keywords that start the statement explained by EXPLAIN.
+var explainableStatements = []string{
+	"SELECT", "VALUES", "TABLE", "WITH", "INSERT", "UPDATE", "DELETE", "MERGE", "DECLARE", "CREATE", "EXECUTE",
+}
+
+// classifyTokens classifies a statement from its tokens, comments excluded.
+func classifyTokens(tokens []sqlToken) StatementKind {
+	// Queries may be enclosed in parentheses.
+	i := 0
+	for i < len(tokens) && tokens[i].text == "(" {
+		i++
+	}
+	if i >= len(tokens) || tokens[i].kind != sqlTokenWord {
+		return StatementUnknown
+	}
+
+	command := strings.ToUpper(tokens[i].text)
+	rest := tokens[i+1:]
+	next := func(keywords ...string) bool {
+		for j, keyword := range keywords {
+			if j >= len(rest) || !rest[j].is(keyword) {
+				return false
+			}
+		}
+		return true
+	}
+
+	switch command {
+	case "SELECT", "VALUES", "TABLE", "WITH":
+		return classifyQuery(rest)
+	case "SHOW":
+		return StatementRead
+	case "EXPLAIN":
+		for j := range rest {
+			if !isAnyKeyword(rest[j], explainableStatements...) {
+				continue
+			}
+			for _, option := range rest[:j] {
+				if option.is("ANALYZE") {
+					// EXPLAIN ANALYZE executes the statement.
+					return classifyTokens(rest[j:])
+				}
+			}
+			break
+		}
+		return StatementRead
+	case "INSERT", "UPDATE", "DELETE", "MERGE", "TRUNCATE", "CALL", "DO", "LOCK", "NOTIFY", "VACUUM", "ANALYZE",
+		"CLUSTER", "REINDEX":
+		return StatementWrite
+	case "COPY":
+		depth := 0
+		for _, token := range rest {
+			switch {
+			case token.text == "(":
+				depth++
+			case token.text == ")":
+				depth--
+			case depth == 0 && token.is("FROM"):
+				return StatementWrite
+			case depth == 0 && token.is("TO"):
+				return StatementRead
+			}
+		}
+		return StatementUnknown
+	case "CREATE", "ALTER", "DROP", "COMMENT", "GRANT", "REVOKE", "REFRESH", "SECURITY", "IMPORT":
+		return StatementDDL
+	case "BEGIN", "START", "COMMIT", "END", "ROLLBACK", "ABORT", "SAVEPOINT", "RELEASE":
+		return StatementTransactionControl
+	case "PREPARE":
+		if next("TRANSACTION") {
+			return StatementTransactionControl
+		}
+		// PREPARE name [(types)] AS statement
+		depth := 0
+		for j, token := range rest {
+			switch {
+			case token.text == "(":
+				depth++
+			case token.text == ")":
+				depth--
+			case depth == 0 && token.is("AS"):
+				return classifyTokens(rest[j+1:])
+			}
+		}
+		return StatementUnknown
+	case "SET":
+		if next("TRANSACTION") || next("SESSION", "CHARACTERISTICS") || next("CONSTRAINTS") {
+			return StatementTransactionControl
+		}
+		return StatementUtility
+	case "RESET", "LISTEN", "UNLISTEN", "CHECKPOINT", "DISCARD", "DEALLOCATE", "DECLARE", "FETCH", "MOVE",
+		"CLOSE", "LOAD":
+		return StatementUtility
+	default:
+		return StatementUnknown
+	}
+}
+
+// classifyQuery classifies the tokens following SELECT, VALUES, TABLE or WITH.
+func classifyQuery(tokens []sqlToken) StatementKind {
+	for i, token := range tokens {
+		switch {
+		case isAnyKeyword(token, "INSERT", "UPDATE", "DELETE", "MERGE") && isCommonTableExpressionBody(tokens, i):
+			// A data-modifying common table expression; elsewhere the words may name columns or aliases.
+			return StatementWrite
+		case token.is("FOR") && i+1 < len(tokens) && isAnyKeyword(tokens[i+1], "UPDATE", "NO", "SHARE", "KEY"):
+			// A FOR [NO KEY] UPDATE or FOR [KEY] SHARE row lock.
+			return StatementWrite
+		case token.is("INTO"):
+			// SELECT ... INTO creates a table.
+			return StatementDDL
+		}
+	}
+	return StatementRead
+}
+
+// isCommonTableExpressionBody reports whether tokens[i] starts the body of a common table expression:
+// AS [[NOT] MATERIALIZED] (.
+func isCommonTableExpressionBody(tokens []sqlToken, i int) bool {
+	if i < 1 || tokens[i-1].text != "(" {
+		return false
+	}
+	j := i - 2
+	for j >= 0 && isAnyKeyword(tokens[j], "NOT", "MATERIALIZED") {
+		j--
+	}
+	return j >= 0 && tokens[j].is("AS")
+}
+
+// isAnyKeyword reports whether the token is one of the keywords.
+func isAnyKeyword(token sqlToken, keywords ...string) bool {
+	for _, keyword := range keywords {
+		if token.is(keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// fromListTerminators are the keywords that end a FROM list.
+var fromListTerminators = []string{
+	"WHERE", "GROUP", "HAVING", "WINDOW", "ORDER", "LIMIT", "OFFSET", "FETCH", "FOR", "UNION", "INTERSECT",
+	"EXCEPT", "RETURNING", "SET", "SELECT",
+}
+
+// subqueryStatements are the keywords that make a parenthesis the start of a subquery rather than an
+// expression or an argument list.
+var subqueryStatements = []string{"SELECT", "VALUES", "TABLE", "WITH", "INSERT", "UPDATE", "DELETE", "MERGE"}
+
+// referencedTables returns the tables referenced by a statement from its tokens, comments excluded.
+func referencedTables(tokens []sqlToken) []string {
+	var tables []string
+	seen := make(map[string]bool)
+	addTable := func(table string) {
+		if table != "" && !seen[table] {
+			seen[table] = true
+			tables = append(tables, table)
+		}
+	}
+
+	if len(tokens) > 1 && tokens[0].is("COPY") {
+		addTable(tableName(tokens, 1, false))
+		return tables
+	}
+
+	cteNames := make(map[string]bool)
+
+	// subqueries holds, for every open parenthesis, whether it starts a subquery; FROM inside other
+	// parentheses belongs to expressions such as EXTRACT(YEAR FROM created_at).
+	var subqueries []bool
+	// fromLists holds the depths at which a FROM list is open, so comma-separated tables are found.
+	fromLists := make(map[int]bool)
+
+	for i, token := range tokens {
+		depth := len(subqueries)
+		inQuery := depth == 0 || subqueries[depth-1]
+		previous := sqlToken{}
+		if i > 0 {
+			previous = tokens[i-1]
+		}
+
+		switch {
+		case token.text == "(":
+			subqueries = append(subqueries, i+1 < len(tokens) && isAnyKeyword(tokens[i+1], subqueryStatements...))
+		case token.text == ")":
+			delete(fromLists, depth)
+			if depth > 0 {
+				subqueries = subqueries[:depth-1]
+			}
+		case !inQuery:
+		case token.text == "," && fromLists[depth]:
+			addTable(tableName(tokens, i+1, true))
+		case token.is("FROM") && !previous.is("DISTINCT"), token.is("TRUNCATE"):
+			fromLists[depth] = true
+			addTable(tableName(tokens, i+1, true))
+		case isAnyKeyword(token, fromListTerminators...):
+			delete(fromLists, depth)
+		case token.is("JOIN"), token.is("USING"):
+			addTable(tableName(tokens, i+1, true))
+		case token.is("INTO"), token.is("TABLE"):
+			addTable(tableName(tokens, i+1, false))
+		case token.is("UPDATE") && (i == 0 || previous.text == "(" || previous.text == ")"):
+			addTable(tableName(tokens, i+1, false))
+		case (token.kind == sqlTokenWord || token.kind == sqlTokenQuotedIdentifier) && isCommonTableExpression(tokens, i):
+			cteNames[token.identifier()] = true
+		}
+	}
+
+	filtered := tables[:0]
+	for _, table := range tables {
+		if !cteNames[table] {
+			filtered = append(filtered, table)
+		}
+	}
+	if len(filtered) < 1 {
+		return nil
+	}
+	return filtered
+}
+
+// tableName returns the possibly schema-qualified table name starting at tokens[start], or an empty
+// string if there is none. With fromItem, a name followed by a parenthesis is a function call, not a table.
+func tableName(tokens []sqlToken, start int, fromItem bool) string {
+	i := start
+	for i < len(tokens) && isAnyKeyword(tokens[i], "ONLY", "LATERAL", "IF", "NOT", "EXISTS", "TABLE") {
+		i++
+	}
+
+	var parts []string
+	for i < len(tokens) && (tokens[i].kind == sqlTokenWord || tokens[i].kind == sqlTokenQuotedIdentifier) {
+		parts = append(parts, tokens[i].identifier())
+		i++
+		if i >= len(tokens) || tokens[i].text != "." {
+			break
+		}
+		i++
+	}
+
+	if len(parts) < 1 || fromItem && i < len(tokens) && tokens[i].text == "(" {
+		return ""
+	}
+	return strings.Join(parts, ".")
+}
+
+// isCommonTableExpression reports whether the word at tokens[i] names a common table expression:
+// name [(columns)] AS [[NOT] MATERIALIZED] (.
+func isCommonTableExpression(tokens []sqlToken, i int) bool {
+	j := i + 1
+	if j < len(tokens) && tokens[j].text == "(" {
+		depth := 0
+		for ; j < len(tokens); j++ {
+			if tokens[j].text == "(" {
+				depth++
+			} else if tokens[j].text == ")" {
+				depth--
+				if depth == 0 {
+					break
+				}
+			}
+		}
+		j++
+	}
+
+	if j >= len(tokens) || !tokens[j].is("AS") {
+		return false
+	}
+	j++
+	for j < len(tokens) && isAnyKeyword(tokens[j], "NOT", "MATERIALIZED") {
+		j++
+	}
+	return j < len(tokens) && tokens[j].text == "("
+}
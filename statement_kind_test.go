@@ -0,0 +1,136 @@
+package dbsql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifyStatement(t *testing.T) {
+	tests := []struct {
+		Statement string
+		Kind      StatementKind
+		Tables    []string
+	}{
+		{
+			Statement: "SELECT c.first_name FROM customers c JOIN billing.invoices i ON i.customer_id = c.customer_id",
+			Kind:      StatementRead,
+			Tables:    []string{"customers", "billing.invoices"},
+		},
+		{
+			Statement: "SELECT * FROM customers, addresses a, \"Orders\" WHERE extract(year FROM created_at) = 2024",
+			Kind:      StatementRead,
+			Tables:    []string{"customers", "addresses", "Orders"},
+		},
+		{
+			Statement: "SELECT * FROM (SELECT * FROM customers) c, LATERAL (SELECT * FROM addresses) a, generate_series(1, 3)",
+			Kind:      StatementRead,
+			Tables:    []string{"customers", "addresses"},
+		},
+		{
+			Statement: "WITH recent AS (SELECT * FROM orders) SELECT * FROM recent WHERE a IS DISTINCT FROM b",
+			Kind:      StatementRead,
+			Tables:    []string{"orders"},
+		},
+		{
+			Statement: "WITH d AS (DELETE FROM carts RETURNING *) SELECT * FROM d JOIN customers USING (customer_id)",
+			Kind:      StatementWrite,
+			Tables:    []string{"carts", "customers"},
+		},
+		{
+			Statement: "SELECT * FROM customers WHERE customer_id = @customer_id FOR UPDATE",
+			Kind:      StatementWrite,
+			Tables:    []string{"customers"},
+		},
+		{
+			Statement: "WITH moved AS NOT MATERIALIZED (UPDATE orders SET status = 'archived' RETURNING *) SELECT count(*) FROM moved",
+			Kind:      StatementWrite,
+			Tables:    []string{"orders"},
+		},
+		{
+			Statement: "SELECT * FROM jobs WHERE job_id = $1 FOR NO KEY UPDATE",
+			Kind:      StatementWrite,
+			Tables:    []string{"jobs"},
+		},
+		{Statement: "SELECT 1 AS update", Kind: StatementRead},
+		{Statement: "SELECT insert, \"delete\" FROM audit_events", Kind: StatementRead, Tables: []string{"audit_events"}},
+		{Statement: "WITH merge AS (SELECT * FROM leads) SELECT * FROM merge", Kind: StatementRead, Tables: []string{"leads"}},
+		{
+			Statement: "SELECT * FROM jobs FOR KEY SHARE SKIP LOCKED",
+			Kind:      StatementWrite,
+			Tables:    []string{"jobs"},
+		},
+		{
+			Statement: "SELECT * INTO customers_copy FROM customers",
+			Kind:      StatementDDL,
+			Tables:    []string{"customers_copy", "customers"},
+		},
+		{
+			Statement: "INSERT INTO customers (first_name) SELECT first_name FROM leads ON CONFLICT DO UPDATE SET first_name = excluded.first_name",
+			Kind:      StatementWrite,
+			Tables:    []string{"customers", "leads"},
+		},
+		{
+			Statement: "UPDATE ONLY customers SET first_name = $1, last_name = $2 FROM addresses WHERE addresses.customer_id = customers.customer_id",
+			Kind:      StatementWrite,
+			Tables:    []string{"customers", "addresses"},
+		},
+		{
+			Statement: "DELETE FROM customers USING addresses, orders WHERE true",
+			Kind:      StatementWrite,
+			Tables:    []string{"customers", "addresses", "orders"},
+		},
+		{
+			Statement: "MERGE INTO customers c USING leads l ON l.email = c.email WHEN MATCHED THEN DO NOTHING",
+			Kind:      StatementWrite,
+			Tables:    []string{"customers", "leads"},
+		},
+		{Statement: "TRUNCATE TABLE customers, addresses", Kind: StatementWrite, Tables: []string{"customers", "addresses"}},
+		{Statement: "COPY customers (first_name) FROM STDIN", Kind: StatementWrite, Tables: []string{"customers"}},
+		{Statement: "COPY (SELECT * FROM customers) TO STDOUT", Kind: StatementRead},
+		{Statement: "TABLE customers", Kind: StatementRead, Tables: []string{"customers"}},
+		{Statement: "(SELECT 1) UNION (SELECT 2)", Kind: StatementRead},
+		{Statement: "EXPLAIN SELECT * FROM customers", Kind: StatementRead, Tables: []string{"customers"}},
+		{Statement: "EXPLAIN (ANALYZE, BUFFERS) DELETE FROM customers", Kind: StatementWrite, Tables: []string{"customers"}},
+		{Statement: "CREATE TABLE IF NOT EXISTS customers (customer_id bigint)", Kind: StatementDDL, Tables: []string{"customers"}},
+		{Statement: "DROP TABLE IF EXISTS public.customers", Kind: StatementDDL, Tables: []string{"public.customers"}},
+		{Statement: "BEGIN", Kind: StatementTransactionControl},
+		{Statement: "SET TRANSACTION READ ONLY", Kind: StatementTransactionControl},
+		{Statement: "ROLLBACK TO SAVEPOINT dbsql_batch_item", Kind: StatementTransactionControl},
+		{Statement: "PREPARE TRANSACTION 'tx'", Kind: StatementTransactionControl},
+		{Statement: "SET statement_timeout = 0", Kind: StatementUtility},
+		{Statement: "LISTEN orders", Kind: StatementUtility},
+		{Statement: "VACUUM ANALYZE customers", Kind: StatementWrite},
+		{Statement: "CLUSTER customers", Kind: StatementWrite},
+		{Statement: "NOTIFY orders, 'created'", Kind: StatementWrite},
+		{Statement: "PREPARE p (bigint) AS DELETE FROM customers WHERE customer_id = $1", Kind: StatementWrite, Tables: []string{"customers"}},
+		{Statement: "PREPARE p AS SELECT * FROM customers", Kind: StatementRead, Tables: []string{"customers"}},
+		{Statement: "EXECUTE p (42)", Kind: StatementUnknown},
+		{Statement: "-- only a comment", Kind: StatementUnknown},
+		{Statement: "FROBNICATE customers", Kind: StatementUnknown},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Statement, func(t *testing.T) {
+			classification := ClassifyStatement(test.Statement)
+			require.Equal(t, test.Kind, classification.Kind, classification.Kind.String())
+			require.Equal(t, test.Tables, classification.Tables)
+		})
+	}
+}
+
+func TestPreparedStatementClassification(t *testing.T) {
+	preparedStatement, err := PrepareStatement("UPDATE customers SET first_name = @first_name WHERE customer_id = @customer_id")
+	require.NoError(t, err)
+	require.Equal(t, StatementWrite, statementKind(preparedStatement))
+	require.Equal(t, "write", statementKind(preparedStatement).String())
+	require.Equal(t, []string{"customers"}, statementTables(preparedStatement))
+
+	preparedStatement, err = PrepareStatement("SELECT archive_orders(@before)", ClassifyAs(StatementWrite))
+	require.NoError(t, err)
+	require.Equal(t, StatementWrite, statementKind(preparedStatement))
+
+	copied, err := copyPreparedStatement(preparedStatement)
+	require.NoError(t, err)
+	require.Equal(t, StatementWrite, statementKind(copied))
+}
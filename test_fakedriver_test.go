@@ -0,0 +1,293 @@
+package dbsql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDriverCall records a single statement received by the fake driver.
+type fakeDriverCall struct {
+	Query string
+	Args  []any
+	// Conn is the number of the connection the statement was sent on, starting at 1.
+	Conn int
+}
+
+// fakeDriver is an in-memory database/sql driver used to unit test the package without a running database.
+// Every statement that reaches the driver is recorded, and the results are produced by the optional
+// ExecFunc and QueryFunc hooks.
+type fakeDriver struct {
+	mu sync.Mutex
+
+	Prepared  []string
+	Execs     []fakeDriverCall
+	Queries   []fakeDriverCall
+	Begins    int
+	Commits   int
+	Rollbacks int
+	// Conns and Closes count the connections opened and closed.
+	Conns  int
+	Closes int
+
+	BeginFunc   func() error
+	PrepareFunc func(query string) error
+	ExecFunc    func(query string, args []any) (driver.Result, error)
+	QueryFunc   func(query string, args []any) (driver.Rows, error)
+}
+
+// NewFakeDB returns a *sql.DB backed by a fakeDriver, closing it when the test ends.
+func NewFakeDB(t *testing.T) (*sql.DB, *fakeDriver) {
+	fd := &fakeDriver{}
+	db := sql.OpenDB(fd)
+	t.Cleanup(func() {
+		require.NoError(t, db.Close())
+	})
+	return db, fd
+}
+
+func (f *fakeDriver) Connect(context.Context) (driver.Conn, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.Conns++
+	return &fakeConn{driver: f, id: f.Conns}, nil
+}
+
+func (f *fakeDriver) Driver() driver.Driver {
+	return nil
+}
+
+func (f *fakeDriver) ExecCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.Execs)
+}
+
+func (f *fakeDriver) QueryCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.Queries)
+}
+
+func (f *fakeDriver) LastExec() fakeDriverCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.Execs) < 1 {
+		return fakeDriverCall{}
+	}
+	return f.Execs[len(f.Execs)-1]
+}
+
+func (f *fakeDriver) LastQuery() fakeDriverCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.Queries) < 1 {
+		return fakeDriverCall{}
+	}
+	return f.Queries[len(f.Queries)-1]
+}
+
+func (f *fakeDriver) prepare(query string) error {
+	f.mu.Lock()
+	f.Prepared = append(f.Prepared, query)
+	prepareFunc := f.PrepareFunc
+	f.mu.Unlock()
+
+	if prepareFunc != nil {
+		return prepareFunc(query)
+	}
+	return nil
+}
+
+func (f *fakeDriver) exec(conn int, query string, args []driver.NamedValue) (driver.Result, error) {
+	values := namedValuesToAny(args)
+
+	f.mu.Lock()
+	f.Execs = append(f.Execs, fakeDriverCall{Query: query, Args: values, Conn: conn})
+	execFunc := f.ExecFunc
+	f.mu.Unlock()
+
+	if execFunc != nil {
+		return execFunc(query, values)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (f *fakeDriver) query(conn int, query string, args []driver.NamedValue) (driver.Rows, error) {
+	values := namedValuesToAny(args)
+
+	f.mu.Lock()
+	f.Queries = append(f.Queries, fakeDriverCall{Query: query, Args: values, Conn: conn})
+	queryFunc := f.QueryFunc
+	f.mu.Unlock()
+
+	if queryFunc != nil {
+		return queryFunc(query, values)
+	}
+	return &fakeRows{}, nil
+}
+
+func namedValuesToAny(args []driver.NamedValue) []any {
+	if len(args) < 1 {
+		return nil
+	}
+	values := make([]any, len(args))
+	for i := range args {
+		values[i] = args[i].Value
+	}
+	return values
+}
+
+type fakeConn struct {
+	driver *fakeDriver
+	id     int
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *fakeConn) PrepareContext(_ context.Context, query string) (driver.Stmt, error) {
+	if err := c.driver.prepare(query); err != nil {
+		return nil, err
+	}
+	return &fakeStmt{conn: c, query: query}, nil
+}
+
+func (c *fakeConn) Close() error {
+	c.driver.mu.Lock()
+	c.driver.Closes++
+	c.driver.mu.Unlock()
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *fakeConn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	c.driver.mu.Lock()
+	c.driver.Begins++
+	beginFunc := c.driver.BeginFunc
+	c.driver.mu.Unlock()
+
+	if beginFunc != nil {
+		if err := beginFunc(); err != nil {
+			return nil, err
+		}
+	}
+	return &fakeTx{driver: c.driver}, nil
+}
+
+func (c *fakeConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.driver.exec(c.id, query, args)
+}
+
+func (c *fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.driver.query(c.id, query, args)
+}
+
+// CheckNamedValue accepts every argument as is so tests can bind arbitrary values.
+func (c *fakeConn) CheckNamedValue(*driver.NamedValue) error {
+	return nil
+}
+
+type fakeTx struct {
+	driver *fakeDriver
+}
+
+func (t *fakeTx) Commit() error {
+	t.driver.mu.Lock()
+	t.driver.Commits++
+	t.driver.mu.Unlock()
+	return nil
+}
+
+func (t *fakeTx) Rollback() error {
+	t.driver.mu.Lock()
+	t.driver.Rollbacks++
+	t.driver.mu.Unlock()
+	return nil
+}
+
+type fakeStmt struct {
+	conn  *fakeConn
+	query string
+}
+
+func (s *fakeStmt) Close() error {
+	return nil
+}
+
+func (s *fakeStmt) NumInput() int {
+	return -1
+}
+
+func (s *fakeStmt) Exec([]driver.Value) (driver.Result, error) {
+	return nil, errors.New("fake driver: use ExecContext")
+}
+
+func (s *fakeStmt) Query([]driver.Value) (driver.Rows, error) {
+	return nil, errors.New("fake driver: use QueryContext")
+}
+
+func (s *fakeStmt) ExecContext(_ context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return s.conn.driver.exec(s.conn.id, s.query, args)
+}
+
+func (s *fakeStmt) QueryContext(_ context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.conn.driver.query(s.conn.id, s.query, args)
+}
+
+// fakeRows is a driver.Rows over a fixed set of values. If err is set, it is returned instead of io.EOF
+// once the values are exhausted.
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+	index   int
+	err     error
+	closed  bool
+}
+
+// newFakeRows returns fakeRows with the given columns and row values.
+func newFakeRows(columns []string, values ...[]driver.Value) *fakeRows {
+	return &fakeRows{columns: columns, values: values}
+}
+
+func (r *fakeRows) Columns() []string {
+	return r.columns
+}
+
+func (r *fakeRows) Close() error {
+	r.closed = true
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.index >= len(r.values) {
+		if r.err != nil {
+			return r.err
+		}
+		return io.EOF
+	}
+	copy(dest, r.values[r.index])
+	r.index++
+	return nil
+}
+
+var (
+	_ driver.Connector          = (*fakeDriver)(nil)
+	_ driver.ConnBeginTx        = (*fakeConn)(nil)
+	_ driver.ConnPrepareContext = (*fakeConn)(nil)
+	_ driver.ExecerContext      = (*fakeConn)(nil)
+	_ driver.QueryerContext     = (*fakeConn)(nil)
+	_ driver.NamedValueChecker  = (*fakeConn)(nil)
+	_ driver.StmtExecContext    = (*fakeStmt)(nil)
+	_ driver.StmtQueryContext   = (*fakeStmt)(nil)
+)
@@ -0,0 +1,172 @@
+package dbsql
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+// Attribute keys set on the spans started by TracedDB.
+const (
+	// AttributeDBSystem is the database management system, always "postgresql".
+	AttributeDBSystem = "db.system"
+	// AttributeDBStatement is the SQL sent to the database.
+	AttributeDBStatement = "db.statement"
+	// AttributeDBOperation is the SQL command of the statement, e.g. "SELECT" or "INSERT".
+	AttributeDBOperation = "db.operation"
+	// AttributeCall is the dbsql Operation used to run the statement, e.g. "exec" or "query".
+	AttributeCall = "dbsql.call"
+	// AttributeStatementName is the name given to the statement with StatementName.
+	AttributeStatementName = "dbsql.statement.name"
+	// AttributeParameterCount is the number of positional parameters bound to the statement.
+	AttributeParameterCount = "dbsql.parameter_count"
+	// AttributeRowsAffected is the number of rows affected by an Exec call.
+	AttributeRowsAffected = "dbsql.rows_affected"
+	// AttributeTxReadOnly is set on transaction spans and reports whether the transaction is read-only.
+	AttributeTxReadOnly = "dbsql.tx.read_only"
+)
+
+// Attribute is a key-value pair set on a Span.
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// Tracer starts spans around the calls and transactions made through a TracedDB.
+type Tracer interface {
+	// StartSpan starts a span named name as a child of the span in ctx, if any, and returns a context
+	// carrying the new span.
+	StartSpan(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a single traced operation.
+type Span interface {
+	// SetAttributes sets attributes on the span.
+	SetAttributes(attrs ...Attribute)
+	// End ends the span, recording err if it is not nil.
+	End(err error)
+}
+
+// NoopTracer returns a Tracer whose spans do nothing.
+func NoopTracer() Tracer {
+	return noopTracer{}
+}
+
+type noopTracer struct{}
+
+func (noopTracer) StartSpan(ctx context.Context, _ string) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(...Attribute) {}
+
+func (noopSpan) End(error) {}
+
+// TracedDB is a database handle that starts a span around every call made through Exec, Query and
+// QueryRow and every transaction run through WithTransaction. It is returned by WithTracer.
+//
+// The span context is passed on to the database driver and, for transactions, to the TxFunc, so the
+// statements run inside a transaction are children of the transaction's span.
+type TracedDB struct {
+	wrappedDB
+	tracer Tracer
+}
+
+// WithTracer wraps dbPrepExec so that its calls and transactions are traced with tracer. A nil tracer
+// is replaced with NoopTracer.
+//
+// Example:
+//
+//	db := dbsql.WithTracer(sqlDB, oteltracer.New(otel.Tracer("dbsql")))
+func WithTracer(dbPrepExec DBPreparerExecutor, tracer Tracer) *TracedDB {
+	if tracer == nil {
+		tracer = NoopTracer()
+	}
+
+	return &TracedDB{
+		wrappedDB: wrappedDB{dbPrepExec},
+		tracer:    tracer,
+	}
+}
+
+// InterceptCall starts a span around the call.
+func (t *TracedDB) InterceptCall(ctx context.Context, call *Call, next CallHandler) (*CallResult, error) {
+	dbOperation := statementCommand(call.Query)
+
+	spanName := statementName(call.PreparedStatement)
+	if spanName == "" {
+		spanName = dbOperation
+	}
+	if spanName == "" {
+		spanName = "dbsql." + call.Operation.String()
+	}
+
+	ctx, span := t.tracer.StartSpan(ctx, spanName)
+
+	attrs := []Attribute{
+		{Key: AttributeDBSystem, Value: "postgresql"},
+		{Key: AttributeDBStatement, Value: call.Query},
+		{Key: AttributeDBOperation, Value: dbOperation},
+		{Key: AttributeCall, Value: call.Operation.String()},
+		{Key: AttributeParameterCount, Value: len(call.PreparedStatement.BoundParameterValues())},
+	}
+	if name := statementName(call.PreparedStatement); name != "" {
+		attrs = append(attrs, Attribute{Key: AttributeStatementName, Value: name})
+	}
+	span.SetAttributes(attrs...)
+
+	callResult, err := interceptCall(ctx, t.DBPreparerExecutor, call, next)
+	if err == nil && callResult != nil && callResult.Result != nil {
+		if rowsAffected, rowsErr := callResult.Result.RowsAffected(); rowsErr == nil {
+			span.SetAttributes(Attribute{Key: AttributeRowsAffected, Value: rowsAffected})
+		}
+	}
+	span.End(err)
+
+	return callResult, err
+}
+
+// RunInTx starts a span around the transaction. The tx handle given to txFunc is traced as well.
+func (t *TracedDB) RunInTx(ctx context.Context, opts *sql.TxOptions, txFunc TxFunc) error {
+	ctx, span := t.tracer.StartSpan(ctx, "dbsql.transaction")
+	span.SetAttributes(
+		Attribute{Key: AttributeDBSystem, Value: "postgresql"},
+		Attribute{Key: AttributeTxReadOnly, Value: opts != nil && opts.ReadOnly},
+	)
+
+	err := WithTransaction(ctx, t.DBPreparerExecutor, opts, func(ctx context.Context, tx DBPreparerExecutor) error {
+		return txFunc(ctx, WithTracer(tx, t.tracer))
+	})
+	span.End(err)
+
+	return err
+}
+
+// statementCommand returns the upper-cased leading keyword of an SQL statement, skipping comments.
+func statementCommand(statement string) string {
+	for _, token := range lexSQL(statement) {
+		switch token.kind {
+		case sqlTokenComment:
+			continue
+		case sqlTokenWord:
+			return strings.ToUpper(token.text)
+		default:
+			return ""
+		}
+	}
+	return ""
+}
+
+// wrapSession returns conn traced as well.
+func (t *TracedDB) wrapSession(conn DBPreparerExecutor) DBPreparerExecutor {
+	return WithTracer(conn, t.tracer)
+}
+
+var (
+	_ DB             = (*TracedDB)(nil)
+	_ DBInterceptor  = (*TracedDB)(nil)
+	_ DBTransactor   = (*TracedDB)(nil)
+	_ sessionWrapper = (*TracedDB)(nil)
+)
@@ -0,0 +1,143 @@
+package dbsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type recordedSpan struct {
+	Name   string
+	Parent string
+	Attrs  map[string]any
+	Err    error
+	Ended  bool
+}
+
+type spanContextKey struct{}
+
+// recordingTracer is a Tracer that records every span it starts.
+type recordingTracer struct {
+	mu    sync.Mutex
+	Spans []*recordedSpan
+}
+
+func (r *recordingTracer) StartSpan(ctx context.Context, name string) (context.Context, Span) {
+	parent, _ := ctx.Value(spanContextKey{}).(string)
+	span := &recordedSpan{Name: name, Parent: parent, Attrs: map[string]any{}}
+
+	r.mu.Lock()
+	r.Spans = append(r.Spans, span)
+	r.mu.Unlock()
+
+	return context.WithValue(ctx, spanContextKey{}, name), span
+}
+
+func (r *recordedSpan) SetAttributes(attrs ...Attribute) {
+	for _, attr := range attrs {
+		r.Attrs[attr.Key] = attr.Value
+	}
+}
+
+func (r *recordedSpan) End(err error) {
+	r.Err = err
+	r.Ended = true
+}
+
+func TestWithTracer(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		desc      string
+		assertion func(*testing.T, string)
+	}{
+		{
+			desc: "Exec calls are traced with the statement attributes",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fd := NewFakeDB(t)
+				fd.ExecFunc = func(string, []any) (driver.Result, error) {
+					return driver.RowsAffected(4), nil
+				}
+
+				tracer := &recordingTracer{}
+				db := WithTracer(sqlDB, tracer)
+
+				preparedStatement, err := PrepareStatement(
+					"UPDATE customers SET last_name = @last_name WHERE customer_id = @customer_id",
+					StatementName("update_last_name"),
+				)
+				require.NoError(t, err, desc)
+
+				_, err = ExecContext(
+					context.Background(),
+					db,
+					preparedStatement,
+					BindParameterValue("last_name", "Doe"),
+					BindParameterValue("customer_id", 1),
+				)
+				require.NoError(t, err, desc)
+
+				require.Len(t, tracer.Spans, 1, desc)
+				span := tracer.Spans[0]
+				require.Equal(t, "update_last_name", span.Name, desc)
+				require.True(t, span.Ended, desc)
+				require.NoError(t, span.Err, desc)
+				require.Equal(t, "UPDATE customers SET last_name = $1 WHERE customer_id = $2", span.Attrs[AttributeDBStatement], desc)
+				require.Equal(t, "UPDATE", span.Attrs[AttributeDBOperation], desc)
+				require.Equal(t, 2, span.Attrs[AttributeParameterCount], desc)
+				require.Equal(t, int64(4), span.Attrs[AttributeRowsAffected], desc)
+			},
+		},
+		{
+			desc: "Statements inside a transaction are children of the transaction span",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, fd := NewFakeDB(t)
+
+				tracer := &recordingTracer{}
+				db := WithTracer(sqlDB, tracer)
+
+				preparedStatement, err := PrepareStatement("DELETE FROM customers")
+				require.NoError(t, err, desc)
+
+				expectedErr := errors.New("abort")
+				err = WithTransaction(context.Background(), db, nil, func(ctx context.Context, tx DBPreparerExecutor) error {
+					if _, err := ExecContext(ctx, tx, preparedStatement); err != nil {
+						return err
+					}
+					return expectedErr
+				})
+				require.ErrorIs(t, err, expectedErr, desc)
+
+				require.Len(t, tracer.Spans, 2, desc)
+				require.Equal(t, "dbsql.transaction", tracer.Spans[0].Name, desc)
+				require.ErrorIs(t, tracer.Spans[0].Err, expectedErr, desc)
+				require.Equal(t, "DELETE", tracer.Spans[1].Name, desc)
+				require.Equal(t, "dbsql.transaction", tracer.Spans[1].Parent, desc)
+				require.Equal(t, 1, fd.Rollbacks, desc)
+			},
+		},
+		{
+			desc: "A nil tracer falls back to the no-op tracer",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, _ := NewFakeDB(t)
+
+				preparedStatement, err := PrepareStatement("SELECT 1")
+				require.NoError(t, err, desc)
+
+				rows, err := QueryContext(context.Background(), WithTracer(sqlDB, nil), preparedStatement)
+				require.NoError(t, err, desc)
+				require.NoError(t, rows.Close(), desc)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			test.assertion(t, test.desc)
+		})
+	}
+}
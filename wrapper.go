@@ -0,0 +1,87 @@
+package dbsql
+
+import "context"
+
+// wrappedDB is embedded by the handles that wrap another one, such as ReadOnlyDB or LimitedDB. It
+// implements Unwrap, so helpers such as unwrapTo can reach the wrapped handle, and forwards Close, Ping and
+// PingContext to it.
+type wrappedDB struct {
+	DBPreparerExecutor
+}
+
+// Unwrap returns the wrapped database handle.
+func (w wrappedDB) Unwrap() DBPreparerExecutor {
+	return w.DBPreparerExecutor
+}
+
+// Close closes the wrapped handle if it implements DBCloser.
+func (w wrappedDB) Close() error {
+	if closer, ok := w.DBPreparerExecutor.(DBCloser); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Ping pings the wrapped handle if it implements DBPinger.
+func (w wrappedDB) Ping() error {
+	if pinger, ok := w.DBPreparerExecutor.(DBPinger); ok {
+		return pinger.Ping()
+	}
+	return nil
+}
+
+// PingContext pings the wrapped handle under ctx if it implements DBContextPinger or DBPinger.
+func (w wrappedDB) PingContext(ctx context.Context) error {
+	_, err := pingContext(ctx, w.DBPreparerExecutor)
+	return err
+}
+
+// pingContext reports whether dbPrepExec can be pinged at all, and pings it under ctx. Handles that only
+// implement DBPinger are pinged in the background, and abandoned when ctx is done.
+func pingContext(ctx context.Context, dbPrepExec DBPreparerExecutor) (bool, error) {
+	if pinger, ok := dbPrepExec.(DBContextPinger); ok {
+		return true, pinger.PingContext(ctx)
+	}
+
+	pinger, ok := dbPrepExec.(DBPinger)
+	if !ok {
+		return false, nil
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- pinger.Ping()
+	}()
+
+	select {
+	case err := <-done:
+		return true, err
+	case <-ctx.Done():
+		return true, ctx.Err()
+	}
+}
+
+// unwrapTo returns the first handle of type T found by following the Unwrap chain from dbPrepExec,
+// dbPrepExec included.
+func unwrapTo[T any](dbPrepExec DBPreparerExecutor) (T, bool) {
+	for dbPrepExec != nil {
+		if target, ok := dbPrepExec.(T); ok {
+			return target, true
+		}
+
+		unwrapper, ok := dbPrepExec.(interface{ Unwrap() DBPreparerExecutor })
+		if !ok {
+			break
+		}
+		dbPrepExec = unwrapper.Unwrap()
+	}
+
+	var zero T
+	return zero, false
+}
+
+var (
+	_ DBCloser        = wrappedDB{}
+	_ DBPinger        = wrappedDB{}
+	_ DBContextPinger = wrappedDB{}
+)
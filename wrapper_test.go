@@ -0,0 +1,66 @@
+package dbsql
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrappedDB(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		desc      string
+		assertion func(*testing.T, string)
+	}{
+		{
+			desc: "unwrapTo follows the Unwrap chain of nested wrappers",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, _ := NewFakeDB(t)
+				db := WithReadOnly(WithSingleflight(WithInterceptors(sqlDB)))
+
+				found, ok := unwrapTo[*sql.DB](db)
+				require.True(t, ok, desc)
+				require.Same(t, sqlDB, found, desc)
+
+				singleflight, ok := unwrapTo[*SingleflightDB](db)
+				require.True(t, ok, desc)
+				require.Same(t, db.Unwrap(), singleflight, desc)
+
+				_, ok = unwrapTo[*sql.Tx](db)
+				require.False(t, ok, desc)
+				_, ok = unwrapTo[*sql.DB](nil)
+				require.False(t, ok, desc)
+			},
+		},
+		{
+			desc: "Close, Ping and PingContext are forwarded to the wrapped handle",
+			assertion: func(t *testing.T, desc string) {
+				sqlDB, _ := NewFakeDB(t)
+				db := WithReadOnly(WithSingleflight(sqlDB))
+
+				require.NoError(t, db.Ping(), desc)
+				require.NoError(t, db.PingContext(context.Background()), desc)
+
+				hung := WithReadOnly(&hungPingDB{DBPreparerExecutor: sqlDB})
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+				defer cancel()
+				require.ErrorIs(t, hung.PingContext(ctx), context.DeadlineExceeded, desc)
+
+				require.NoError(t, db.Close(), desc)
+				require.Error(t, sqlDB.Ping(), desc)
+			},
+		},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			tc.assertion(t, tc.desc)
+		})
+	}
+}